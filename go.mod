@@ -23,6 +23,7 @@ require (
 	gopkg.in/ini.v1 v1.67.0
 	gopkg.in/yaml.v3 v3.0.1
 	k8s.io/apimachinery v0.32.6
+	rsc.io/qr v0.2.0
 )
 
 require (
@@ -3,13 +3,18 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/exec"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/harvester/harvester-installer/pkg/config"
 	"github.com/harvester/harvester-installer/pkg/console"
+	"github.com/harvester/harvester-installer/pkg/util"
 	"github.com/harvester/harvester-installer/pkg/version"
 	"github.com/urfave/cli/v3"
 )
@@ -83,6 +88,183 @@ Executes the Harvester installer if no command is specified.`,
 					}
 				},
 			},
+			{
+				Name:  "show-token",
+				Usage: "Print the cluster token this node was installed with",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "config",
+						Value: "/oem/harvester.config",
+						Usage: "Harvester config file",
+					},
+					&cli.StringFlag{
+						Name:  "secrets",
+						Value: config.SecretsFile,
+						Usage: "Sealed secrets file",
+					},
+					&cli.StringFlag{
+						Name:  "key",
+						Value: config.SecretsKeyFile,
+						Usage: "Key file of the sealed secrets",
+					},
+					&cli.BoolFlag{
+						Name:  "qr",
+						Usage: "Also print the token as a QR code",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					data, err := os.ReadFile(cmd.String("config"))
+					if err != nil {
+						return err
+					}
+					harvesterCfg, err := config.LoadHarvesterConfig(data)
+					if err != nil {
+						return err
+					}
+					secrets, err := config.ReadSecretsFile(cmd.String("secrets"), cmd.String("key"))
+					if err != nil {
+						return err
+					}
+					harvesterCfg.RestoreSecrets(secrets)
+					token := harvesterCfg.Token
+					if config.IsSecretReference(token) {
+						// Harvester config keeps the secret reference, the
+						// resolved token only lives in the rancherd config.
+						if token, err = readRancherdToken(config.RancherdConfigFile); err != nil {
+							return err
+						}
+					}
+					if token == "" {
+						return fmt.Errorf("no token found in %s", cmd.String("config"))
+					}
+					fmt.Println(token)
+					if cmd.Bool("qr") {
+						qrCode, err := util.RenderQRCode(token)
+						if err != nil {
+							return err
+						}
+						fmt.Print(qrCode)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "explain",
+				Usage:     "Print the config values this node was installed with and where they came from",
+				ArgsUsage: "[path...]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "config",
+						Value: "/oem/harvester.config",
+						Usage: "Harvester config file",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					data, err := os.ReadFile(cmd.String("config"))
+					if err != nil {
+						return err
+					}
+					harvesterCfg, err := config.LoadHarvesterConfig(data)
+					if err != nil {
+						return err
+					}
+					if harvesterCfg.Provenance, err = config.LoadProvenance(data); err != nil {
+						return err
+					}
+					fmt.Print(harvesterCfg.Explain(cmd.Args().Slice()...))
+					return nil
+				},
+			},
+			{
+				Name:  "recover-secrets-key",
+				Usage: "Recover the key of the sealed secrets with the recovery key given at install",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "secrets",
+						Value: config.SecretsFile,
+						Usage: "Sealed secrets file",
+					},
+					&cli.StringFlag{
+						Name:  "key",
+						Value: config.SecretsKeyFile,
+						Usage: "Key file to write",
+					},
+					&cli.StringFlag{
+						Name:     "recovery-key-file",
+						Usage:    "File holding the recovery key, - for the standard input",
+						Required: true,
+					},
+				},
+				Action: func(_ context.Context, cmd *cli.Command) error {
+					data, err := os.ReadFile(cmd.String("secrets"))
+					if err != nil {
+						return err
+					}
+					var recoveryKey []byte
+					if file := cmd.String("recovery-key-file"); file == "-" {
+						recoveryKey, err = io.ReadAll(os.Stdin)
+					} else {
+						recoveryKey, err = os.ReadFile(file)
+					}
+					if err != nil {
+						return err
+					}
+					key, err := config.RecoverSecretsKey(data, strings.TrimRight(string(recoveryKey), "\r\n"))
+					if err != nil {
+						return err
+					}
+					if err := config.WriteSecretsKey(cmd.String("key"), key); err != nil {
+						return err
+					}
+					log.Printf("Recovered the secrets key into %s", cmd.String("key"))
+					return nil
+				},
+			},
+			{
+				Name:  "unseal-secrets",
+				Usage: "Put sealed secrets back into files and user passwords at boot",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "secrets",
+						Value: config.SecretsFile,
+						Usage: "Sealed secrets file",
+					},
+					&cli.StringFlag{
+						Name:  "key",
+						Value: config.SecretsKeyFile,
+						Usage: "Key file of the sealed secrets",
+					},
+					&cli.StringSliceFlag{
+						Name:  "file",
+						Usage: "File to put secrets back into",
+					},
+					&cli.StringSliceFlag{
+						Name:  "user",
+						Usage: "User to restore the password hash of",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					secrets, err := config.ReadSecretsFile(cmd.String("secrets"), cmd.String("key"))
+					if err != nil {
+						return err
+					}
+					if secrets == nil {
+						log.Printf("No secrets found in %s", cmd.String("secrets"))
+						return nil
+					}
+					for _, file := range cmd.StringSlice("file") {
+						if err := unsealFile(file, secrets); err != nil {
+							return err
+						}
+					}
+					for _, user := range cmd.StringSlice("user") {
+						if err := unsealUserPassword(ctx, user, secrets); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
 		},
 	}
 
@@ -90,3 +272,45 @@ Executes the Harvester installer if no command is specified.`,
 		log.Fatalf("Error: %v", err)
 	}
 }
+
+func readRancherdToken(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	var rancherdConfig struct {
+		Token string `yaml:"token"`
+	}
+	if err := yaml.Unmarshal(data, &rancherdConfig); err != nil {
+		return "", err
+	}
+	return rancherdConfig.Token, nil
+}
+
+func unsealFile(file string, secrets config.Secrets) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, []byte(secrets.Unseal(string(data))), info.Mode().Perm())
+}
+
+func unsealUserPassword(ctx context.Context, user string, secrets config.Secrets) error {
+	hash, err := secrets.PasswordHash()
+	if err != nil {
+		return err
+	}
+	if hash == "" {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, "chpasswd", "-e")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("%s:%s\n", user, hash))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("fail to set password of %s: %w: %s", user, err, string(output))
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	yipSchema "github.com/rancher/yip/pkg/schema"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	auditPolicyFile        = "/etc/rancher/rke2/config.yaml.d/92-harvester-kube-audit-policy.yaml"
+	auditWebhookConfigFile = "/etc/rancher/rke2/audit-webhook-config.yaml"
+	auditConfigFile        = "/etc/rancher/rke2/config.yaml.d/94-harvester-kube-audit.yaml"
+	auditPolicyAPIVersion  = "audit.k8s.io/v1"
+	auditPolicyKind        = "Policy"
+)
+
+var (
+	auditLevels        = []string{"None", "Metadata", "Request", "RequestResponse"}
+	auditStages        = []string{"RequestReceived", "ResponseStarted", "ResponseComplete", "Panic"}
+	auditWebhookModes  = []string{"batch", "blocking", "blocking-strict"}
+	defaultWebhookMode = "batch"
+)
+
+// AuditConfig is how kube-apiserver audits requests. The policy defaults to
+// logging the changes at the Metadata level, and the log to the defaults of
+// RKE2.
+type AuditConfig struct {
+	// Policy is an audit.k8s.io/v1 Policy document.
+	Policy string `json:"policy,omitempty"`
+	// LogPath is the file the audit log is written to.
+	LogPath string `json:"logPath,omitempty"`
+	// LogMaxAge is the number of days old logs are kept, LogMaxBackup the
+	// number of them and LogMaxSize the size in MB they are rotated at.
+	LogMaxAge    int          `json:"logMaxAge,omitempty"`
+	LogMaxBackup int          `json:"logMaxBackup,omitempty"`
+	LogMaxSize   int          `json:"logMaxSize,omitempty"`
+	Webhook      AuditWebhook `json:"webhook,omitempty"`
+}
+
+// AuditWebhook is a backend the audit events are sent to.
+type AuditWebhook struct {
+	URL string `json:"url,omitempty"`
+	// CACerts is PEM text or the path of a PEM file.
+	CACerts string `json:"caCerts,omitempty"`
+	// Mode is batch, blocking or blocking-strict, batch if unset.
+	Mode string `json:"mode,omitempty"`
+}
+
+// Enabled tells if audit events are sent to a webhook.
+func (w AuditWebhook) Enabled() bool {
+	return w.URL != ""
+}
+
+// CACertsData returns the CA certificates of the webhook, base64 encoded for
+// a kubeconfig.
+func (w AuditWebhook) CACertsData() (string, error) {
+	if w.CACerts == "" {
+		return "", nil
+	}
+	pem, err := LoadPEM(w.CACerts)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(pem), nil
+}
+
+// auditPolicy holds the parts of an audit policy that are validated.
+type auditPolicy struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	OmitStages []string `yaml:"omitStages"`
+	Rules      []struct {
+		Level      string   `yaml:"level"`
+		OmitStages []string `yaml:"omitStages"`
+	} `yaml:"rules"`
+}
+
+// ValidateAuditConfig checks the policy is an audit policy, and the log and
+// webhook settings.
+func ValidateAuditConfig(a AuditConfig) error {
+	if a.Policy != "" {
+		if err := validateAuditPolicy(a.Policy); err != nil {
+			return fmt.Errorf("invalid rke2.audit.policy: %w", err)
+		}
+	}
+	if a.LogPath != "" && !filepath.IsAbs(a.LogPath) {
+		return fmt.Errorf("rke2.audit.logPath must be an absolute path: %q", a.LogPath)
+	}
+	if a.LogMaxAge < 0 || a.LogMaxBackup < 0 || a.LogMaxSize < 0 {
+		return errors.New("rke2.audit.logMaxAge, logMaxBackup and logMaxSize must be positive")
+	}
+	if !a.Webhook.Enabled() {
+		return nil
+	}
+	if u, err := url.Parse(a.Webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("rke2.audit.webhook.url is not an HTTP(S) URL: %q", a.Webhook.URL)
+	}
+	if mode := a.Webhook.Mode; mode != "" && !slices.Contains(auditWebhookModes, mode) {
+		return fmt.Errorf("rke2.audit.webhook.mode must be one of %s", strings.Join(auditWebhookModes, ", "))
+	}
+	if a.Webhook.CACerts != "" {
+		pem, err := LoadPEM(a.Webhook.CACerts)
+		if err == nil {
+			err = ValidateCertificates(pem)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid rke2.audit.webhook.caCerts: %w", err)
+		}
+	}
+	return nil
+}
+
+func validateAuditPolicy(document string) error {
+	var policy auditPolicy
+	if err := yaml.Unmarshal([]byte(document), &policy); err != nil {
+		return err
+	}
+	if policy.APIVersion != auditPolicyAPIVersion || policy.Kind != auditPolicyKind {
+		return fmt.Errorf("must be an %s %s", auditPolicyAPIVersion, auditPolicyKind)
+	}
+	if len(policy.Rules) == 0 {
+		return errors.New("no rules")
+	}
+	if err := validateAuditStages(policy.OmitStages); err != nil {
+		return err
+	}
+	for i, rule := range policy.Rules {
+		if !slices.Contains(auditLevels, rule.Level) {
+			return fmt.Errorf("rules[%d].level must be one of %s", i, strings.Join(auditLevels, ", "))
+		}
+		if err := validateAuditStages(rule.OmitStages); err != nil {
+			return fmt.Errorf("rules[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateAuditStages(stages []string) error {
+	for _, stage := range stages {
+		if !slices.Contains(auditStages, stage) {
+			return fmt.Errorf("%q is not an audit stage", stage)
+		}
+	}
+	return nil
+}
+
+// GetAuditArgs returns the kube-apiserver arguments of the audit log and
+// webhook.
+func (c *HarvesterConfig) GetAuditArgs() []string {
+	audit := c.RKE2.Audit
+	var args []string
+	if audit.LogPath != "" {
+		args = append(args, "audit-log-path="+audit.LogPath)
+	}
+	for _, option := range []struct {
+		name  string
+		value int
+	}{{"audit-log-maxage", audit.LogMaxAge}, {"audit-log-maxbackup", audit.LogMaxBackup}, {"audit-log-maxsize", audit.LogMaxSize}} {
+		if option.value > 0 {
+			args = append(args, fmt.Sprintf("%s=%d", option.name, option.value))
+		}
+	}
+	if audit.Webhook.Enabled() {
+		args = append(args,
+			"audit-webhook-config-file="+auditWebhookConfigFile,
+			"audit-webhook-mode="+orDefault(audit.Webhook.Mode, defaultWebhookMode),
+		)
+	}
+	return args
+}
+
+// GetAuditExtraMounts returns the files kube-apiserver needs mounted for
+// auditing.
+func (c *HarvesterConfig) GetAuditExtraMounts() []string {
+	if !c.RKE2.Audit.Webhook.Enabled() {
+		return nil
+	}
+	return []string{auditWebhookConfigFile + ":" + auditWebhookConfigFile + ":ro"}
+}
+
+// addAuditFiles writes the audit policy, the kubeconfig of the webhook and
+// the kube-apiserver arguments for them on the nodes that may run
+// kube-apiserver, including those joining the cluster.
+func addAuditFiles(config *HarvesterConfig, stage *yipSchema.Stage) error {
+	if !runsEtcd(config.Install.Role) {
+		return nil
+	}
+	auditConfig, err := render("rke2-94-harvester-kube-audit.yaml", config)
+	if err != nil {
+		return err
+	}
+	stage.Files = append(stage.Files, yipSchema.File{
+		Path:        auditConfigFile,
+		Content:     auditConfig,
+		Permissions: 0600,
+		Owner:       0,
+		Group:       0,
+	})
+	policy := config.RKE2.Audit.Policy
+	if policy == "" {
+		if policy, err = render("rke2-92-harvester-kube-audit-policy.yaml", config); err != nil {
+			return err
+		}
+	}
+	stage.Files = append(stage.Files, yipSchema.File{
+		Path:        auditPolicyFile,
+		Content:     policy,
+		Permissions: 0600,
+		Owner:       0,
+		Group:       0,
+	})
+	if !config.RKE2.Audit.Webhook.Enabled() {
+		return nil
+	}
+	webhookConfig, err := render("rke2-audit-webhook-config.yaml", config.RKE2.Audit.Webhook)
+	if err != nil {
+		return err
+	}
+	stage.Files = append(stage.Files, yipSchema.File{
+		Path:        auditWebhookConfigFile,
+		Content:     webhookConfig,
+		Permissions: 0600,
+		Owner:       0,
+		Group:       0,
+	})
+	return nil
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+const testAuditPolicy = `apiVersion: audit.k8s.io/v1
+kind: Policy
+omitStages:
+  - RequestReceived
+rules:
+  - level: RequestResponse
+    resources:
+      - group: ""
+        resources: ["secrets"]
+  - level: Metadata
+`
+
+func TestValidateAuditConfig(t *testing.T) {
+	testCases := []struct {
+		name   string
+		audit  AuditConfig
+		errMsg string
+	}{
+		{
+			name: "policy, log and webhook",
+			audit: AuditConfig{
+				Policy:       testAuditPolicy,
+				LogPath:      "/var/log/kube-audit/audit.log",
+				LogMaxAge:    365,
+				LogMaxBackup: 100,
+				Webhook:      AuditWebhook{URL: "https://siem.example.com/audit", Mode: "blocking"},
+			},
+		},
+		{
+			name:   "not a policy",
+			audit:  AuditConfig{Policy: "apiVersion: v1\nkind: ConfigMap\n"},
+			errMsg: "invalid rke2.audit.policy: must be an audit.k8s.io/v1 Policy",
+		},
+		{
+			name:   "unknown level",
+			audit:  AuditConfig{Policy: "apiVersion: audit.k8s.io/v1\nkind: Policy\nrules:\n- level: Everything\n"},
+			errMsg: "invalid rke2.audit.policy: rules[0].level must be one of None, Metadata, Request, RequestResponse",
+		},
+		{
+			name:   "unknown stage",
+			audit:  AuditConfig{Policy: "apiVersion: audit.k8s.io/v1\nkind: Policy\nrules:\n- level: None\n  omitStages: [ResponseDone]\n"},
+			errMsg: `invalid rke2.audit.policy: rules[0]: "ResponseDone" is not an audit stage`,
+		},
+		{
+			name:   "relative log path",
+			audit:  AuditConfig{LogPath: "audit.log"},
+			errMsg: `rke2.audit.logPath must be an absolute path: "audit.log"`,
+		},
+		{
+			name:   "webhook URL",
+			audit:  AuditConfig{Webhook: AuditWebhook{URL: "siem.example.com"}},
+			errMsg: `rke2.audit.webhook.url is not an HTTP(S) URL: "siem.example.com"`,
+		},
+		{
+			name:   "webhook mode",
+			audit:  AuditConfig{Webhook: AuditWebhook{URL: "https://siem.example.com", Mode: "async"}},
+			errMsg: "rke2.audit.webhook.mode must be one of batch, blocking, blocking-strict",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateAuditConfig(tc.audit)
+			if tc.errMsg != "" {
+				assert.EqualError(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestConvertToCos_Audit(t *testing.T) {
+	conf, err := LoadHarvesterConfig(util.LoadFixture(t, "harvester-config.yaml"))
+	assert.NoError(t, err)
+	conf.ServerURL = ""
+
+	yipConfig, err := ConvertToCOS(conf)
+	assert.NoError(t, err)
+	files := map[string]string{}
+	for _, file := range yipConfig.Stages["initramfs"][0].Files {
+		files[file.Path] = file.Content
+	}
+	assert.Contains(t, files["/etc/rancher/rke2/config.yaml.d/92-harvester-kube-audit-policy.yaml"], "level: Metadata")
+	assert.Equal(t, "audit-policy-file: /etc/rancher/rke2/config.yaml.d/92-harvester-kube-audit-policy.yaml\n", files["/etc/rancher/rke2/config.yaml.d/94-harvester-kube-audit.yaml"])
+
+	ca := util.LoadFixture(t, "ca.pem")
+	conf.RKE2.Audit = AuditConfig{
+		Policy:    testAuditPolicy,
+		LogMaxAge: 365,
+		Webhook:   AuditWebhook{URL: "https://siem.example.com/audit", CACerts: string(ca)},
+	}
+	// joining servers are audited too, workers don't run kube-apiserver
+	conf.ServerURL = "https://172.16.0.10:443"
+	yipConfig, err = ConvertToCOS(conf)
+	assert.NoError(t, err)
+	files = map[string]string{}
+	for _, file := range yipConfig.Stages["initramfs"][0].Files {
+		files[file.Path] = file.Content
+	}
+	assert.Equal(t, testAuditPolicy, files["/etc/rancher/rke2/config.yaml.d/92-harvester-kube-audit-policy.yaml"])
+	assert.Equal(t, `audit-policy-file: /etc/rancher/rke2/config.yaml.d/92-harvester-kube-audit-policy.yaml
+kube-apiserver-arg+:
+- "audit-log-maxage=365"
+- "audit-webhook-config-file=/etc/rancher/rke2/audit-webhook-config.yaml"
+- "audit-webhook-mode=batch"
+kube-apiserver-extra-mount+:
+- "/etc/rancher/rke2/audit-webhook-config.yaml:/etc/rancher/rke2/audit-webhook-config.yaml:ro"
+`, files["/etc/rancher/rke2/config.yaml.d/94-harvester-kube-audit.yaml"])
+	webhookConfig := files["/etc/rancher/rke2/audit-webhook-config.yaml"]
+	assert.Contains(t, webhookConfig, `server: "https://siem.example.com/audit"`)
+	assert.Contains(t, webhookConfig, base64.StdEncoding.EncodeToString(ca))
+
+	conf.Install.Role = RoleWorker
+	yipConfig, err = ConvertToCOS(conf)
+	assert.NoError(t, err)
+	for _, file := range yipConfig.Stages["initramfs"][0].Files {
+		assert.NotContains(t, file.Path, "audit")
+	}
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	yipSchema "github.com/rancher/yip/pkg/schema"
+)
+
+const (
+	// additionalCAsDir is where the system picks up trusted CAs from, with
+	// update-ca-certificates.
+	additionalCAsDir       = "/etc/pki/trust/anchors"
+	additionalCAFileFmt    = "harvester-additional-ca-%d.pem"
+	additionalCASetting    = "additional-ca"
+	updateCACertificateCmd = "update-ca-certificates"
+)
+
+// IsCAURL tells if an entry of os.additionalCAs is the URL of certificates
+// rather than the certificates.
+func IsCAURL(value string) bool {
+	return !strings.HasPrefix(strings.TrimSpace(value), pemPrefix)
+}
+
+// ValidateCertificates checks pem holds certificates and nothing else.
+func ValidateCertificates(pem []byte) error {
+	if !strings.HasPrefix(strings.TrimSpace(string(pem)), pemPrefix) {
+		return errors.New("not PEM encoded")
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+		return errors.New("no certificates")
+	}
+	return nil
+}
+
+// ValidateAdditionalCAs checks the certificates of os.additionalCAs, and that
+// the others are URLs.
+func ValidateAdditionalCAs(cas []string) error {
+	for i, ca := range cas {
+		if IsCAURL(ca) {
+			if u, err := url.Parse(ca); err != nil || u.Scheme == "" {
+				return fmt.Errorf("os.additionalCAs[%d] is neither PEM certificates nor a URL", i)
+			}
+			continue
+		}
+		if err := ValidateCertificates([]byte(ca)); err != nil {
+			return fmt.Errorf("invalid os.additionalCAs[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// fetchedCAs returns the certificates of os.additionalCAs, leaving out the
+// URLs not fetched yet.
+func (c *HarvesterConfig) fetchedCAs() []string {
+	var cas []string
+	for _, ca := range c.OS.AdditionalCAs {
+		if !IsCAURL(ca) {
+			cas = append(cas, ca)
+		}
+	}
+	return cas
+}
+
+// InstallerTLSSettings returns the TLS settings of the requests of the
+// installer, which trust the additional CAs of the OS too.
+func (c *HarvesterConfig) InstallerTLSSettings() (TLSSettings, error) {
+	settings := c.Install.TLS
+	cas := c.fetchedCAs()
+	if len(cas) == 0 {
+		return settings, nil
+	}
+	bundle := strings.Join(cas, "\n")
+	trust := func(caCerts string) (string, error) {
+		if caCerts == "" {
+			return bundle, nil
+		}
+		pem, err := LoadPEM(caCerts)
+		if err != nil {
+			return "", err
+		}
+		return string(pem) + "\n" + bundle, nil
+	}
+
+	var err error
+	if settings.CACerts, err = trust(settings.CACerts); err != nil {
+		return settings, err
+	}
+	// endpoints replace the CAs above, keep trusting the additional ones
+	settings.Endpoints = append([]TLSEndpoint(nil), settings.Endpoints...)
+	for i := range settings.Endpoints {
+		if settings.Endpoints[i].CACerts == "" {
+			continue
+		}
+		if settings.Endpoints[i].CACerts, err = trust(settings.Endpoints[i].CACerts); err != nil {
+			return settings, err
+		}
+	}
+	return settings, nil
+}
+
+// addAdditionalCAs makes the system trust the additional CAs.
+func addAdditionalCAs(config *HarvesterConfig, stage *yipSchema.Stage) error {
+	if len(config.OS.AdditionalCAs) == 0 {
+		return nil
+	}
+	for i, ca := range config.OS.AdditionalCAs {
+		if IsCAURL(ca) {
+			return fmt.Errorf("os.additionalCAs[%d] is not fetched from %s", i, ca)
+		}
+		stage.Files = append(stage.Files, yipSchema.File{
+			Path:        filepath.Join(additionalCAsDir, fmt.Sprintf(additionalCAFileFmt, i)),
+			Content:     ca,
+			Permissions: 0644,
+			Owner:       0,
+			Group:       0,
+		})
+	}
+	stage.Commands = append(stage.Commands, updateCACertificateCmd)
+	return nil
+}
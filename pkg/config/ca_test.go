@@ -0,0 +1,85 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+func TestValidateAdditionalCAs(t *testing.T) {
+	ca := string(util.LoadFixture(t, "ca.pem"))
+	testCases := []struct {
+		name   string
+		cas    []string
+		errMsg string
+	}{
+		{
+			name: "certificates and URLs",
+			cas:  []string{ca, "https://pki.example.com/ca.pem?sha256=abc", "file:///ca.pem"},
+		},
+		{
+			name:   "not a URL",
+			cas:    []string{ca, "ca.pem"},
+			errMsg: "os.additionalCAs[1] is neither PEM certificates nor a URL",
+		},
+		{
+			name:   "no certificates",
+			cas:    []string{"-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n"},
+			errMsg: "invalid os.additionalCAs[0]: no certificates",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateAdditionalCAs(tc.cas)
+			if tc.errMsg != "" {
+				assert.EqualError(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestInstallerTLSSettings(t *testing.T) {
+	c := NewHarvesterConfig()
+	c.OS.AdditionalCAs = []string{"-----BEGIN CERTIFICATE-----\nadditional", "https://pki.example.com/ca.pem"}
+	c.Install.TLS = TLSSettings{
+		Endpoints: []TLSEndpoint{
+			{Host: "config.example.com", CACerts: "-----BEGIN CERTIFICATE-----\nconfig"},
+			{Host: "webhook.example.com", Insecure: true},
+		},
+	}
+
+	settings, err := c.InstallerTLSSettings()
+	assert.Nil(t, err)
+	assert.Equal(t, TLSSettings{
+		CACerts: "-----BEGIN CERTIFICATE-----\nadditional",
+		Endpoints: []TLSEndpoint{
+			{Host: "config.example.com", CACerts: "-----BEGIN CERTIFICATE-----\nconfig\n-----BEGIN CERTIFICATE-----\nadditional"},
+			{Host: "webhook.example.com", Insecure: true},
+		},
+	}, settings)
+	// the config is left untouched
+	assert.Equal(t, "-----BEGIN CERTIFICATE-----\nconfig", c.Install.TLS.Endpoints[0].CACerts)
+}
+
+func TestConvertToCos_AdditionalCAs(t *testing.T) {
+	conf, err := LoadHarvesterConfig(util.LoadFixture(t, "harvester-config.yaml"))
+	assert.NoError(t, err)
+	ca := string(util.LoadFixture(t, "ca.pem"))
+	conf.OS.AdditionalCAs = []string{ca}
+
+	yipConfig, err := ConvertToCOS(conf)
+	assert.NoError(t, err)
+
+	initramfs := yipConfig.Stages["initramfs"][0]
+	assert.True(t, containsFile(initramfs.Files, "/etc/pki/trust/anchors/harvester-additional-ca-0.pem"))
+	assert.Contains(t, initramfs.Commands, "update-ca-certificates")
+	assert.Equal(t, ca, conf.SystemSettings["additional-ca"])
+
+	conf.OS.AdditionalCAs = []string{"https://pki.example.com/ca.pem"}
+	_, err = ConvertToCOS(conf)
+	assert.EqualError(t, err, "os.additionalCAs[0] is not fetched from https://pki.example.com/ca.pem")
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
-	"runtime"
 	"strings"
 
 	"github.com/imdario/mergo"
@@ -99,13 +98,13 @@ type NTPSettings struct {
 
 type HTTPBasicAuth struct {
 	User     string `json:"user,omitempty"`
-	Password string `json:"password,omitempty"`
+	Password string `json:"password,omitempty" sensitive:"true"`
 }
 
 type Webhook struct {
 	Event     string              `json:"event,omitempty"`
 	Method    string              `json:"method,omitempty"`
-	Headers   map[string][]string `json:"headers,omitempty"`
+	Headers   map[string][]string `json:"headers,omitempty" sensitive:"true"`
 	URL       string              `json:"url,omitempty"`
 	Payload   string              `json:"payload,omitempty"`
 	Insecure  bool                `json:"insecure,omitempty"`
@@ -114,7 +113,7 @@ type Webhook struct {
 
 type Addon struct {
 	Enabled       bool   `json:"enabled,omitempty"`
-	ValuesContent string `json:"valuesContent,omitempty"`
+	ValuesContent string `json:"valuesContent,omitempty" template:"false"`
 }
 
 type LHDefaultSettings struct {
@@ -172,6 +171,21 @@ type Install struct {
 	WipeAllDisks  bool     `json:"wipeAllDisks,omitempty"`
 	WipeDisksList []string `json:"wipeDisksList,omitempty"`
 
+	// ConfigSHA256, ISOSHA256 and RawDiskImageSHA256 are the expected
+	// SHA-256 digests of what ConfigURL, ISOURL and RawDiskImagePath point
+	// to. They may also be given as a sha256 query parameter of the URLs.
+	ConfigSHA256       string `json:"configSha256,omitempty"`
+	ISOSHA256          string `json:"isoSha256,omitempty"`
+	RawDiskImageSHA256 string `json:"rawDiskImageSha256,omitempty"`
+	// PublicKey is a minisign or bare ed25519 public key. When it is set,
+	// or a key is built into the ISO, the config, the ISO and the raw disk
+	// image must have valid detached signatures, by default at their URLs
+	// plus ".minisig".
+	PublicKey                string `json:"publicKey,omitempty"`
+	ConfigSignatureURL       string `json:"configSignatureUrl,omitempty"`
+	ISOSignatureURL          string `json:"isoSignatureUrl,omitempty"`
+	RawDiskImageSignatureURL string `json:"rawDiskImageSignatureUrl,omitempty"`
+
 	// Following options are not cOS installer flag
 	ForceMBR bool   `json:"forceMbr,omitempty"`
 	DataDisk string `json:"dataDisk,omitempty"`
@@ -181,11 +195,18 @@ type Install struct {
 	Harvester               HarvesterChartValues `json:"harvester,omitempty"`
 	RawDiskImagePath        string               `json:"rawDiskImagePath,omitempty"`
 	PersistentPartitionSize string               `json:"persistentPartitionSize,omitempty"`
+	SecretSource            SecretSource         `json:"secretSource,omitempty"`
+	TLS                     TLSSettings          `json:"tls,omitempty"`
+	Proxy                   Proxy                `json:"proxy,omitempty"`
+
+	// SecretsRecoveryKey recovers the key of the sealed secrets if it is
+	// lost. It is only used at install and never persisted.
+	SecretsRecoveryKey string `json:"secretsRecoveryKey,omitempty" sensitive:"true"`
 }
 
 type File struct {
 	Encoding           string `json:"encoding"`
-	Content            string `json:"content"`
+	Content            string `json:"content" template:"false"`
 	Owner              string `json:"owner"`
 	Path               string `json:"path"`
 	RawFilePermissions string `json:"permissions"`
@@ -201,14 +222,45 @@ type OS struct {
 	Sysctls        map[string]string `json:"sysctls,omitempty"`
 	NTPServers     []string          `json:"ntpServers,omitempty"`
 	DNSNameservers []string          `json:"dnsNameservers,omitempty"`
-	Password       string            `json:"password,omitempty"`
+	Password       string            `json:"password,omitempty" sensitive:"true"`
 	Environment    map[string]string `json:"environment,omitempty"`
 	Labels         map[string]string `json:"labels,omitempty"`
 	SSHD           SSHDConfig        `json:"sshd,omitempty"`
 
+	// PasswordFormat tells whether Password is plain text or a crypt hash.
+	// If empty, it is guessed from the value as older versions did.
+	PasswordFormat string `json:"passwordFormat,omitempty"`
+	// PasswordHashAlgorithm is used to hash a plain text Password.
+	PasswordHashAlgorithm string `json:"passwordHashAlgorithm,omitempty"`
+
+	// Timezone is a tz database name such as Asia/Tokyo, Locale the LANG
+	// of the system and Keymap the keyboard layout of the console.
+	Timezone string `json:"timezone,omitempty"`
+	Locale   string `json:"locale,omitempty"`
+	Keymap   string `json:"keymap,omitempty"`
+
 	PersistentStatePaths      []string              `json:"persistentStatePaths,omitempty"`
 	ExternalStorage           ExternalStorageConfig `json:"externalStorageConfig,omitempty"`
 	AdditionalKernelArguments string                `json:"additionalKernelArguments,omitempty"`
+
+	// Kubelet sizes the pods and the resources reserved to the system.
+	Kubelet KubeletConfig `json:"kubelet,omitempty"`
+
+	// AdditionalCAs are PEM certificates, or URLs to fetch them from, that
+	// the node and the installer trust besides the system CAs.
+	AdditionalCAs []string `json:"additionalCAs,omitempty"`
+
+	// Taints are registered with the node, along with that of its role.
+	Taints []Taint `json:"taints,omitempty"`
+	// Annotations are set on the node once it is registered.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// KernelArguments add and remove kernel arguments, on top of the
+	// space-separated AdditionalKernelArguments.
+	KernelArguments KernelArguments `json:"kernelArguments,omitempty"`
+
+	// Kdump takes kernel crash dumps.
+	Kdump KdumpConfig `json:"kdump,omitempty"`
 }
 
 type ExternalStorageConfig struct {
@@ -311,7 +363,7 @@ type HarvesterConfig struct {
 	// Harvester will use scheme version to determine current version and migrate config to new scheme version
 	SchemeVersion               uint32   `json:"schemeVersion,omitempty"`
 	ServerURL                   string   `json:"serverUrl,omitempty"`
-	Token                       string   `json:"token,omitempty"`
+	Token                       string   `json:"token,omitempty" sensitive:"true"`
 	SANS                        []string `json:"sans,omitempty"`
 	OS                          `json:"os,omitempty"`
 	Install                     `json:"install,omitempty"`
@@ -319,9 +371,44 @@ type HarvesterConfig struct {
 	RancherVersion              string            `json:"rancherVersion,omitempty"`
 	HarvesterChartVersion       string            `json:"harvesterChartVersion,omitempty"`
 	MonitoringChartVersion      string            `json:"monitoringChartVersion,omitempty"`
-	SystemSettings              map[string]string `json:"systemSettings,omitempty"`
+	SystemSettings              map[string]string `json:"systemSettings,omitempty" sensitive:"backup-target,cluster-registration-url,containerd-registry,http-proxy,ssl-certificates"`
 	LoggingChartVersion         string            `json:"loggingChartVersion,omitempty"`
 	KubeovnOperatorChartVersion string            `json:"kubeovnChartVersion,omitempty"`
+
+	// Registries are the registry mirrors and credentials of containerd.
+	Registries Registries `json:"registries,omitempty"`
+	// RKE2 is extra configuration of RKE2, such as kube-apiserver-arg.
+	RKE2 RKE2Config `json:"rke2,omitempty"`
+	// Performance is the hugepages, CPU isolation and CPU and topology
+	// managers of the node.
+	Performance PerformanceConfig `json:"performance,omitempty"`
+	// Passthrough is the PCI devices bound to vfio-pci and the SR-IOV
+	// virtual functions of the node.
+	Passthrough PassthroughConfig `json:"passthrough,omitempty"`
+
+	// Nodes is an inventory of per-node overrides, the entry matching the
+	// node the installer runs on is applied.
+	Nodes []Node `json:"nodes,omitempty"`
+	// Templating renders the string values of the config as Go templates
+	// of the facts of the node, e.g. `hostname: hv-{{ .DMI.Serial | lower }}`.
+	// Values are taken literally unless it is set.
+	Templating bool `json:"templating,omitempty"`
+
+	// Include lists the URLs or files of configs this one is overlaid on,
+	// in the order they are applied. URLs are fetched like the config URL,
+	// so file:// ones are looked for on the block devices, while paths are
+	// files of the system the config is loaded on.
+	Include []string `json:"include,omitempty"`
+	// MergeStrategies sets how fields are merged with other configs, keyed
+	// by the path of their JSON keys.
+	MergeStrategies map[string]string `json:"mergeStrategies,omitempty"`
+
+	// SecretReferences maps config paths to the secret references their
+	// values were resolved from. It is never persisted.
+	SecretReferences map[string]string `json:"-" yaml:"-"`
+	// Provenance records where the values of the config came from. It is
+	// persisted along with the config for `harvester-installer explain`.
+	Provenance Provenance `json:"-" yaml:"provenance,omitempty"`
 }
 
 func NewHarvesterConfig() *HarvesterConfig {
@@ -337,17 +424,10 @@ func (c *HarvesterConfig) DeepCopy() (*HarvesterConfig, error) {
 }
 
 func (c *HarvesterConfig) sanitized() (*HarvesterConfig, error) {
-	copied, err := c.DeepCopy()
-	if err != nil {
-		return nil, err
-	}
-	if copied.Password != "" {
-		copied.Password = SanitizeMask
-	}
-	if copied.Token != "" {
-		copied.Token = SanitizeMask
-	}
-	return copied, nil
+	copied := Redact(*c)
+	// provenance has a say on every value, it would drown them in logs
+	copied.Provenance = nil
+	return &copied, nil
 }
 
 func (c *HarvesterConfig) String() string {
@@ -376,7 +456,7 @@ func (c *HarvesterConfig) GetKubeletArgs() ([]string, error) {
 	}
 
 	var args = []string{
-		fmt.Sprintf("max-pods=%d", MaxPods),
+		fmt.Sprintf("max-pods=%d", c.maxPods()),
 	}
 
 	if len(labelStrs) > 0 {
@@ -385,21 +465,34 @@ func (c *HarvesterConfig) GetKubeletArgs() ([]string, error) {
 		)
 	}
 
-	if c.Role == RoleWitness {
-		args = append(args, "--register-with-taints=node-role.kubernetes.io/etcd=true:NoExecute")
+	args = append(args, c.performanceKubeletArgs()...)
+
+	if err := ValidateTaints("os.taints", c.OS.Taints); err != nil {
+		return nil, err
+	}
+	if taints := c.taints(); len(taints) > 0 {
+		taintStrs := make([]string, 0, len(taints))
+		for _, taint := range taints {
+			taintStrs = append(taintStrs, taint.String())
+		}
+		args = append(args, "--register-with-taints="+strings.Join(taintStrs, ","))
 	}
 
 	return args, nil
 }
 
-// make system:kube cpu reservation ration 2:3
+// make system:kube cpu and memory reservation ratio 2:3
 func (c *HarvesterConfig) GetSystemReserved() string {
-	return fmt.Sprintf("system-reserved=cpu=%dm", calculateCPUReservedInMilliCPU(runtime.NumCPU(), MaxPods)*2*2/5)
+	return reservedArg("system-reserved", c.OS.Kubelet.SystemReserved,
+		calculateCPUReservedInMilliCPU(nodeCPUs(), c.maxPods())*2*2/5,
+		calculateMemoryReservedInMiB(nodeMemoryMiB())*2/5)
 }
 
-// make system:kube cpu reservation ration 2:3
+// make system:kube cpu and memory reservation ratio 2:3
 func (c *HarvesterConfig) GetKubeReserved() string {
-	return fmt.Sprintf("kube-reserved=cpu=%dm", calculateCPUReservedInMilliCPU(runtime.NumCPU(), MaxPods)*2*3/5)
+	return reservedArg("kube-reserved", c.OS.Kubelet.KubeReserved,
+		calculateCPUReservedInMilliCPU(nodeCPUs(), c.maxPods())*2*3/5,
+		calculateMemoryReservedInMiB(nodeMemoryMiB())*3/5)
 }
 
 func (c HarvesterConfig) ShouldCreateDataPartitionOnOsDisk() bool {
@@ -426,14 +519,6 @@ func (c HarvesterConfig) ShouldMountDataPartition() bool {
 	return true
 }
 
-func (c *HarvesterConfig) Merge(other HarvesterConfig) error {
-	if err := mergo.Merge(c, other, mergo.WithAppendSlice); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func (n *NetworkInterface) FindNetworkInterfaceNameAndHwAddr() error {
 	if err := n.FindNetworkInterfaceName(); err != nil {
 		return err
@@ -499,14 +499,14 @@ func TestHarvesterReservedResourcesConfigRendering(t *testing.T) {
 
 	err = yaml.Unmarshal([]byte(content), &loadedConf)
 	assert.NoError(t, err)
-	assert.Equal(t, 2, len(loadedConf["kubelet-arg+"]))
+	assert.Equal(t, 3, len(loadedConf["kubelet-arg+"]))
 
 	systemReserved := loadedConf["kubelet-arg+"][0]
 	assert.True(t, strings.HasPrefix(systemReserved, "system-reserved=cpu="),
 		fmt.Sprintf("%s doesn't started with system-reserved=cpu=", systemReserved))
 	systemReservedArray := strings.Split(systemReserved, "system-reserved=cpu=")
 	assert.Equal(t, 2, len(systemReservedArray))
-	systemCPUReserved, err := strconv.Atoi(strings.Replace(systemReservedArray[1], "m", "", 1))
+	systemCPUReserved, err := strconv.Atoi(strings.Replace(strings.Split(systemReservedArray[1], ",")[0], "m", "", 1))
 	assert.NoError(t, err)
 
 	kubeReserved := loadedConf["kubelet-arg+"][1]
@@ -514,10 +514,11 @@ func TestHarvesterReservedResourcesConfigRendering(t *testing.T) {
 		fmt.Sprintf("%s doesn't started with kube-reserved=cpu=", kubeReserved))
 	kubeReservedArray := strings.Split(kubeReserved, "kube-reserved=cpu=")
 	assert.Equal(t, 2, len(kubeReservedArray))
-	kubeCPUReserved, err := strconv.Atoi(strings.Replace(kubeReservedArray[1], "m", "", 1))
+	kubeCPUReserved, err := strconv.Atoi(strings.Replace(strings.Split(kubeReservedArray[1], ",")[0], "m", "", 1))
 	assert.NoError(t, err)
 
 	assert.Equal(t, systemCPUReserved, kubeCPUReserved*2/3)
+	assert.True(t, strings.HasPrefix(loadedConf["kubelet-arg+"][2], "eviction-hard="))
 }
 
 func TestHarvesterAddonsFileRendering(t *testing.T) {
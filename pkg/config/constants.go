@@ -20,6 +20,13 @@ const (
 
 	RancherdConfigFile = "/etc/rancher/rancherd/config.yaml"
 
+	// TokenAuto asks the installer to generate a random cluster token in
+	// create mode.
+	TokenAuto = "auto"
+
+	PasswordFormatPlaintext = "plaintext"
+	PasswordFormatHash      = "hash"
+
 	DefaultCosOemSizeMiB      = 50
 	DefaultCosStateSizeMiB    = 15360
 	DefaultCosRecoverySizeMiB = 8192
@@ -156,6 +156,12 @@ func ConvertToCOS(config *HarvesterConfig) (*yipSchema.YipConfig, error) {
 	// the cpu-manager-policy to "static" before reboot, this mismatch can prevent kubelet from starting,
 	// and make the entire node unavailable.
 	initramfs.Commands = append(initramfs.Commands, "rm -f /var/lib/kubelet/cpu_manager_state")
+	addNUMAHugepages(cfg, &initramfs)
+	addPassthroughCommands(cfg, &initramfs)
+	if err := addKdumpConfig(cfg, &initramfs); err != nil {
+		return nil, err
+	}
+	addLocalization(cfg, &initramfs)
 
 	initramfs.Sysctl = cfg.OS.Sysctls
 	initramfs.Environment = cfg.OS.Environment
@@ -176,6 +182,10 @@ func ConvertToCOS(config *HarvesterConfig) (*yipSchema.YipConfig, error) {
 		})
 	}
 
+	if err := addAdditionalCAs(cfg, &initramfs); err != nil {
+		return nil, err
+	}
+
 	// enable multipathd for external storage support
 	if err := setupExternalStorage(config, &initramfs); err != nil {
 		return nil, err
@@ -280,7 +290,24 @@ func overwriteRootfsStage(config *HarvesterConfig, stage *yipSchema.Stage) error
 	return nil
 }
 
+// setDefaultSystemSetting sets a system setting unless it is set already.
+func (c *HarvesterConfig) setDefaultSystemSetting(name, value string) {
+	if c.SystemSettings[name] != "" {
+		return
+	}
+	// the settings may be shared with other configs, set a copy
+	settings := make(map[string]string, len(c.SystemSettings)+1)
+	for name, value := range c.SystemSettings {
+		settings[name] = value
+	}
+	settings[name] = value
+	c.SystemSettings = settings
+}
+
 func setConfigDefaultValues(config *HarvesterConfig) {
+	before := config.Clone()
+	defer config.RecordChanges(before, SourceDefault)
+
 	if config.RuntimeVersion == "" {
 		config.RuntimeVersion = RKE2Version
 	}
@@ -319,6 +346,16 @@ func setConfigDefaultValues(config *HarvesterConfig) {
 		*config.Harvester.Longhorn.DefaultSettings.GuaranteedInstanceManagerCPU = defaultGuaranteedInstanceManagerCPU
 	}
 
+	if config.Install.Proxy.Enabled() {
+		config.setDefaultSystemSetting(httpProxySetting, config.proxySetting())
+	}
+	if cas := config.fetchedCAs(); config.Install.Mode == ModeCreate && len(cas) > 0 {
+		config.setDefaultSystemSetting(additionalCASetting, strings.Join(cas, "\n"))
+	}
+	if config.Registries.Enabled() {
+		config.setDefaultSystemSetting(containerdRegistry, config.Registries.ContainerdRegistrySetting())
+	}
+
 	if config.Harvester.Longhorn.DefaultSettings.StorageReservedPercentageForDefaultDisk != nil {
 		if *config.Harvester.Longhorn.DefaultSettings.StorageReservedPercentageForDefaultDisk > maxStorageReservedPercentageForDefaultDisk {
 			*config.Harvester.Longhorn.DefaultSettings.StorageReservedPercentageForDefaultDisk = maxStorageReservedPercentageForDefaultDisk
@@ -406,19 +443,9 @@ func initRancherdStage(config *HarvesterConfig, stage *yipSchema.Stage) error {
 	)
 
 	// RKE2 settings of kube-audit
-	rke2KubeAuditConfig, err := render("rke2-92-harvester-kube-audit-policy.yaml", config)
-	if err != nil {
+	if err := addAuditFiles(config, stage); err != nil {
 		return err
 	}
-	stage.Files = append(stage.Files,
-		yipSchema.File{
-			Path:        "/etc/rancher/rke2/config.yaml.d/92-harvester-kube-audit-policy.yaml",
-			Content:     rke2KubeAuditConfig,
-			Permissions: 0600,
-			Owner:       0,
-			Group:       0,
-		},
-	)
 
 	rke2AgentConfig, err := render("rke2-90-harvester-agent.yaml", config)
 	if err != nil {
@@ -469,7 +496,23 @@ func initRancherdStage(config *HarvesterConfig, stage *yipSchema.Stage) error {
 		},
 	)
 
-	return nil
+	if err := addNodeAnnotations(config, stage); err != nil {
+		return err
+	}
+
+	if err := addEtcdSnapshotsConfig(config, stage); err != nil {
+		return err
+	}
+
+	if err := addRKE2UserConfig(config, stage); err != nil {
+		return err
+	}
+
+	if err := addRegistriesFiles(config, stage); err != nil {
+		return err
+	}
+
+	return addProxyDropIns(config, stage)
 }
 
 // RestoreOriginalNetworkConfig restores the previous state of network
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	yipSchema "github.com/rancher/yip/pkg/schema"
+)
+
+const (
+	etcdSnapshotsFile           = "/etc/rancher/rke2/config.yaml.d/93-harvester-etcd-snapshots.yaml"
+	etcdS3CAFile                = "/etc/rancher/rke2/etcd-s3-ca.pem"
+	defaultEtcdSnapshotSchedule = "0 */12 * * *"
+	defaultEtcdSnapshotRetain   = 5
+	// dataPartitionMountPoint isn't mounted on witness nodes.
+	dataPartitionMountPoint = "/var/lib/harvester"
+)
+
+// EtcdSnapshots is the policy of the etcd snapshots RKE2 takes on the nodes
+// running etcd, from their first boot.
+type EtcdSnapshots struct {
+	// Disabled stops RKE2 from taking scheduled snapshots.
+	Disabled bool `json:"disabled,omitempty"`
+	// ScheduleCron is when snapshots are taken, every 12 hours if unset.
+	ScheduleCron string `json:"scheduleCron,omitempty"`
+	// Retention is the number of snapshots kept, 5 if unset.
+	Retention int `json:"retention,omitempty"`
+	// Dir is where snapshots are saved on the node, ${data-dir}/db/snapshots
+	// if unset.
+	Dir string         `json:"dir,omitempty"`
+	S3  EtcdSnapshotS3 `json:"s3,omitempty"`
+}
+
+// EtcdSnapshotS3 is an S3-compatible target snapshots are uploaded to.
+type EtcdSnapshotS3 struct {
+	Endpoint string `json:"endpoint,omitempty"`
+	// EndpointCA is PEM text or the path of a PEM file.
+	EndpointCA    string `json:"endpointCa,omitempty"`
+	SkipSSLVerify bool   `json:"skipSslVerify,omitempty"`
+	// Insecure uploads over plain HTTP.
+	Insecure  bool   `json:"insecure,omitempty"`
+	AccessKey string `json:"accessKey,omitempty"`
+	SecretKey string `json:"secretKey,omitempty" sensitive:"true"`
+	Bucket    string `json:"bucket,omitempty"`
+	Region    string `json:"region,omitempty"`
+	Folder    string `json:"folder,omitempty"`
+}
+
+// Enabled tells if snapshots are uploaded to S3.
+func (s EtcdSnapshotS3) Enabled() bool {
+	return s.Bucket != ""
+}
+
+// CAFile returns where the CA certificates of the endpoint go on the node.
+func (s EtcdSnapshotS3) CAFile() string {
+	if s.EndpointCA == "" {
+		return ""
+	}
+	return etcdS3CAFile
+}
+
+// GetScheduleCron returns when snapshots are taken.
+func (s EtcdSnapshots) GetScheduleCron() string {
+	return orDefault(s.ScheduleCron, defaultEtcdSnapshotSchedule)
+}
+
+// GetRetention returns the number of snapshots kept.
+func (s EtcdSnapshots) GetRetention() int {
+	if s.Retention > 0 {
+		return s.Retention
+	}
+	return defaultEtcdSnapshotRetain
+}
+
+// runsEtcd tells if the node may run etcd, now or once promoted.
+func runsEtcd(role string) bool {
+	return role != RoleWorker
+}
+
+// ValidateEtcdSnapshots checks the snapshot policy, and that a witness node,
+// which has a vote in etcd but no data partition, still takes snapshots.
+func ValidateEtcdSnapshots(s EtcdSnapshots, role string) error {
+	if cron := s.ScheduleCron; cron != "" && !strings.HasPrefix(cron, "@") && len(strings.Fields(cron)) != 5 {
+		return fmt.Errorf("rke2.etcdSnapshots.scheduleCron is not a cron expression: %q", cron)
+	}
+	if s.Retention < 0 {
+		return errors.New("rke2.etcdSnapshots.retention must be positive")
+	}
+	if s.Dir != "" && !filepath.IsAbs(s.Dir) {
+		return fmt.Errorf("rke2.etcdSnapshots.dir must be an absolute path: %q", s.Dir)
+	}
+	if err := validateEtcdSnapshotS3(s.S3); err != nil {
+		return err
+	}
+	if role != RoleWitness {
+		return nil
+	}
+	if s.Disabled {
+		return errors.New("rke2.etcdSnapshots can't be disabled on witness nodes")
+	}
+	if dir := filepath.Clean(s.Dir); s.Dir != "" && (dir == dataPartitionMountPoint || strings.HasPrefix(dir, dataPartitionMountPoint+"/")) {
+		return fmt.Errorf("rke2.etcdSnapshots.dir can't be on the data partition of witness nodes: %q", s.Dir)
+	}
+	return nil
+}
+
+func validateEtcdSnapshotS3(s EtcdSnapshotS3) error {
+	if !s.Enabled() {
+		if s != (EtcdSnapshotS3{}) {
+			return errors.New("rke2.etcdSnapshots.s3 has no bucket")
+		}
+		return nil
+	}
+	if s.Endpoint == "" {
+		return errors.New("rke2.etcdSnapshots.s3 has no endpoint")
+	}
+	if strings.Contains(s.Endpoint, "://") {
+		return fmt.Errorf("rke2.etcdSnapshots.s3.endpoint must be a host[:port]: %q", s.Endpoint)
+	}
+	if (s.AccessKey == "") != (s.SecretKey == "") {
+		return errors.New("rke2.etcdSnapshots.s3 needs both an access key and a secret key")
+	}
+	if s.EndpointCA != "" {
+		pem, err := LoadPEM(s.EndpointCA)
+		if err == nil {
+			err = ValidateCertificates(pem)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid rke2.etcdSnapshots.s3.endpointCa: %w", err)
+		}
+	}
+	return nil
+}
+
+// addEtcdSnapshotsConfig writes the snapshot policy of the nodes that may run
+// etcd, and the CA certificates of its S3 endpoint.
+func addEtcdSnapshotsConfig(config *HarvesterConfig, stage *yipSchema.Stage) error {
+	if !runsEtcd(config.Install.Role) {
+		return nil
+	}
+	snapshots := config.RKE2.EtcdSnapshots
+	content, err := render("rke2-93-harvester-etcd-snapshots.yaml", snapshots)
+	if err != nil {
+		return err
+	}
+	stage.Files = append(stage.Files, yipSchema.File{
+		Path:        etcdSnapshotsFile,
+		Content:     content,
+		Permissions: 0600,
+		Owner:       0,
+		Group:       0,
+	})
+	if snapshots.S3.EndpointCA == "" {
+		return nil
+	}
+	pem, err := LoadPEM(snapshots.S3.EndpointCA)
+	if err != nil {
+		return err
+	}
+	stage.Files = append(stage.Files, yipSchema.File{
+		Path:        snapshots.S3.CAFile(),
+		Content:     string(pem),
+		Permissions: 0644,
+		Owner:       0,
+		Group:       0,
+	})
+	return nil
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+func TestValidateEtcdSnapshots(t *testing.T) {
+	testCases := []struct {
+		name      string
+		snapshots EtcdSnapshots
+		role      string
+		errMsg    string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "schedule, retention and S3",
+			snapshots: EtcdSnapshots{
+				ScheduleCron: "0 */6 * * *",
+				Retention:    10,
+				Dir:          "/var/lib/rancher/rke2/server/db/snapshots",
+				S3: EtcdSnapshotS3{
+					Endpoint:  "minio.example.com:9000",
+					Bucket:    "etcd",
+					AccessKey: "harvester",
+					SecretKey: "secret",
+				},
+			},
+			role: RoleWitness,
+		},
+		{
+			name:      "not a cron expression",
+			snapshots: EtcdSnapshots{ScheduleCron: "every 6 hours"},
+			errMsg:    `rke2.etcdSnapshots.scheduleCron is not a cron expression: "every 6 hours"`,
+		},
+		{
+			name:      "relative dir",
+			snapshots: EtcdSnapshots{Dir: "snapshots"},
+			errMsg:    `rke2.etcdSnapshots.dir must be an absolute path: "snapshots"`,
+		},
+		{
+			name:      "S3 without bucket",
+			snapshots: EtcdSnapshots{S3: EtcdSnapshotS3{Endpoint: "minio.example.com:9000"}},
+			errMsg:    "rke2.etcdSnapshots.s3 has no bucket",
+		},
+		{
+			name:      "S3 endpoint URL",
+			snapshots: EtcdSnapshots{S3: EtcdSnapshotS3{Endpoint: "https://minio.example.com", Bucket: "etcd"}},
+			errMsg:    `rke2.etcdSnapshots.s3.endpoint must be a host[:port]: "https://minio.example.com"`,
+		},
+		{
+			name:      "S3 access key only",
+			snapshots: EtcdSnapshots{S3: EtcdSnapshotS3{Endpoint: "minio.example.com", Bucket: "etcd", AccessKey: "harvester"}},
+			errMsg:    "rke2.etcdSnapshots.s3 needs both an access key and a secret key",
+		},
+		{
+			name:      "disabled on workers",
+			snapshots: EtcdSnapshots{Disabled: true},
+			role:      RoleWorker,
+		},
+		{
+			name:      "disabled on witness",
+			snapshots: EtcdSnapshots{Disabled: true},
+			role:      RoleWitness,
+			errMsg:    "rke2.etcdSnapshots can't be disabled on witness nodes",
+		},
+		{
+			name:      "data partition on witness",
+			snapshots: EtcdSnapshots{Dir: "/var/lib/harvester/etcd"},
+			role:      RoleWitness,
+			errMsg:    `rke2.etcdSnapshots.dir can't be on the data partition of witness nodes: "/var/lib/harvester/etcd"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateEtcdSnapshots(tc.snapshots, tc.role)
+			if tc.errMsg != "" {
+				assert.EqualError(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestConvertToCos_EtcdSnapshots(t *testing.T) {
+	conf, err := LoadHarvesterConfig(util.LoadFixture(t, "harvester-config.yaml"))
+	assert.NoError(t, err)
+	ca := string(util.LoadFixture(t, "ca.pem"))
+	conf.RKE2.EtcdSnapshots = EtcdSnapshots{
+		Retention: 10,
+		S3: EtcdSnapshotS3{
+			Endpoint:   "minio.example.com:9000",
+			EndpointCA: ca,
+			Bucket:     "etcd",
+			Folder:     "harvester",
+			AccessKey:  "harvester",
+			SecretKey:  "secret",
+		},
+	}
+
+	yipConfig, err := ConvertToCOS(conf)
+	assert.NoError(t, err)
+	files := map[string]string{}
+	for _, file := range yipConfig.Stages["initramfs"][0].Files {
+		files[file.Path] = file.Content
+	}
+	assert.Equal(t, `etcd-snapshot-schedule-cron: "0 */12 * * *"
+etcd-snapshot-retention: 10
+etcd-s3: true
+etcd-s3-endpoint: "minio.example.com:9000"
+etcd-s3-bucket: "etcd"
+etcd-s3-folder: "harvester"
+etcd-s3-access-key: "harvester"
+etcd-s3-secret-key: "secret"
+etcd-s3-endpoint-ca: "/etc/rancher/rke2/etcd-s3-ca.pem"
+`, files["/etc/rancher/rke2/config.yaml.d/93-harvester-etcd-snapshots.yaml"])
+	assert.Equal(t, ca, files["/etc/rancher/rke2/etcd-s3-ca.pem"])
+
+	// workers never run etcd
+	conf.Install.Role = RoleWorker
+	yipConfig, err = ConvertToCOS(conf)
+	assert.NoError(t, err)
+	assert.False(t, containsFile(yipConfig.Stages["initramfs"][0].Files, "/etc/rancher/rke2/config.yaml.d/93-harvester-etcd-snapshots.yaml"))
+}
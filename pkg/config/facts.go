@@ -0,0 +1,147 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+// NodeFacts are what is discovered about the node the installer runs on.
+// Node inventory entries are matched by them, and string config values may
+// refer to them as Go templates if templating is set, e.g.
+// `hostname: hv-{{ .DMI.Serial | lower }}`.
+type NodeFacts struct {
+	// Hostname is the hostname the node got from DHCP, if any.
+	Hostname string
+	// MACAddr, IPAddrV4 and IPAddrV6 are the addresses of the management
+	// interface, once it is up.
+	MACAddr  string
+	IPAddrV4 string
+	IPAddrV6 string
+	// NICs maps the names of the network interfaces to their MAC addresses.
+	NICs map[string]string
+	// MgmtHwAddrs are the MAC addresses of the NICs of the management
+	// interface.
+	MgmtHwAddrs []string
+	DMI         DMIFacts
+	// Disks maps the serials of the disks to their device paths.
+	Disks map[string]string
+}
+
+// DMIFacts are the system information of the node reported by the firmware.
+type DMIFacts struct {
+	Serial      string
+	ProductName string
+	UUID        string
+}
+
+// templateTag set to "false" keeps a field from being rendered as a template,
+// for contents that may well contain templates of their own.
+const templateTag = "template"
+
+var webhooksType = reflect.TypeOf([]Webhook{})
+
+// RenderTemplates renders the string values of the config that contain Go
+// templates with the node facts, if templating is set. Sensitive values are
+// left alone, as are webhooks, which are rendered with their own context,
+// and fields tagged `template:"false"`.
+func (c *HarvesterConfig) RenderTemplates(facts NodeFacts) error {
+	if !c.Templating {
+		return nil
+	}
+	return renderTemplates(reflect.ValueOf(c).Elem(), "", "", facts)
+}
+
+func renderTemplate(s string, facts NodeFacts) (string, error) {
+	tmpl, err := template.New("").Funcs(util.TemplateFuncs).Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, facts); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func renderTemplates(v reflect.Value, path, sensitive string, facts NodeFacts) error {
+	if sensitive == "true" {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		if !strings.Contains(v.String(), "{{") {
+			return nil
+		}
+		rendered, err := renderTemplate(v.String(), facts)
+		if err != nil {
+			return fmt.Errorf("fail to render %s: %w", path, err)
+		}
+		v.SetString(rendered)
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Interface {
+			// values in interfaces aren't settable, render a copy
+			elem := reflect.New(v.Elem().Type()).Elem()
+			elem.Set(v.Elem())
+			if err := renderTemplates(elem, path, "", facts); err != nil {
+				return err
+			}
+			v.Set(elem)
+			return nil
+		}
+		return renderTemplates(v.Elem(), path, "", facts)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name := jsonName(field)
+			if !field.IsExported() || name == "-" || field.Type == provenanceType || field.Type == webhooksType || field.Tag.Get(templateTag) == "false" {
+				continue
+			}
+			if err := renderTemplates(v.Field(i), joinPath(path, name), field.Tag.Get(sensitiveTag), facts); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		// the list may be shared with other configs, render into a new one
+		rendered := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(rendered, v)
+		for i := 0; i < rendered.Len(); i++ {
+			if err := renderTemplates(rendered.Index(i), fmt.Sprintf("%s[%d]", path, i), "", facts); err != nil {
+				return err
+			}
+		}
+		v.Set(rendered)
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		var keys []string
+		if sensitive != "" {
+			keys = strings.Split(sensitive, ",")
+		}
+		// the map may be shared with other configs, render into a new one
+		rendered := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			if k := iter.Key(); k.Kind() != reflect.String || !util.StringSliceContains(keys, k.String()) {
+				if err := renderTemplates(elem, fmt.Sprintf("%s[%v]", path, k), "", facts); err != nil {
+					return err
+				}
+			}
+			rendered.SetMapIndex(iter.Key(), elem)
+		}
+		v.Set(rendered)
+	}
+	return nil
+}
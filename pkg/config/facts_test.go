@@ -0,0 +1,68 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvesterConfig_RenderTemplates(t *testing.T) {
+	facts := NodeFacts{
+		Hostname: "dhcp-host",
+		IPAddrV4: "10.0.0.11",
+		NICs:     map[string]string{"ens3": "52:54:00:ab:cd:01"},
+		DMI:      DMIFacts{Serial: "SN0001", ProductName: "ProLiant DL360 Gen10"},
+		Disks:    map[string]string{"DISK0001": "/dev/sda"},
+	}
+
+	c := NewHarvesterConfig()
+	c.Templating = true
+	c.OS.Hostname = `hv-{{ .DMI.Serial | lower }}`
+	c.OS.Labels = map[string]string{
+		"model": `{{ .DMI.ProductName | replace " " "-" }}`,
+		"mac":   `{{ index .NICs "ens3" }}`,
+		"site":  "dc1",
+	}
+	c.OS.NTPServers = []string{"ntp-{{ .IPAddrV4 }}.example.com"}
+	c.OS.Password = "{{ not a template }}"
+	c.OS.WriteFiles = []File{{Path: "/etc/motd", Content: "{{ .Unknown }}"}}
+	c.Install.Addons = map[string]Addon{"rancher-monitoring": {ValuesContent: "{{ .Values }}"}}
+	c.Webhooks = []Webhook{{URL: "http://example.com/{{ .Hostname }}"}}
+	sharedLabels := c.OS.Labels
+
+	assert.Nil(t, c.RenderTemplates(facts))
+	assert.Equal(t, "hv-sn0001", c.OS.Hostname)
+	assert.Equal(t, map[string]string{
+		"model": "ProLiant-DL360-Gen10",
+		"mac":   "52:54:00:ab:cd:01",
+		"site":  "dc1",
+	}, c.OS.Labels)
+	assert.Equal(t, []string{"ntp-10.0.0.11.example.com"}, c.OS.NTPServers)
+	// sensitive values, file contents, addon values and webhooks are left alone
+	assert.Equal(t, "{{ not a template }}", c.OS.Password)
+	assert.Equal(t, "{{ .Unknown }}", c.OS.WriteFiles[0].Content)
+	assert.Equal(t, "{{ .Values }}", c.Install.Addons["rancher-monitoring"].ValuesContent)
+	assert.Equal(t, "http://example.com/{{ .Hostname }}", c.Webhooks[0].URL)
+	// maps shared with other configs aren't modified
+	assert.Equal(t, `{{ index .NICs "ens3" }}`, sharedLabels["mac"])
+}
+
+func TestHarvesterConfig_RenderTemplatesError(t *testing.T) {
+	c := NewHarvesterConfig()
+	c.Templating = true
+	c.OS.Hostname = "hv-{{ .Serial }}"
+	assert.ErrorContains(t, c.RenderTemplates(NodeFacts{}), "fail to render os.hostname")
+
+	c.OS.Hostname = "hv-{{ .DMI.Serial"
+	assert.ErrorContains(t, c.RenderTemplates(NodeFacts{}), "fail to render os.hostname")
+}
+
+func TestHarvesterConfig_RenderTemplatesDisabled(t *testing.T) {
+	c := NewHarvesterConfig()
+	c.OS.Hostname = "hv-{{ .DMI.Serial }}"
+	c.OS.Labels = map[string]string{"note": "{{ not a template"}
+	// values are literal unless templating is set
+	assert.Nil(t, c.RenderTemplates(NodeFacts{DMI: DMIFacts{Serial: "SN0001"}}))
+	assert.Equal(t, "hv-{{ .DMI.Serial }}", c.OS.Hostname)
+	assert.Equal(t, "{{ not a template", c.OS.Labels["note"])
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const maxIncludeDepth = 8
+
+// ConfigFetcher fetches the config at a URL, as the config URL of the
+// installation is: file:// URLs are looked for on the block devices.
+type ConfigFetcher func(url string) ([]byte, error)
+
+// ApplyIncludes overlays the configs listed in Include one after another,
+// then overlays c itself on the result. Included configs may include others
+// in turn. Relative includes are resolved against location, the URL or
+// file c was loaded from, if any.
+func (c *HarvesterConfig) ApplyIncludes(location string, fetch ConfigFetcher) error {
+	var chain []string
+	if location != "" {
+		chain = append(chain, location)
+	}
+	return c.applyIncludes(location, fetch, chain)
+}
+
+func (c *HarvesterConfig) applyIncludes(location string, fetch ConfigFetcher, chain []string) error {
+	if len(c.Include) == 0 {
+		return nil
+	}
+	if len(chain) > maxIncludeDepth {
+		return fmt.Errorf("includes are nested deeper than %d levels: %s", maxIncludeDepth, strings.Join(chain, " -> "))
+	}
+
+	result := NewHarvesterConfig()
+	for _, include := range c.Include {
+		ref, err := resolveInclude(location, include)
+		if err != nil {
+			return err
+		}
+		for _, parent := range chain {
+			if parent == ref {
+				return fmt.Errorf("include cycle: %s -> %s", strings.Join(chain, " -> "), ref)
+			}
+		}
+		data, err := readInclude(ref, fetch)
+		if err != nil {
+			return fmt.Errorf("fail to read include %s: %w", ref, err)
+		}
+		included, err := LoadHarvesterConfig(data)
+		if err != nil {
+			return fmt.Errorf("fail to load include %s: %w", ref, err)
+		}
+		included.SetSource("", SourceInclude(ref))
+		if err := included.applyIncludes(ref, fetch, append(chain[:len(chain):len(chain)], ref)); err != nil {
+			return err
+		}
+		if err := result.Overlay(*included); err != nil {
+			return fmt.Errorf("fail to merge include %s: %w", ref, err)
+		}
+	}
+
+	self := *c
+	self.Include = nil
+	if err := result.Overlay(self); err != nil {
+		return err
+	}
+	result.Include = nil
+	*c = *result
+	return nil
+}
+
+// isURLInclude tells if the include is a URL to fetch, rather than a file of
+// the system the config is loaded on.
+func isURLInclude(ref string) bool {
+	return strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") || strings.HasPrefix(ref, "file://")
+}
+
+func resolveInclude(location, include string) (string, error) {
+	if include == "" {
+		return "", fmt.Errorf("empty include")
+	}
+	if isURLInclude(include) || filepath.IsAbs(include) {
+		return include, nil
+	}
+	switch {
+	case location == "":
+		return "", fmt.Errorf("relative include %s needs to be in a config loaded from a URL or file", include)
+	case isURLInclude(location):
+		base, err := url.Parse(location)
+		if err != nil {
+			return "", err
+		}
+		rel, err := url.Parse(include)
+		if err != nil {
+			return "", err
+		}
+		return base.ResolveReference(rel).String(), nil
+	default:
+		return filepath.Join(filepath.Dir(location), include), nil
+	}
+}
+
+// readInclude fetches a URL include, so that file:// means the same in
+// includes as in the config URL, and reads a path include from the system.
+func readInclude(ref string, fetch ConfigFetcher) ([]byte, error) {
+	if isURLInclude(ref) {
+		if fetch == nil {
+			return nil, fmt.Errorf("fetching configs from URLs is not supported here")
+		}
+		return fetch(ref)
+	}
+	return os.ReadFile(ref)
+}
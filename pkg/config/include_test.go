@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeConfigFetcher(configs map[string]string) ConfigFetcher {
+	return func(url string) ([]byte, error) {
+		if config, ok := configs[url]; ok {
+			return []byte(config), nil
+		}
+		return nil, fmt.Errorf("got 404 status code from %s", url)
+	}
+}
+
+func TestHarvesterConfig_ApplyIncludes(t *testing.T) {
+	dir := t.TempDir()
+	siteFile := filepath.Join(dir, "site.yaml")
+	require.NoError(t, os.WriteFile(siteFile, []byte(`
+os:
+  ntpServers:
+  - ntp1.example.com
+  dnsNameservers:
+  - 10.0.0.1
+  labels:
+    site: berlin
+install:
+  vipMode: static
+`), 0600))
+
+	fetch := fakeConfigFetcher(map[string]string{
+		"https://config.example.com/racks/r1.yaml": fmt.Sprintf(`
+include:
+- %s
+os:
+  ntpServers:
+  - ntp2.example.com
+  labels:
+    rack: r1
+mergeStrategies:
+  os.dnsNameservers: replace
+`, siteFile),
+	})
+
+	conf, err := LoadHarvesterConfig([]byte(`
+include:
+- racks/r1.yaml
+os:
+  hostname: node1
+  dnsNameservers:
+  - 10.0.1.1
+  labels:
+    rack: r1-override
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ApplyIncludes("https://config.example.com/node1.yaml", fetch))
+
+	assert.Empty(t, conf.Include)
+	assert.Equal(t, "node1", conf.Hostname)
+	assert.Equal(t, "static", conf.VipMode)
+	assert.Equal(t, []string{"ntp1.example.com", "ntp2.example.com"}, conf.NTPServers)
+	assert.Equal(t, []string{"10.0.1.1"}, conf.DNSNameservers)
+	assert.Equal(t, map[string]string{"site": "berlin", "rack": "r1-override"}, conf.Labels)
+}
+
+func TestHarvesterConfig_ApplyIncludesErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		location string
+		include  string
+		configs  map[string]string
+		errMsg   string
+	}{
+		{
+			name:    "relative include without location",
+			include: "base.yaml",
+			errMsg:  "relative include",
+		},
+		{
+			name:     "missing include",
+			location: "https://config.example.com/node.yaml",
+			include:  "base.yaml",
+			errMsg:   "404",
+		},
+		{
+			name:     "include cycle",
+			location: "https://config.example.com/node.yaml",
+			include:  "a.yaml",
+			configs: map[string]string{
+				"https://config.example.com/a.yaml": "include: [b.yaml]",
+				"https://config.example.com/b.yaml": "include: [a.yaml]",
+			},
+			errMsg: "include cycle",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := NewHarvesterConfig()
+			conf.Include = []string{tc.include}
+			err := conf.ApplyIncludes(tc.location, fakeConfigFetcher(tc.configs))
+			assert.ErrorContains(t, err, tc.errMsg)
+		})
+	}
+}
+
+func TestHarvesterConfig_ApplyFileURLIncludes(t *testing.T) {
+	// file:// URLs are fetched like the config URL, not read from the
+	// system, and relative includes resolve against them
+	fetch := fakeConfigFetcher(map[string]string{
+		"file://CIDATA/harvester/site.yaml": "os:\n  hostname: site\n  ntpServers: [ntp1.example.com]\n",
+		"file:///harvester/rack.yaml":       "os:\n  hostname: rack\n",
+	})
+	conf := NewHarvesterConfig()
+	conf.Include = []string{"site.yaml", "file:///harvester/rack.yaml"}
+	require.NoError(t, conf.ApplyIncludes("file://CIDATA/harvester/node.yaml", fetch))
+	assert.Equal(t, "rack", conf.Hostname)
+	assert.Equal(t, []string{"ntp1.example.com"}, conf.NTPServers)
+}
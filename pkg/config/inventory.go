@@ -0,0 +1,239 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// Node is an entry of the node inventory, overriding the config of the node
+// it matches. A node matches if any of the keys set in the entry matches.
+type Node struct {
+	MACAddress   string `json:"macAddress,omitempty"`
+	SystemSerial string `json:"systemSerial,omitempty"`
+	DiskSerial   string `json:"diskSerial,omitempty"`
+
+	Hostname string `json:"hostname,omitempty"`
+	// IP is the static IP of the management interface with the prefix
+	// length, e.g. 10.0.0.11/24. The prefix length may be left out if the
+	// config has a static network with a subnet mask of its own.
+	IP string `json:"ip,omitempty"`
+	// Gateway and DNSNameservers go with IP, they are required unless the
+	// config has a static network of its own.
+	Gateway        string            `json:"gateway,omitempty"`
+	DNSNameservers []string          `json:"dnsNameservers,omitempty"`
+	Role           string            `json:"role,omitempty"`
+	Device         string            `json:"device,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Taints         []Taint           `json:"taints,omitempty"`
+}
+
+// key describes what the entry is matched by, for errors and provenance.
+func (n Node) key() string {
+	var keys []string
+	if n.MACAddress != "" {
+		keys = append(keys, "macAddress "+n.MACAddress)
+	}
+	if n.SystemSerial != "" {
+		keys = append(keys, "systemSerial "+n.SystemSerial)
+	}
+	if n.DiskSerial != "" {
+		keys = append(keys, "diskSerial "+n.DiskSerial)
+	}
+	return strings.Join(keys, ", ")
+}
+
+func (n Node) matches(facts NodeFacts) bool {
+	if n.MACAddress != "" {
+		if hwAddr, err := net.ParseMAC(n.MACAddress); err == nil {
+			for _, mac := range facts.MgmtHwAddrs {
+				if other, err := net.ParseMAC(mac); err == nil && other.String() == hwAddr.String() {
+					return true
+				}
+			}
+		}
+	}
+	if n.SystemSerial != "" && n.SystemSerial == facts.DMI.Serial {
+		return true
+	}
+	if n.DiskSerial != "" {
+		if _, ok := facts.Disks[n.DiskSerial]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateNodes checks the entries of the node inventory, and that those
+// setting an IP have the prefix length, gateway and DNS servers the config
+// lacks.
+func ValidateNodes(nodes []Node, network Network, dnsNameservers []string) error {
+	seen := make(map[string]int)
+	for i, node := range nodes {
+		if node.MACAddress == "" && node.SystemSerial == "" && node.DiskSerial == "" {
+			return fmt.Errorf("nodes[%d] must have a macAddress, systemSerial or diskSerial", i)
+		}
+		var keys []string
+		if node.MACAddress != "" {
+			hwAddr, err := net.ParseMAC(node.MACAddress)
+			if err != nil {
+				return fmt.Errorf("nodes[%d] has an invalid macAddress: %w", i, err)
+			}
+			keys = append(keys, "macAddress "+hwAddr.String())
+		}
+		if node.SystemSerial != "" {
+			keys = append(keys, "systemSerial "+node.SystemSerial)
+		}
+		if node.DiskSerial != "" {
+			keys = append(keys, "diskSerial "+node.DiskSerial)
+		}
+		for _, key := range keys {
+			if j, ok := seen[key]; ok {
+				return fmt.Errorf("nodes[%d] and nodes[%d] both match %s", j, i, key)
+			}
+			seen[key] = i
+		}
+		if node.IP != "" {
+			_, mask, err := parseNodeIP(node.IP)
+			if err != nil {
+				return fmt.Errorf("nodes[%d] has an invalid ip: %w", i, err)
+			}
+			if mask == nil && !hasStaticSubnetMask(network) {
+				return fmt.Errorf("nodes[%d] sets an ip without a prefix length", i)
+			}
+			// a DHCP network has neither, nor a default route once the
+			// static IP replaces it
+			if node.Gateway == "" && (network.Method != NetworkMethodStatic || network.Gateway == "") {
+				return fmt.Errorf("nodes[%d] sets an ip without a gateway", i)
+			}
+			if len(node.DNSNameservers) == 0 && (network.Method != NetworkMethodStatic || len(dnsNameservers) == 0) {
+				return fmt.Errorf("nodes[%d] sets an ip without dnsNameservers", i)
+			}
+		}
+		if node.Gateway != "" && net.ParseIP(node.Gateway) == nil {
+			return fmt.Errorf("nodes[%d] has an invalid gateway: %s", i, node.Gateway)
+		}
+		for _, dns := range node.DNSNameservers {
+			if net.ParseIP(dns) == nil {
+				return fmt.Errorf("nodes[%d] has an invalid dnsNameservers entry: %s", i, dns)
+			}
+		}
+		switch node.Role {
+		case "", RoleDefault, RoleMgmt, RoleWitness, RoleWorker:
+		default:
+			return fmt.Errorf("nodes[%d] has an unknown role %q", i, node.Role)
+		}
+		if err := ValidateTaints(fmt.Sprintf("nodes[%d].taints", i), node.Taints); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasStaticSubnetMask reports whether the network has a subnet mask for an
+// inventory IP without a prefix length to go with; a DHCP network has none
+// until it gets a lease, and none once the static IP replaces it.
+func hasStaticSubnetMask(network Network) bool {
+	return network.Method == NetworkMethodStatic && network.SubnetMask != ""
+}
+
+func parseNodeIP(s string) (net.IP, net.IPMask, error) {
+	if strings.Contains(s, "/") {
+		ip, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ip, ipNet.Mask, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, nil, fmt.Errorf("%s is not an IP address", s)
+	}
+	return ip, nil, nil
+}
+
+// MatchNode returns the inventory entry matching the node, or nil if there
+// is none. It's an error if several entries match.
+func (c *HarvesterConfig) MatchNode(facts NodeFacts) (*Node, error) {
+	var matched *Node
+	for i := range c.Nodes {
+		if !c.Nodes[i].matches(facts) {
+			continue
+		}
+		if matched != nil {
+			return nil, fmt.Errorf("several nodes in the inventory match this node: %s and %s", matched.key(), c.Nodes[i].key())
+		}
+		matched = &c.Nodes[i]
+	}
+	return matched, nil
+}
+
+// ApplyNodeInventory overrides the config with the inventory entry matching
+// the node, if any. It returns the entry applied.
+func (c *HarvesterConfig) ApplyNodeInventory(facts NodeFacts) (*Node, error) {
+	node, err := c.MatchNode(facts)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	source := SourceNodeInventory(node.key())
+
+	if node.Hostname != "" {
+		c.OS.Hostname = node.Hostname
+		c.SetSource("os.hostname", source)
+	}
+	if node.IP != "" {
+		ip, mask, err := parseNodeIP(node.IP)
+		if err != nil {
+			return nil, err
+		}
+		if mask == nil && !hasStaticSubnetMask(c.ManagementInterface) {
+			return nil, fmt.Errorf("the ip %s of nodes entry %s has no prefix length", node.IP, node.key())
+		}
+		c.ManagementInterface.Method = NetworkMethodStatic
+		c.ManagementInterface.IP = ip.String()
+		c.SetSource("install.managementInterface.method", source)
+		c.SetSource("install.managementInterface.ip", source)
+		if mask != nil {
+			c.ManagementInterface.SubnetMask = net.IP(mask).String()
+			c.SetSource("install.managementInterface.subnetMask", source)
+		}
+	}
+	if node.Gateway != "" {
+		c.ManagementInterface.Gateway = node.Gateway
+		c.SetSource("install.managementInterface.gateway", source)
+	}
+	if len(node.DNSNameservers) > 0 {
+		c.OS.DNSNameservers = node.DNSNameservers
+		c.SetSource("os.dnsNameservers", source)
+	}
+	if node.Role != "" {
+		c.Install.Role = node.Role
+		c.SetSource("install.role", source)
+	}
+	switch {
+	case node.Device != "":
+		c.Install.Device = node.Device
+		c.SetSource("install.device", source)
+	case facts.Disks[node.DiskSerial] != "":
+		// the disk the node is known by is the one to install to
+		c.Install.Device = facts.Disks[node.DiskSerial]
+		c.SetSource("install.device", source)
+	}
+	if len(node.Labels) > 0 {
+		labels := make(map[string]string, len(c.OS.Labels)+len(node.Labels))
+		for k, v := range c.OS.Labels {
+			labels[k] = v
+		}
+		for k, v := range node.Labels {
+			labels[k] = v
+			c.SetSource(fmt.Sprintf("os.labels[%s]", k), source)
+		}
+		c.OS.Labels = labels
+	}
+	if len(node.Taints) > 0 {
+		c.OS.Taints = append(slices.Clip(c.OS.Taints), node.Taints...)
+		c.SetSource("os.taints", source)
+	}
+	return node, nil
+}
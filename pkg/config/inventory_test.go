@@ -0,0 +1,219 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvesterConfig_ApplyNodeInventory(t *testing.T) {
+	facts := NodeFacts{
+		MgmtHwAddrs: []string{"52:54:00:AB:CD:01"},
+		DMI:         DMIFacts{Serial: "SN0001"},
+		Disks:       map[string]string{"DISK0001": "/dev/sdb"},
+	}
+	newConfig := func(nodes ...Node) *HarvesterConfig {
+		c := NewHarvesterConfig()
+		c.OS.Hostname = "shared"
+		c.OS.Labels = map[string]string{"site": "dc1"}
+		c.Install.Device = "/dev/sda"
+		c.ManagementInterface.Method = NetworkMethodDHCP
+		c.Nodes = nodes
+		return c
+	}
+
+	testCases := []struct {
+		name     string
+		config   *HarvesterConfig
+		expected func(c *HarvesterConfig)
+		errMsg   string
+	}{
+		{
+			name:   "no match",
+			config: newConfig(Node{MACAddress: "52:54:00:ab:cd:02", Hostname: "node2"}),
+		},
+		{
+			name: "match by MAC address",
+			config: newConfig(
+				Node{MACAddress: "52:54:00:ab:cd:02", Hostname: "node2"},
+				Node{MACAddress: "52:54:00:ab:cd:01", Hostname: "node1", IP: "10.0.0.11/24", Gateway: "10.0.0.1", DNSNameservers: []string{"10.0.0.2"}, Role: RoleWitness},
+			),
+			expected: func(c *HarvesterConfig) {
+				c.OS.Hostname = "node1"
+				c.ManagementInterface.Method = NetworkMethodStatic
+				c.ManagementInterface.IP = "10.0.0.11"
+				c.ManagementInterface.SubnetMask = "255.255.255.0"
+				c.ManagementInterface.Gateway = "10.0.0.1"
+				c.OS.DNSNameservers = []string{"10.0.0.2"}
+				c.Install.Role = RoleWitness
+			},
+		},
+		{
+			name:   "match by system serial",
+			config: newConfig(Node{SystemSerial: "SN0001", Device: "/dev/nvme0n1", Labels: map[string]string{"rack": "r1"}}),
+			expected: func(c *HarvesterConfig) {
+				c.Install.Device = "/dev/nvme0n1"
+				c.OS.Labels = map[string]string{"site": "dc1", "rack": "r1"}
+			},
+		},
+		{
+			name:   "taints are added to those of the config",
+			config: newConfig(Node{SystemSerial: "SN0001", Taints: []Taint{{Key: "nvidia.com/gpu", Effect: "NoSchedule"}}}),
+			expected: func(c *HarvesterConfig) {
+				c.OS.Taints = []Taint{{Key: "nvidia.com/gpu", Effect: "NoSchedule"}}
+			},
+		},
+		{
+			name:   "match by disk serial installs to that disk",
+			config: newConfig(Node{DiskSerial: "DISK0001", IP: "10.0.0.12/16"}),
+			expected: func(c *HarvesterConfig) {
+				c.Install.Device = "/dev/sdb"
+				c.ManagementInterface.Method = NetworkMethodStatic
+				c.ManagementInterface.IP = "10.0.0.12"
+				c.ManagementInterface.SubnetMask = "255.255.0.0"
+			},
+		},
+		{
+			name:   "IP without a prefix length over DHCP",
+			config: newConfig(Node{SystemSerial: "SN0001", IP: "10.0.0.12"}),
+			errMsg: "the ip 10.0.0.12 of nodes entry systemSerial SN0001 has no prefix length",
+		},
+		{
+			name: "several matches",
+			config: newConfig(
+				Node{MACAddress: "52:54:00:ab:cd:01"},
+				Node{SystemSerial: "SN0001"},
+			),
+			errMsg: "several nodes in the inventory match this node",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expected := newConfig(tc.config.Nodes...)
+			if tc.expected != nil {
+				tc.expected(expected)
+			}
+
+			node, err := tc.config.ApplyNodeInventory(facts)
+			if tc.errMsg != "" {
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected == nil, node == nil)
+
+			tc.config.Provenance = nil
+			assert.Equal(t, expected, tc.config)
+		})
+	}
+}
+
+func TestHarvesterConfig_ApplyNodeInventoryProvenance(t *testing.T) {
+	c := NewHarvesterConfig()
+	c.OS.Hostname = "shared"
+	c.Nodes = []Node{{SystemSerial: "SN0001", Hostname: "node1"}}
+	c.SetSource("", SourceRemote("http://example.com/inventory.yaml"))
+
+	_, err := c.ApplyNodeInventory(NodeFacts{DMI: DMIFacts{Serial: "SN0001"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "nodes entry systemSerial SN0001", c.Provenance.Lookup("os.hostname"))
+	assert.Equal(t, "remote http://example.com/inventory.yaml", c.Provenance.Lookup("install.device"))
+}
+
+func TestValidateNodes(t *testing.T) {
+	dhcp := Network{Method: NetworkMethodDHCP}
+	static := Network{Method: NetworkMethodStatic, IP: "10.0.0.10", SubnetMask: "255.255.255.0", Gateway: "10.0.0.1"}
+	testCases := []struct {
+		name           string
+		nodes          []Node
+		network        Network
+		dnsNameservers []string
+		errMsg         string
+	}{
+		{
+			name: "valid",
+			nodes: []Node{
+				{MACAddress: "52:54:00:ab:cd:01", IP: "10.0.0.11/24", Gateway: "10.0.0.1", DNSNameservers: []string{"10.0.0.2"}, Role: RoleMgmt},
+				{SystemSerial: "SN0002", IP: "10.0.0.12/24", Gateway: "10.0.0.1", DNSNameservers: []string{"10.0.0.2"}},
+				{DiskSerial: "DISK0003"},
+			},
+			network: dhcp,
+		},
+		{
+			name:           "gateway and DNS servers of a static network",
+			nodes:          []Node{{SystemSerial: "SN0001", IP: "10.0.0.11/24"}},
+			network:        static,
+			dnsNameservers: []string{"10.0.0.2"},
+		},
+		{
+			name:           "subnet mask of a static network",
+			nodes:          []Node{{SystemSerial: "SN0001", IP: "10.0.0.11"}},
+			network:        static,
+			dnsNameservers: []string{"10.0.0.2"},
+		},
+		{
+			name:    "IP without a prefix length over DHCP",
+			nodes:   []Node{{SystemSerial: "SN0001", IP: "10.0.0.11", Gateway: "10.0.0.1", DNSNameservers: []string{"10.0.0.2"}}},
+			network: dhcp,
+			errMsg:  "nodes[0] sets an ip without a prefix length",
+		},
+		{
+			name:    "IP without a gateway over DHCP",
+			nodes:   []Node{{SystemSerial: "SN0001", IP: "10.0.0.11/24", DNSNameservers: []string{"10.0.0.2"}}},
+			network: dhcp,
+			errMsg:  "nodes[0] sets an ip without a gateway",
+		},
+		{
+			name:    "IP without DNS servers",
+			nodes:   []Node{{SystemSerial: "SN0001", IP: "10.0.0.11/24"}},
+			network: static,
+			errMsg:  "nodes[0] sets an ip without dnsNameservers",
+		},
+		{
+			name:    "invalid gateway",
+			nodes:   []Node{{SystemSerial: "SN0001", Gateway: "10.0.0"}},
+			network: dhcp,
+			errMsg:  "nodes[0] has an invalid gateway: 10.0.0",
+		},
+		{
+			name:   "no key",
+			nodes:  []Node{{Hostname: "node1"}},
+			errMsg: "nodes[0] must have a macAddress, systemSerial or diskSerial",
+		},
+		{
+			name:   "invalid MAC address",
+			nodes:  []Node{{MACAddress: "52:54:00"}},
+			errMsg: "nodes[0] has an invalid macAddress",
+		},
+		{
+			name: "duplicate MAC address",
+			nodes: []Node{
+				{MACAddress: "52:54:00:ab:cd:01"},
+				{MACAddress: "52:54:00:AB:CD:01"},
+			},
+			errMsg: "nodes[0] and nodes[1] both match macAddress 52:54:00:ab:cd:01",
+		},
+		{
+			name:   "invalid IP",
+			nodes:  []Node{{SystemSerial: "SN0001", IP: "10.0.0.256", Gateway: "10.0.0.1", DNSNameservers: []string{"10.0.0.2"}}},
+			errMsg: "nodes[0] has an invalid ip",
+		},
+		{
+			name:   "unknown role",
+			nodes:  []Node{{SystemSerial: "SN0001", Role: "master"}},
+			errMsg: `nodes[0] has an unknown role "master"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateNodes(tc.nodes, tc.network, tc.dnsNameservers)
+			if tc.errMsg == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.errMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	yipSchema "github.com/rancher/yip/pkg/schema"
+)
+
+const (
+	kdumpConfigFile      = "/etc/sysconfig/kdump"
+	kdumpService         = "kdump"
+	defaultKdumpDir      = "/var/crash"
+	defaultKdumpKeepOld  = 5
+	minCrashKernelMiB    = 64
+	crashKernelMaxMemDiv = 2
+	// with dump level 31 only the pages of the kernel are dumped, and
+	// compressed, which is seldom more than an eighth of the memory
+	kdumpSizeMemDiv = 8
+
+	// the kdump initrd only mounts the persistent partition, at
+	// kdumpInitrdMount, where persistent state paths are bind mounted from
+	// its .state directory
+	persistentMount  = "/usr/local"
+	kdumpInitrdMount = "/mnt0"
+)
+
+var (
+	crashKernelRegexp   = regexp.MustCompile(`^([0-9]+)([MG])(,(high|low))?$`)
+	partitionSizeRegexp = regexp.MustCompile(`^([0-9]+)(Mi|Gi)$`)
+	kdumpTargetSchemes  = []string{"nfs", "ssh", "sftp", "ftp", "cifs"}
+
+	// kdumpPersistentDirs are persistent directories dumps may be saved in,
+	// besides os.persistentStatePaths.
+	kdumpPersistentDirs = []string{defaultKdumpDir, "/usr/local", "/var/lib/third-party"}
+)
+
+// KdumpConfig is how kernel crash dumps are taken and where they are saved.
+type KdumpConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// CrashKernel is the memory reserved to the crash kernel, such as 512M
+	// or 1G,high. It is calibrated to the node if unset.
+	CrashKernel string `json:"crashKernel,omitempty"`
+	// Target is a local directory, /var/crash if unset, or an nfs://,
+	// ssh://, sftp://, ftp:// or cifs:// URL dumps are saved to. The URL
+	// may have a user but no password, as it is saved in the clear.
+	Target string `json:"target,omitempty"`
+	// KeepOldDumps is the number of dumps kept, 5 if unset.
+	KeepOldDumps int `json:"keepOldDumps,omitempty"`
+}
+
+// SaveDir returns the KDUMP_SAVEDIR of the target.
+func (k KdumpConfig) SaveDir() string {
+	switch {
+	case k.Target == "":
+		return "file://" + defaultKdumpDir
+	case filepath.IsAbs(k.Target):
+		return "file://" + k.Target
+	}
+	return k.Target
+}
+
+// Network tells if dumps are saved over the network.
+func (k KdumpConfig) Network() bool {
+	return !strings.HasPrefix(k.SaveDir(), "file://")
+}
+
+// GetKeepOldDumps returns the number of dumps kept.
+func (k KdumpConfig) GetKeepOldDumps() int {
+	if k.KeepOldDumps > 0 {
+		return k.KeepOldDumps
+	}
+	return defaultKdumpKeepOld
+}
+
+func crashKernelMiB(crashKernel string) (int64, bool) {
+	match := crashKernelRegexp.FindStringSubmatch(crashKernel)
+	if match == nil {
+		return 0, false
+	}
+	size, _ := strconv.ParseInt(match[1], 10, 64)
+	if match[2] == "G" {
+		size <<= 10
+	}
+	return size, true
+}
+
+func partitionSizeMiB(size string) (int64, bool) {
+	match := partitionSizeRegexp.FindStringSubmatch(size)
+	if match == nil {
+		return 0, false
+	}
+	mib, _ := strconv.ParseInt(match[1], 10, 64)
+	if match[2] == "Gi" {
+		mib <<= 10
+	}
+	return mib, true
+}
+
+// persistentPartitionMiB returns the size of the persistent partition, or 0
+// if it takes the rest of the disk.
+func (c *HarvesterConfig) persistentPartitionMiB() int64 {
+	if !c.ShouldCreateDataPartitionOnOsDisk() {
+		return 0
+	}
+	size, _ := partitionSizeMiB(orDefault(c.Install.PersistentPartitionSize, fmt.Sprintf("%dGi", PersistentSizeMinGiB)))
+	return size
+}
+
+// ValidateKdumpConfig checks the crash kernel fits in the memory of the node
+// and the target, which must be persistent and have room for a dump if it
+// is local.
+func ValidateKdumpConfig(c *HarvesterConfig) error {
+	k := c.OS.Kdump
+	if !k.Enabled {
+		return nil
+	}
+	memoryMiB := nodeMemoryMiB()
+	if k.CrashKernel != "" {
+		size, ok := crashKernelMiB(k.CrashKernel)
+		if !ok {
+			return fmt.Errorf("os.kdump.crashKernel must be a size such as 512M or 1G,high: %q", k.CrashKernel)
+		}
+		if size < minCrashKernelMiB {
+			return fmt.Errorf("os.kdump.crashKernel must be at least %dM", minCrashKernelMiB)
+		}
+		if memoryMiB > 0 && size > memoryMiB/crashKernelMaxMemDiv {
+			return fmt.Errorf("os.kdump.crashKernel %s is more than half of the %dM of memory", k.CrashKernel, memoryMiB)
+		}
+	}
+	if k.KeepOldDumps < 0 {
+		return fmt.Errorf("os.kdump.keepOldDumps must be positive")
+	}
+	if k.Target != "" && !filepath.IsAbs(k.Target) {
+		u, err := url.Parse(k.Target)
+		if err == nil && u.User != nil {
+			// not echoed back, unlike the other errors of the target
+			if _, ok := u.User.Password(); ok {
+				return fmt.Errorf("os.kdump.target can't have a password, it would be saved in the clear")
+			}
+		}
+		if err != nil || !slices.Contains(kdumpTargetSchemes, u.Scheme) || u.Host == "" {
+			return fmt.Errorf("os.kdump.target must be a directory or a %s URL: %q", strings.Join(kdumpTargetSchemes, ", "), k.Target)
+		}
+		return nil
+	}
+	if strings.ContainsAny(k.Target, "\"'$`\\,") {
+		return fmt.Errorf("os.kdump.target is an invalid directory: %q", k.Target)
+	}
+	dir := filepath.Clean(orDefault(k.Target, defaultKdumpDir))
+	if c.kdumpPersistentDir(dir) == "" {
+		return fmt.Errorf("os.kdump.target %s isn't persistent, it must be in %s or os.persistentStatePaths", dir, strings.Join(kdumpPersistentDirs, ", "))
+	}
+	if persistentMiB, dumpMiB := c.persistentPartitionMiB(), memoryMiB/kdumpSizeMemDiv; persistentMiB > 0 && dumpMiB > persistentMiB {
+		return fmt.Errorf("the persistent partition of %dMi can't hold a dump of the %dM of memory, estimated at %dM", persistentMiB, memoryMiB, dumpMiB)
+	}
+	return nil
+}
+
+// kdumpPersistentDir returns the innermost persistent directory dir is in,
+// or "" if it isn't persistent.
+func (c *HarvesterConfig) kdumpPersistentDir(dir string) string {
+	var persistent string
+	for _, p := range append(slices.Clone(kdumpPersistentDirs), c.OS.PersistentStatePaths...) {
+		p = filepath.Clean(p)
+		if (dir == p || strings.HasPrefix(dir, p+"/")) && len(p) > len(persistent) {
+			persistent = p
+		}
+	}
+	return persistent
+}
+
+// kdumpInitrdSaveDir returns the KDUMP_SAVEDIR of a local target in the
+// kdump initrd, or "" if dumps are saved over the network.
+func (c *HarvesterConfig) kdumpInitrdSaveDir() string {
+	k := c.OS.Kdump
+	if k.Network() {
+		return ""
+	}
+	dir := filepath.Clean(orDefault(k.Target, defaultKdumpDir))
+	persistent := c.kdumpPersistentDir(dir)
+	if persistent == "" {
+		return ""
+	}
+	rel, _ := filepath.Rel(persistent, dir)
+	base := filepath.Join(kdumpInitrdMount, ".state", strings.ReplaceAll(strings.TrimPrefix(persistent, "/"), "/", "-")+".bind")
+	if persistent == persistentMount {
+		base = kdumpInitrdMount
+	}
+	return "file://" + filepath.Join(base, rel)
+}
+
+// kdumpKernelArgs returns the crashkernel argument of kdump, unless it is
+// calibrated by the installer.
+func (c *HarvesterConfig) kdumpKernelArgs() []string {
+	if !c.OS.Kdump.Enabled || c.OS.Kdump.CrashKernel == "" {
+		return nil
+	}
+	return []string{"crashkernel=" + c.OS.Kdump.CrashKernel}
+}
+
+// addKdumpConfig writes the kdump config and enables kdump.
+func addKdumpConfig(config *HarvesterConfig, stage *yipSchema.Stage) error {
+	if !config.OS.Kdump.Enabled {
+		return nil
+	}
+	content, err := render("kdump.sysconfig", struct {
+		KdumpConfig
+		InitrdSaveDir string
+	}{config.OS.Kdump, config.kdumpInitrdSaveDir()})
+	if err != nil {
+		return err
+	}
+	stage.Files = append(stage.Files, yipSchema.File{
+		Path:        kdumpConfigFile,
+		Content:     content,
+		Permissions: 0600,
+		Owner:       0,
+		Group:       0,
+	})
+	stage.Systemctl.Enable = append(stage.Systemctl.Enable, kdumpService)
+	return nil
+}
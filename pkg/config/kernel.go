@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const multipathOff = "multipath=off"
+
+var (
+	// defaultKernelArgs are those of bootargs.cfg that may be removed or
+	// overridden.
+	defaultKernelArgs = []string{
+		"panic=0",
+		"net.ifnames=1",
+		"audit=1",
+		"audit_backlog_limit=8192",
+		"intel_iommu=on",
+		"amd_iommu=on",
+		"iommu=pt",
+	}
+
+	// repeatableKernelArgs are the keys the kernel takes several times.
+	repeatableKernelArgs = []string{"console", "hugepagesz", "hugepages", "crashkernel"}
+)
+
+// KernelArguments change the kernel command line of the installed system.
+type KernelArguments struct {
+	// Add are arguments such as "key=value" or "flag", added after those of
+	// Harvester and overriding those with the same key.
+	Add []string `json:"add,omitempty"`
+	// Remove are arguments of Harvester removed, by key or "key=value".
+	Remove []string `json:"remove,omitempty"`
+}
+
+func kernelArgKey(arg string) string {
+	key, _, _ := strings.Cut(arg, "=")
+	return key
+}
+
+// matchesKernelArg tells if arg is removed by the "key" or "key=value" entry.
+func matchesKernelArg(entry, arg string) bool {
+	if strings.Contains(entry, "=") {
+		return entry == arg
+	}
+	return entry == kernelArgKey(arg)
+}
+
+// requiredKernelArgs are the arguments the installer needs.
+func (c *HarvesterConfig) requiredKernelArgs() []string {
+	if !c.OS.ExternalStorage.Enabled {
+		return []string{multipathOff}
+	}
+	return nil
+}
+
+// addedKernelArgs returns the arguments configured to be added, those of the
+// performance tuning, of passthrough and of kdump, the former free-form
+// additionalKernelArguments and the added ones.
+func (c *HarvesterConfig) addedKernelArgs() []string {
+	args := append(c.performanceKernelArgs(), c.passthroughKernelArgs()...)
+	args = append(args, c.kdumpKernelArgs()...)
+	args = append(args, strings.Fields(c.OS.AdditionalKernelArguments)...)
+	return append(args, c.OS.KernelArguments.Add...)
+}
+
+// ValidateKernelArguments checks the arguments are single words, that none is
+// both added and removed or added twice with different values, and that the
+// arguments the installer needs are kept.
+func ValidateKernelArguments(c *HarvesterConfig) error {
+	added := c.addedKernelArgs()
+	for _, arg := range append(slices.Clone(added), c.OS.KernelArguments.Remove...) {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'$\\;") {
+			return fmt.Errorf("invalid kernel argument %q", arg)
+		}
+	}
+	for i, arg := range added {
+		for _, remove := range c.OS.KernelArguments.Remove {
+			if matchesKernelArg(remove, arg) {
+				return fmt.Errorf("kernel argument %s is both added and removed", arg)
+			}
+		}
+		key := kernelArgKey(arg)
+		if slices.Contains(repeatableKernelArgs, key) {
+			continue
+		}
+		for _, other := range added[:i] {
+			if other == arg {
+				return fmt.Errorf("kernel argument %s is added twice", arg)
+			}
+			if kernelArgKey(other) == key {
+				return fmt.Errorf("kernel arguments %s and %s conflict", other, arg)
+			}
+		}
+	}
+	for _, required := range c.requiredKernelArgs() {
+		for _, remove := range c.OS.KernelArguments.Remove {
+			if matchesKernelArg(remove, required) {
+				return fmt.Errorf("kernel argument %s can't be removed unless os.externalStorageConfig is enabled", required)
+			}
+		}
+		for _, arg := range added {
+			if kernelArgKey(arg) == kernelArgKey(required) && arg != required {
+				return fmt.Errorf("kernel argument %s conflicts with %s, which is needed unless os.externalStorageConfig is enabled", arg, required)
+			}
+		}
+	}
+	return nil
+}
+
+// AdditionalKernelArgs returns the arguments added to those of bootargs.cfg,
+// those the installer needs and those configured.
+func (c *HarvesterConfig) AdditionalKernelArgs() []string {
+	var args []string
+	for _, arg := range append(c.requiredKernelArgs(), c.addedKernelArgs()...) {
+		if slices.Contains(repeatableKernelArgs, kernelArgKey(arg)) || !slices.Contains(args, arg) {
+			args = append(args, arg)
+		}
+	}
+	return args
+}
+
+// RemovedKernelArgs returns the arguments of bootargs.cfg that are removed,
+// or overridden by added ones.
+func (c *HarvesterConfig) RemovedKernelArgs() []string {
+	added := c.AdditionalKernelArgs()
+	var removed []string
+	for _, arg := range defaultKernelArgs {
+		overridden := slices.ContainsFunc(added, func(a string) bool { return kernelArgKey(a) == kernelArgKey(arg) })
+		if overridden || slices.ContainsFunc(c.OS.KernelArguments.Remove, func(r string) bool { return matchesKernelArg(r, arg) }) {
+			removed = append(removed, arg)
+		}
+	}
+	return removed
+}
+
+// KernelArgs returns the arguments of the installed system that can be
+// configured, as the kernel gets them.
+func (c *HarvesterConfig) KernelArgs() []string {
+	removed := c.RemovedKernelArgs()
+	var args []string
+	for _, arg := range defaultKernelArgs {
+		if !slices.Contains(removed, arg) {
+			args = append(args, arg)
+		}
+	}
+	return append(args, c.AdditionalKernelArgs()...)
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateKernelArguments(t *testing.T) {
+	testCases := []struct {
+		name            string
+		externalStorage bool
+		additional      string
+		kernelArgs      KernelArguments
+		errMsg          string
+	}{
+		{
+			name:       "add and remove",
+			additional: "rd.iscsi.firmware",
+			kernelArgs: KernelArguments{
+				Add:    []string{"console=ttyS0,115200", "console=tty1", "iommu=off", "multipath=off"},
+				Remove: []string{"audit", "intel_iommu=on"},
+			},
+		},
+		{
+			name:       "invalid argument",
+			kernelArgs: KernelArguments{Add: []string{"quiet splash"}},
+			errMsg:     `invalid kernel argument "quiet splash"`,
+		},
+		{
+			name:       "added twice",
+			additional: "rd.iscsi.ibft",
+			kernelArgs: KernelArguments{Add: []string{"rd.iscsi.ibft"}},
+			errMsg:     "kernel argument rd.iscsi.ibft is added twice",
+		},
+		{
+			name:       "conflicting values",
+			kernelArgs: KernelArguments{Add: []string{"iommu=off", "iommu=pt"}},
+			errMsg:     "kernel arguments iommu=off and iommu=pt conflict",
+		},
+		{
+			name:       "added and removed",
+			kernelArgs: KernelArguments{Add: []string{"audit=0"}, Remove: []string{"audit"}},
+			errMsg:     "kernel argument audit=0 is both added and removed",
+		},
+		{
+			name:       "multipath turned back on",
+			additional: "multipath=on",
+			errMsg:     "kernel argument multipath=on conflicts with multipath=off, which is needed unless os.externalStorageConfig is enabled",
+		},
+		{
+			name:       "multipath=off removed",
+			kernelArgs: KernelArguments{Remove: []string{"multipath"}},
+			errMsg:     "kernel argument multipath=off can't be removed unless os.externalStorageConfig is enabled",
+		},
+		{
+			name:            "multipath with external storage",
+			externalStorage: true,
+			kernelArgs:      KernelArguments{Add: []string{"multipath=on"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewHarvesterConfig()
+			c.OS.ExternalStorage.Enabled = tc.externalStorage
+			c.OS.AdditionalKernelArguments = tc.additional
+			c.OS.KernelArguments = tc.kernelArgs
+			err := ValidateKernelArguments(c)
+			if tc.errMsg != "" {
+				assert.EqualError(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestHarvesterConfig_KernelArgs(t *testing.T) {
+	c := NewHarvesterConfig()
+	// multipath stays off along with the additional arguments
+	c.OS.AdditionalKernelArguments = "rd.iscsi.firmware rd.iscsi.ibft"
+	c.OS.KernelArguments = KernelArguments{
+		Add:    []string{"iommu=off", "multipath=off"},
+		Remove: []string{"audit", "intel_iommu=on"},
+	}
+
+	assert.Equal(t, []string{"multipath=off", "rd.iscsi.firmware", "rd.iscsi.ibft", "iommu=off"}, c.AdditionalKernelArgs())
+	assert.Equal(t, []string{"audit=1", "intel_iommu=on", "iommu=pt"}, c.RemovedKernelArgs())
+	assert.Equal(t, []string{
+		"panic=0", "net.ifnames=1", "audit_backlog_limit=8192", "amd_iommu=on",
+		"multipath=off", "rd.iscsi.firmware", "rd.iscsi.ibft", "iommu=off",
+	}, c.KernelArgs())
+
+	c.OS.ExternalStorage.Enabled = true
+	assert.Equal(t, []string{"rd.iscsi.firmware", "rd.iscsi.ibft", "iommu=off", "multipath=off"}, c.AdditionalKernelArgs())
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	reservedCPU              = "cpu"
+	reservedMemory           = "memory"
+	reservedEphemeralStorage = "ephemeral-storage"
+)
+
+var (
+	// cpuOnlineFile and memInfoFile tell the size of the node. The CPUs the
+	// installer may run on can be fewer, such as with isolcpus.
+	cpuOnlineFile = "/sys/devices/system/cpu/online"
+	memInfoFile   = "/proc/meminfo"
+
+	quantityRegexp  = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(m|k|M|G|T|P|E|Ki|Mi|Gi|Ti|Pi|Ei)?$`)
+	percentRegexp   = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?%$`)
+	reservableNames = []string{reservedCPU, reservedMemory, reservedEphemeralStorage}
+
+	// defaultEvictionHard are the defaults of kubelet, which it drops for
+	// the signals missing once any is set.
+	defaultEvictionHard = map[string]string{
+		"memory.available":  "100Mi",
+		"nodefs.available":  "10%",
+		"nodefs.inodesFree": "5%",
+		"imagefs.available": "15%",
+	}
+	evictionSignals = []string{
+		"memory.available",
+		"nodefs.available",
+		"nodefs.inodesFree",
+		"imagefs.available",
+		"imagefs.inodesFree",
+		"containerfs.available",
+		"containerfs.inodesFree",
+		"pid.available",
+	}
+)
+
+// KubeletConfig sizes what kubelet runs and what it leaves to the system.
+type KubeletConfig struct {
+	// MaxPods is the number of pods the node runs at most, MaxPods if unset.
+	MaxPods int `json:"maxPods,omitempty"`
+	// SystemReserved and KubeReserved map cpu, memory and ephemeral-storage
+	// to the quantities reserved to the OS and to the Kubernetes daemons.
+	// CPU and memory default to shares of the node size.
+	SystemReserved map[string]string `json:"systemReserved,omitempty"`
+	KubeReserved   map[string]string `json:"kubeReserved,omitempty"`
+	// EvictionHard maps eviction signals, such as memory.available, to the
+	// thresholds kubelet evicts pods at, in quantities or percentages.
+	EvictionHard map[string]string `json:"evictionHard,omitempty"`
+}
+
+// ValidateKubeletConfig checks the resources, signals and quantities.
+func ValidateKubeletConfig(k KubeletConfig) error {
+	if k.MaxPods < 0 {
+		return errors.New("os.kubelet.maxPods must be positive")
+	}
+	for _, field := range []struct {
+		name     string
+		reserved map[string]string
+	}{{"systemReserved", k.SystemReserved}, {"kubeReserved", k.KubeReserved}} {
+		for _, name := range slices.Sorted(maps.Keys(field.reserved)) {
+			if !slices.Contains(reservableNames, name) {
+				return fmt.Errorf("os.kubelet.%s.%s must be one of %s", field.name, name, strings.Join(reservableNames, ", "))
+			}
+			if !quantityRegexp.MatchString(field.reserved[name]) {
+				return fmt.Errorf("os.kubelet.%s.%s is not a quantity: %q", field.name, name, field.reserved[name])
+			}
+		}
+	}
+	for _, signal := range slices.Sorted(maps.Keys(k.EvictionHard)) {
+		if !slices.Contains(evictionSignals, signal) {
+			return fmt.Errorf("os.kubelet.evictionHard.%s is not an eviction signal", signal)
+		}
+		if value := k.EvictionHard[signal]; !quantityRegexp.MatchString(value) && !percentRegexp.MatchString(value) {
+			return fmt.Errorf("os.kubelet.evictionHard.%s is neither a quantity nor a percentage: %q", signal, value)
+		}
+	}
+	return nil
+}
+
+func (c *HarvesterConfig) maxPods() int {
+	if c.OS.Kubelet.MaxPods > 0 {
+		return c.OS.Kubelet.MaxPods
+	}
+	return MaxPods
+}
+
+// reservedArg returns the kubelet argument reserving the resources, the
+// configured ones and the computed shares of the CPU and memory.
+func reservedArg(name string, configured map[string]string, cpuMilli, memoryMiB int64) string {
+	reserved := map[string]string{
+		reservedCPU: fmt.Sprintf("%dm", cpuMilli),
+	}
+	if memoryMiB > 0 {
+		reserved[reservedMemory] = fmt.Sprintf("%dMi", memoryMiB)
+	}
+	for resource, quantity := range configured {
+		reserved[resource] = quantity
+	}
+	quantities := make([]string, 0, len(reserved))
+	for _, resource := range reservableNames {
+		if quantity, ok := reserved[resource]; ok && quantity != "" {
+			quantities = append(quantities, resource+"="+quantity)
+		}
+	}
+	return name + "=" + strings.Join(quantities, ",")
+}
+
+// GetEvictionHard returns the kubelet argument of the hard eviction
+// thresholds, those configured on top of the defaults of kubelet.
+func (c *HarvesterConfig) GetEvictionHard() string {
+	thresholds := make(map[string]string, len(defaultEvictionHard)+len(c.OS.Kubelet.EvictionHard))
+	for signal, threshold := range defaultEvictionHard {
+		thresholds[signal] = threshold
+	}
+	for signal, threshold := range c.OS.Kubelet.EvictionHard {
+		thresholds[signal] = threshold
+	}
+	args := make([]string, 0, len(thresholds))
+	for _, signal := range slices.Sorted(maps.Keys(thresholds)) {
+		args = append(args, signal+"<"+thresholds[signal])
+	}
+	return "eviction-hard=" + strings.Join(args, ",")
+}
+
+// nodeCPUs returns the number of online CPUs of the node.
+func nodeCPUs() int {
+	data, err := os.ReadFile(cpuOnlineFile)
+	if err != nil {
+		return runtime.NumCPU()
+	}
+	// e.g. 0-63 or 0,2-5
+	cpus := 0
+	for _, cpuRange := range strings.Split(strings.TrimSpace(string(data)), ",") {
+		first, last, found := strings.Cut(cpuRange, "-")
+		if !found {
+			last = first
+		}
+		from, err1 := strconv.Atoi(first)
+		to, err2 := strconv.Atoi(last)
+		if err1 != nil || err2 != nil || to < from {
+			return runtime.NumCPU()
+		}
+		cpus += to - from + 1
+	}
+	return cpus
+}
+
+// nodeMemoryMiB returns the memory of the node, or 0 if it is unknown.
+func nodeMemoryMiB() int64 {
+	f, err := os.Open(memInfoFile)
+	if err != nil {
+		return 0
+	}
+	defer f.Close() //nolint:errcheck
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var memTotalKiB int64
+		if n, _ := fmt.Sscanf(scanner.Text(), "MemTotal: %d kB", &memTotalKiB); n == 1 {
+			return memTotalKiB >> 10
+		}
+	}
+	return 0
+}
+
+// inspired by GKE memory reservations https://cloud.google.com/kubernetes-engine/docs/concepts/plan-node-sizes
+func calculateMemoryReservedInMiB(memoryMiB int64) int64 {
+	// this shouldn't happen
+	if memoryMiB <= 0 {
+		return 0
+	}
+
+	// 255 MiB of machines with less than 1 GiB
+	if memoryMiB < 1024 {
+		return 255
+	}
+
+	var reserved float64
+	for _, tier := range []struct {
+		sizeMiB int64
+		share   float64
+	}{
+		// 25% of the first 4 GiB
+		{4 << 10, 0.25},
+		// 20% of the next 4 GiB (up to 8 GiB)
+		{4 << 10, 0.2},
+		// 10% of the next 8 GiB (up to 16 GiB)
+		{8 << 10, 0.1},
+		// 6% of the next 112 GiB (up to 128 GiB)
+		{112 << 10, 0.06},
+	} {
+		size := min(memoryMiB, tier.sizeMiB)
+		reserved += float64(size) * tier.share
+		memoryMiB -= size
+	}
+	// 2% of any memory above 128 GiB
+	reserved += float64(memoryMiB) * 0.02
+
+	return int64(reserved)
+}
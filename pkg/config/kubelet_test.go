@@ -0,0 +1,127 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeNodeSize makes the node look like it has the CPUs and memory.
+func fakeNodeSize(t *testing.T, cpuOnline string, memTotalKiB string) {
+	dir := t.TempDir()
+	oldCPUOnlineFile, oldMemInfoFile := cpuOnlineFile, memInfoFile
+	cpuOnlineFile, memInfoFile = filepath.Join(dir, "online"), filepath.Join(dir, "meminfo")
+	t.Cleanup(func() {
+		cpuOnlineFile, memInfoFile = oldCPUOnlineFile, oldMemInfoFile
+	})
+	assert.Nil(t, os.WriteFile(cpuOnlineFile, []byte(cpuOnline+"\n"), 0644))
+	assert.Nil(t, os.WriteFile(memInfoFile, []byte("MemTotal:       "+memTotalKiB+" kB\nMemFree:        1024 kB\n"), 0644))
+}
+
+func TestCalculateMemoryReservedInMiB(t *testing.T) {
+	testCases := []struct {
+		name        string
+		memoryMiB   int64
+		reservedMiB int64
+	}{
+		{
+			name:        "unknown memory",
+			memoryMiB:   0,
+			reservedMiB: 0,
+		},
+		{
+			name:        "memory < 1 GiB",
+			memoryMiB:   512,
+			reservedMiB: 255,
+		},
+		{
+			name:        "memory = 4 GiB",
+			memoryMiB:   4 << 10,
+			reservedMiB: 1024,
+		},
+		{
+			name:        "memory = 16 GiB",
+			memoryMiB:   16 << 10,
+			reservedMiB: 1024 + 819 + 819,
+		},
+		{
+			name:        "memory = 1 TiB",
+			memoryMiB:   1 << 20,
+			reservedMiB: 27893,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.reservedMiB, calculateMemoryReservedInMiB(tc.memoryMiB))
+		})
+	}
+}
+
+func TestKubeletArgs(t *testing.T) {
+	// 64 CPUs and 1 TiB
+	fakeNodeSize(t, "0-31,32-63", "1073741824")
+
+	c := NewHarvesterConfig()
+	assert.Equal(t, "system-reserved=cpu=504m,memory=11157Mi", c.GetSystemReserved())
+	assert.Equal(t, "kube-reserved=cpu=756m,memory=16735Mi", c.GetKubeReserved())
+	assert.Equal(t, "eviction-hard=imagefs.available<15%,memory.available<100Mi,nodefs.available<10%,nodefs.inodesFree<5%", c.GetEvictionHard())
+
+	c.OS.Kubelet = KubeletConfig{
+		MaxPods:        110,
+		SystemReserved: map[string]string{"memory": "32Gi", "ephemeral-storage": "20Gi"},
+		EvictionHard:   map[string]string{"memory.available": "5%"},
+	}
+	args, err := c.GetKubeletArgs()
+	assert.Nil(t, err)
+	assert.Contains(t, args, "max-pods=110")
+	assert.Equal(t, "system-reserved=cpu=183m,memory=32Gi,ephemeral-storage=20Gi", c.GetSystemReserved())
+	assert.Equal(t, "eviction-hard=imagefs.available<15%,memory.available<5%,nodefs.available<10%,nodefs.inodesFree<5%", c.GetEvictionHard())
+}
+
+func TestValidateKubeletConfig(t *testing.T) {
+	testCases := []struct {
+		name    string
+		kubelet KubeletConfig
+		errMsg  string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "reservations and thresholds",
+			kubelet: KubeletConfig{
+				MaxPods:        250,
+				SystemReserved: map[string]string{"cpu": "1.5", "memory": "8Gi"},
+				KubeReserved:   map[string]string{"ephemeral-storage": "10G"},
+				EvictionHard:   map[string]string{"memory.available": "2Gi", "nodefs.available": "5%"},
+			},
+		},
+		{
+			name:    "unknown resource",
+			kubelet: KubeletConfig{KubeReserved: map[string]string{"gpu": "1"}},
+			errMsg:  "os.kubelet.kubeReserved.gpu must be one of cpu, memory, ephemeral-storage",
+		},
+		{
+			name:    "not a quantity",
+			kubelet: KubeletConfig{SystemReserved: map[string]string{"memory": "8 GB"}},
+			errMsg:  `os.kubelet.systemReserved.memory is not a quantity: "8 GB"`,
+		},
+		{
+			name:    "unknown signal",
+			kubelet: KubeletConfig{EvictionHard: map[string]string{"memory.free": "1Gi"}},
+			errMsg:  "os.kubelet.evictionHard.memory.free is not an eviction signal",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateKubeletConfig(tc.kubelet)
+			if tc.errMsg != "" {
+				assert.EqualError(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+
+	yipSchema "github.com/rancher/yip/pkg/schema"
+)
+
+const (
+	zoneinfoDir      = "/usr/share/zoneinfo"
+	localtimeFile    = "/etc/localtime"
+	localeConfFile   = "/etc/locale.conf"
+	vconsoleConfFile = "/etc/vconsole.conf"
+)
+
+var (
+	timezoneRegexp = regexp.MustCompile(`^[A-Za-z0-9_+-]+(/[A-Za-z0-9_+-]+)*$`)
+	localeRegexp   = regexp.MustCompile(`^[A-Za-z0-9_]+(\.[A-Za-z0-9-]+)?(@[A-Za-z0-9]+)?$`)
+	keymapRegexp   = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// ValidateLocalization checks the timezone, locale and keymap are names. The
+// console checks they are known to the system it runs on.
+func ValidateLocalization(os OS) error {
+	for _, field := range []struct {
+		name   string
+		value  string
+		regexp *regexp.Regexp
+	}{
+		{"timezone", os.Timezone, timezoneRegexp},
+		{"locale", os.Locale, localeRegexp},
+		{"keymap", os.Keymap, keymapRegexp},
+	} {
+		if field.value != "" && !field.regexp.MatchString(field.value) {
+			return fmt.Errorf("os.%s is invalid: %q", field.name, field.value)
+		}
+	}
+	return nil
+}
+
+// addLocalization sets the timezone, the locale and the console keymap at
+// every boot, since /etc isn't persistent.
+func addLocalization(config *HarvesterConfig, stage *yipSchema.Stage) {
+	if config.OS.Timezone != "" {
+		stage.Commands = append(stage.Commands, fmt.Sprintf("ln -sf %s %s", filepath.Join(zoneinfoDir, config.OS.Timezone), localtimeFile))
+	}
+	for _, file := range []struct {
+		path  string
+		key   string
+		value string
+	}{
+		{localeConfFile, "LANG", config.OS.Locale},
+		{vconsoleConfFile, "KEYMAP", config.OS.Keymap},
+	} {
+		if file.value == "" {
+			continue
+		}
+		stage.Files = append(stage.Files, yipSchema.File{
+			Path:        file.path,
+			Content:     file.key + "=" + file.value + "\n",
+			Permissions: 0644,
+			Owner:       0,
+			Group:       0,
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+func TestValidateLocalization(t *testing.T) {
+	testCases := []struct {
+		name   string
+		os     OS
+		errMsg string
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name: "names",
+			os:   OS{Timezone: "America/Argentina/Buenos_Aires", Locale: "sr_RS.UTF-8@latin", Keymap: "de-latin1-nodeadkeys"},
+		},
+		{
+			name: "UTC offset",
+			os:   OS{Timezone: "Etc/GMT+8", Locale: "C.UTF-8", Keymap: "jp106"},
+		},
+		{
+			name:   "timezone out of zoneinfo",
+			os:     OS{Timezone: "../../etc/shadow"},
+			errMsg: `os.timezone is invalid: "../../etc/shadow"`,
+		},
+		{
+			name:   "locale with a space",
+			os:     OS{Locale: "en_US UTF-8"},
+			errMsg: `os.locale is invalid: "en_US UTF-8"`,
+		},
+		{
+			name:   "keymap with a command",
+			os:     OS{Keymap: "us;reboot"},
+			errMsg: `os.keymap is invalid: "us;reboot"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLocalization(tc.os)
+			if tc.errMsg != "" {
+				assert.EqualError(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestConvertToCos_Localization(t *testing.T) {
+	conf, err := LoadHarvesterConfig(util.LoadFixture(t, "harvester-config.yaml"))
+	assert.NoError(t, err)
+	conf.OS.Timezone = "Asia/Tokyo"
+	conf.OS.Locale = "ja_JP.UTF-8"
+	conf.OS.Keymap = "jp106"
+
+	yipConfig, err := ConvertToCOS(conf)
+	assert.NoError(t, err)
+	initramfs := yipConfig.Stages["initramfs"][0]
+	assert.Contains(t, initramfs.Commands, "ln -sf /usr/share/zoneinfo/Asia/Tokyo /etc/localtime")
+	contents := map[string]string{}
+	for _, f := range initramfs.Files {
+		contents[f.Path] = f.Content
+	}
+	assert.Equal(t, "LANG=ja_JP.UTF-8\n", contents[localeConfFile])
+	assert.Equal(t, "KEYMAP=jp106\n", contents[vconsoleConfFile])
+}
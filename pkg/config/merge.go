@@ -0,0 +1,267 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Merge strategies, set per field with the path of its JSON keys in
+// mergeStrategies, e.g. `os.ntpServers: replace`.
+const (
+	// MergeReplace takes the value of the overriding config as a whole.
+	MergeReplace = "replace"
+	// MergeAppendUnique appends the list items not already present. This is
+	// the default for lists.
+	MergeAppendUnique = "append-unique"
+	// MergeDeepMerge merges maps key by key, structs field by field and
+	// lists item by item. This is the default for maps and structs.
+	MergeDeepMerge = "deep-merge"
+)
+
+var mergeStrategies = []string{MergeReplace, MergeAppendUnique, MergeDeepMerge}
+
+type merger struct {
+	strategies map[string]string
+	// override makes non-empty values of src win over those of dst.
+	// Otherwise src only fills in what dst leaves empty.
+	override bool
+
+	// provenance is that of dst, updated with the sources in srcProvenance
+	// of the values taken from src. It is nil if neither config has one.
+	provenance    Provenance
+	srcProvenance Provenance
+}
+
+// Merge merges other into c. Values already set in c are kept.
+func (c *HarvesterConfig) Merge(other HarvesterConfig) error {
+	m := merger{strategies: combineStrategies(other.MergeStrategies, c.MergeStrategies)}
+	return m.mergeConfig(c, &other)
+}
+
+// Overlay merges other into c. Values set in other take precedence, as with
+// a site-wide config overlaid by a per-node one.
+func (c *HarvesterConfig) Overlay(other HarvesterConfig) error {
+	m := merger{strategies: combineStrategies(c.MergeStrategies, other.MergeStrategies), override: true}
+	return m.mergeConfig(c, &other)
+}
+
+func (m merger) mergeConfig(dst, src *HarvesterConfig) error {
+	if dst.Provenance != nil || src.Provenance != nil {
+		m.provenance = dst.Provenance.clone()
+		if m.provenance == nil {
+			m.provenance = Provenance{}
+		}
+		m.srcProvenance = src.Provenance
+	}
+	if err := m.merge(reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem(), ""); err != nil {
+		return err
+	}
+	dst.Provenance = m.provenance
+	return nil
+}
+
+// took records that the value at path was taken from src.
+func (m merger) took(path string) {
+	if m.provenance != nil {
+		m.provenance.copyFrom(m.srcProvenance, path)
+	}
+}
+
+// appended records that items of src were appended to the list at path.
+func (m merger) appended(path string) {
+	if m.provenance != nil {
+		m.provenance.add(path, m.srcProvenance.Lookup(path))
+	}
+}
+
+// combineStrategies returns the strategies of both configs, with the
+// latter taking precedence.
+func combineStrategies(low, high map[string]string) map[string]string {
+	if len(low) == 0 && len(high) == 0 {
+		return nil
+	}
+	combined := make(map[string]string, len(low)+len(high))
+	for path, strategy := range low {
+		combined[path] = strategy
+	}
+	for path, strategy := range high {
+		combined[path] = strategy
+	}
+	return combined
+}
+
+// ValidateMergeStrategies checks that strategies only name known strategies
+// for fields that exist and can be merged that way.
+func ValidateMergeStrategies(strategies map[string]string) error {
+	paths := make([]string, 0, len(strategies))
+	for path := range strategies {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		strategy := strategies[path]
+		t, ok := fieldTypeByPath(reflect.TypeOf(HarvesterConfig{}), path)
+		if !ok {
+			return fmt.Errorf("unknown field %q in merge strategies", path)
+		}
+		switch strategy {
+		case MergeReplace:
+		case MergeAppendUnique:
+			if t.Kind() != reflect.Slice {
+				return fmt.Errorf("merge strategy %q of %s only applies to lists", strategy, path)
+			}
+		case MergeDeepMerge:
+			if k := t.Kind(); k != reflect.Slice && k != reflect.Map && k != reflect.Struct {
+				return fmt.Errorf("merge strategy %q of %s only applies to lists, maps and objects", strategy, path)
+			}
+		default:
+			return fmt.Errorf("unknown merge strategy %q of %s, must be one of %s", strategy, path, strings.Join(mergeStrategies, ", "))
+		}
+	}
+	return nil
+}
+
+func fieldTypeByPath(t reflect.Type, path string) (reflect.Type, bool) {
+	for _, name := range strings.Split(path, ".") {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, false
+		}
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			if jsonName(t.Field(i)) == name {
+				t = t.Field(i).Type
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return t, true
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return name
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func (m merger) strategy(path string, t reflect.Type) string {
+	if strategy, ok := m.strategies[path]; ok {
+		return strategy
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		return MergeAppendUnique
+	case reflect.Map, reflect.Struct:
+		return MergeDeepMerge
+	default:
+		return MergeReplace
+	}
+}
+
+func (m merger) merge(dst, src reflect.Value, path string) error {
+	if src.IsZero() {
+		return nil
+	}
+	if dst.IsZero() {
+		dst.Set(src)
+		m.took(path)
+		return nil
+	}
+
+	switch m.strategy(path, dst.Type()) {
+	case MergeReplace:
+		if m.override {
+			dst.Set(src)
+			m.took(path)
+		}
+		return nil
+	case MergeAppendUnique:
+		if dst.Kind() != reflect.Slice {
+			return fmt.Errorf("merge strategy %q of %s only applies to lists", MergeAppendUnique, path)
+		}
+		merged := reflect.AppendSlice(reflect.MakeSlice(dst.Type(), 0, dst.Len()+src.Len()), dst)
+		for i := 0; i < src.Len(); i++ {
+			if !containsValue(merged, src.Index(i)) {
+				merged = reflect.Append(merged, src.Index(i))
+			}
+		}
+		if merged.Len() > dst.Len() {
+			m.appended(path)
+		}
+		dst.Set(merged)
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Struct:
+		for i := 0; i < dst.NumField(); i++ {
+			field := dst.Type().Field(i)
+			if !field.IsExported() || field.Type == provenanceType {
+				continue
+			}
+			if err := m.merge(dst.Field(i), src.Field(i), joinPath(path, jsonName(field))); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		merged := reflect.MakeMapWithSize(dst.Type(), dst.Len())
+		for iter := dst.MapRange(); iter.Next(); {
+			merged.SetMapIndex(iter.Key(), iter.Value())
+		}
+		for iter := src.MapRange(); iter.Next(); {
+			existing := merged.MapIndex(iter.Key())
+			if !existing.IsValid() {
+				merged.SetMapIndex(iter.Key(), iter.Value())
+				m.took(fmt.Sprintf("%s[%v]", path, iter.Key()))
+				continue
+			}
+			// map values aren't addressable, merge into a copy
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			elem.Set(existing)
+			if err := m.merge(elem, iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key())); err != nil {
+				return err
+			}
+			merged.SetMapIndex(iter.Key(), elem)
+		}
+		dst.Set(merged)
+	case reflect.Slice:
+		merged := reflect.AppendSlice(reflect.MakeSlice(dst.Type(), 0, dst.Len()), dst)
+		for i := 0; i < src.Len(); i++ {
+			if i >= merged.Len() {
+				merged = reflect.Append(merged, src.Index(i))
+				m.took(fmt.Sprintf("%s[%d]", path, i))
+				continue
+			}
+			if err := m.merge(merged.Index(i), src.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(merged)
+	default:
+		return fmt.Errorf("merge strategy %q of %s only applies to lists, maps and objects", MergeDeepMerge, path)
+	}
+	return nil
+}
+
+func containsValue(list, v reflect.Value) bool {
+	for i := 0; i < list.Len(); i++ {
+		if reflect.DeepEqual(list.Index(i).Interface(), v.Interface()) {
+			return true
+		}
+	}
+	return false
+}
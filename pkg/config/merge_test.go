@@ -0,0 +1,132 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarvesterConfigMerge_NoDuplicates(t *testing.T) {
+	conf := NewHarvesterConfig()
+	conf.NTPServers = []string{"0.suse.pool.ntp.org", "1.suse.pool.ntp.org"}
+	conf.SSHAuthorizedKeys = []string{"ssh-ed25519 AAAA"}
+
+	otherConf := NewHarvesterConfig()
+	otherConf.NTPServers = []string{"1.suse.pool.ntp.org", "2.suse.pool.ntp.org"}
+	otherConf.SSHAuthorizedKeys = []string{"ssh-ed25519 AAAA"}
+
+	require.NoError(t, conf.Merge(*otherConf))
+	assert.Equal(t, []string{"0.suse.pool.ntp.org", "1.suse.pool.ntp.org", "2.suse.pool.ntp.org"}, conf.NTPServers)
+	assert.Equal(t, []string{"ssh-ed25519 AAAA"}, conf.SSHAuthorizedKeys)
+}
+
+func TestHarvesterConfigOverlay(t *testing.T) {
+	testCases := []struct {
+		name       string
+		base       *HarvesterConfig
+		overlay    *HarvesterConfig
+		strategies map[string]string
+		assertion  func(t *testing.T, c *HarvesterConfig)
+	}{
+		{
+			name: "scalars are overridden",
+			base: &HarvesterConfig{OS: OS{Hostname: "base", Password: "base"}},
+			overlay: &HarvesterConfig{
+				OS: OS{Hostname: "node"},
+			},
+			assertion: func(t *testing.T, c *HarvesterConfig) {
+				assert.Equal(t, "node", c.Hostname)
+				assert.Equal(t, "base", c.Password)
+			},
+		},
+		{
+			name:    "lists are appended without duplicates",
+			base:    &HarvesterConfig{OS: OS{NTPServers: []string{"a", "b"}}},
+			overlay: &HarvesterConfig{OS: OS{NTPServers: []string{"b", "c"}}},
+			assertion: func(t *testing.T, c *HarvesterConfig) {
+				assert.Equal(t, []string{"a", "b", "c"}, c.NTPServers)
+			},
+		},
+		{
+			name:       "lists are replaced",
+			base:       &HarvesterConfig{OS: OS{NTPServers: []string{"a", "b"}}},
+			overlay:    &HarvesterConfig{OS: OS{NTPServers: []string{"c"}}},
+			strategies: map[string]string{"os.ntpServers": MergeReplace},
+			assertion: func(t *testing.T, c *HarvesterConfig) {
+				assert.Equal(t, []string{"c"}, c.NTPServers)
+			},
+		},
+		{
+			name: "maps are deep merged",
+			base: &HarvesterConfig{Install: Install{Addons: map[string]Addon{
+				"rancher-logging":    {Enabled: true, ValuesContent: "base"},
+				"rancher-monitoring": {Enabled: true},
+			}}},
+			overlay: &HarvesterConfig{Install: Install{Addons: map[string]Addon{
+				"rancher-logging": {ValuesContent: "node"},
+			}}},
+			assertion: func(t *testing.T, c *HarvesterConfig) {
+				assert.Equal(t, Addon{Enabled: true, ValuesContent: "node"}, c.Addons["rancher-logging"])
+				assert.Equal(t, Addon{Enabled: true}, c.Addons["rancher-monitoring"])
+			},
+		},
+		{
+			name:       "maps are replaced",
+			base:       &HarvesterConfig{OS: OS{Labels: map[string]string{"rack": "1", "zone": "a"}}},
+			overlay:    &HarvesterConfig{OS: OS{Labels: map[string]string{"rack": "2"}}},
+			strategies: map[string]string{"os.labels": MergeReplace},
+			assertion: func(t *testing.T, c *HarvesterConfig) {
+				assert.Equal(t, map[string]string{"rack": "2"}, c.Labels)
+			},
+		},
+		{
+			name: "lists are deep merged item by item",
+			base: &HarvesterConfig{Install: Install{Webhooks: []Webhook{
+				{Event: "STARTED", URL: "http://base"},
+			}}},
+			overlay: &HarvesterConfig{Install: Install{Webhooks: []Webhook{
+				{URL: "http://node"},
+				{Event: "FAILED", URL: "http://node"},
+			}}},
+			strategies: map[string]string{"install.webhooks": MergeDeepMerge},
+			assertion: func(t *testing.T, c *HarvesterConfig) {
+				assert.Equal(t, []Webhook{
+					{Event: "STARTED", URL: "http://node"},
+					{Event: "FAILED", URL: "http://node"},
+				}, c.Webhooks)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.overlay.MergeStrategies = tc.strategies
+			require.NoError(t, tc.base.Overlay(*tc.overlay))
+			tc.assertion(t, tc.base)
+		})
+	}
+}
+
+func TestValidateMergeStrategies(t *testing.T) {
+	testCases := []struct {
+		strategies map[string]string
+		expectErr  bool
+	}{
+		{strategies: nil},
+		{strategies: map[string]string{"os.ntpServers": MergeReplace, "install.addons": MergeDeepMerge}},
+		{strategies: map[string]string{"os.sshAuthorizedKeys": MergeAppendUnique}},
+		{strategies: map[string]string{"os.hostname": MergeReplace}},
+		{strategies: map[string]string{"os.hostname": MergeAppendUnique}, expectErr: true},
+		{strategies: map[string]string{"os.hostname": MergeDeepMerge}, expectErr: true},
+		{strategies: map[string]string{"os.ntpServers": "prepend"}, expectErr: true},
+		{strategies: map[string]string{"os.foo": MergeReplace}, expectErr: true},
+	}
+	for _, tc := range testCases {
+		err := ValidateMergeStrategies(tc.strategies)
+		if tc.expectErr {
+			assert.Error(t, err, tc.strategies)
+		} else {
+			assert.NoError(t, err, tc.strategies)
+		}
+	}
+}
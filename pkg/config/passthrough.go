@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	yipSchema "github.com/rancher/yip/pkg/schema"
+)
+
+const (
+	vfioPCIDriver  = "vfio-pci"
+	pciDeviceDir   = "/sys/bus/pci/devices/"
+	sriovRulesFile = "/etc/udev/rules.d/81-harvester-sriov.rules"
+	// sriovRuleFmt creates the VFs once the NIC is added and named, after
+	// 80-net-setup-link.rules and before NetworkManager manages it, if the
+	// NIC supports SR-IOV.
+	sriovRuleFmt = `ACTION=="add", SUBSYSTEM=="net", NAME=="%s", TEST=="device/sriov_numvfs", ATTR{device/sriov_numvfs}="%d"` + "\n"
+)
+
+var (
+	pciIDRegexp      = regexp.MustCompile(`^[0-9a-f]{4}:[0-9a-f]{4}$`)
+	pciAddressRegexp = regexp.MustCompile(`^[0-9a-f]{4}:[0-9a-f]{2}:[0-9a-f]{2}\.[0-7]$`)
+	ifaceNameRegexp  = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,15}$`)
+
+	// iommuKernelArgs turn on the IOMMU in passthrough mode, they are in
+	// bootargs.cfg.
+	iommuKernelArgs = []string{"intel_iommu=on", "amd_iommu=on", "iommu=pt"}
+)
+
+// PassthroughConfig prepares PCI devices to be passed through to VMs from
+// the first boot of the node.
+type PassthroughConfig struct {
+	// VFIOIDs are the vendor:device IDs, such as 10de:1db4, of the devices
+	// bound to vfio-pci.
+	VFIOIDs []string `json:"vfioIds,omitempty"`
+	// VFIOAddresses are the PCI addresses, such as 0000:3b:00.0, of the
+	// devices bound to vfio-pci.
+	VFIOAddresses []string `json:"vfioAddresses,omitempty"`
+	// SRIOV are the virtual functions created on NICs at every boot.
+	SRIOV []SRIOVConfig `json:"sriov,omitempty"`
+}
+
+// SRIOVConfig is a number of virtual functions of a NIC.
+type SRIOVConfig struct {
+	Interface string `json:"interface"`
+	NumVFs    int    `json:"numVfs"`
+}
+
+func (p PassthroughConfig) vfio() bool {
+	return len(p.VFIOIDs) > 0 || len(p.VFIOAddresses) > 0
+}
+
+// Enabled tells if any device is prepared for passthrough.
+func (p PassthroughConfig) Enabled() bool {
+	return p.vfio() || len(p.SRIOV) > 0
+}
+
+// ValidatePassthroughConfig checks the IDs, addresses and NICs, and that the
+// IOMMU is kept on for them.
+func ValidatePassthroughConfig(c *HarvesterConfig) error {
+	p := c.Passthrough
+	for _, field := range []struct {
+		name   string
+		values []string
+		regexp *regexp.Regexp
+	}{{"vfioIds", p.VFIOIDs, pciIDRegexp}, {"vfioAddresses", p.VFIOAddresses, pciAddressRegexp}} {
+		for i, value := range field.values {
+			if !field.regexp.MatchString(value) {
+				return fmt.Errorf("passthrough.%s[%d] is invalid: %q", field.name, i, value)
+			}
+			if slices.Contains(field.values[:i], value) {
+				return fmt.Errorf("passthrough.%s[%d] is a duplicate: %q", field.name, i, value)
+			}
+		}
+	}
+	for i, sriov := range p.SRIOV {
+		if !ifaceNameRegexp.MatchString(sriov.Interface) {
+			return fmt.Errorf("passthrough.sriov[%d].interface is not an interface name: %q", i, sriov.Interface)
+		}
+		if sriov.NumVFs <= 0 {
+			return fmt.Errorf("passthrough.sriov[%d].numVfs must be positive", i)
+		}
+		if slices.ContainsFunc(p.SRIOV[:i], func(s SRIOVConfig) bool { return s.Interface == sriov.Interface }) {
+			return fmt.Errorf("passthrough.sriov[%d] sets the VFs of %s again", i, sriov.Interface)
+		}
+	}
+	if !p.Enabled() {
+		return nil
+	}
+	args := c.KernelArgs()
+	for _, arg := range iommuKernelArgs {
+		if !slices.Contains(args, arg) {
+			return errors.New("passthrough needs the IOMMU, kernel arguments " + strings.Join(iommuKernelArgs, " ") + " can't be changed")
+		}
+	}
+	return nil
+}
+
+// passthroughKernelArgs returns the kernel arguments binding devices to
+// vfio-pci, loaded before any other driver.
+func (c *HarvesterConfig) passthroughKernelArgs() []string {
+	p := c.Passthrough
+	if !p.vfio() {
+		return nil
+	}
+	args := []string{"rd.driver.pre=" + vfioPCIDriver}
+	if len(p.VFIOIDs) > 0 {
+		args = append(args, vfioPCIDriver+".ids="+strings.Join(p.VFIOIDs, ","))
+	}
+	return args
+}
+
+// addPassthroughCommands binds the devices at the addresses to vfio-pci at
+// every boot, and writes the udev rules creating the virtual functions once
+// their NICs exist.
+func addPassthroughCommands(config *HarvesterConfig, stage *yipSchema.Stage) {
+	for _, address := range config.Passthrough.VFIOAddresses {
+		device := pciDeviceDir + address
+		stage.Commands = append(stage.Commands, fmt.Sprintf(
+			"echo %s > %s/driver_override; if [ -e %s/driver ]; then echo %s > %s/driver/unbind; fi; echo %s > /sys/bus/pci/drivers_probe",
+			vfioPCIDriver, device, device, address, device, address))
+	}
+	if len(config.Passthrough.SRIOV) == 0 {
+		return
+	}
+	var rules strings.Builder
+	for _, sriov := range config.Passthrough.SRIOV {
+		fmt.Fprintf(&rules, sriovRuleFmt, sriov.Interface, sriov.NumVFs)
+	}
+	stage.Files = append(stage.Files, yipSchema.File{
+		Path:        sriovRulesFile,
+		Content:     rules.String(),
+		Permissions: 0644,
+		Owner:       0,
+		Group:       0,
+	})
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+func TestValidatePassthroughConfig(t *testing.T) {
+	testCases := []struct {
+		name        string
+		passthrough PassthroughConfig
+		kernelArgs  KernelArguments
+		errMsg      string
+	}{
+		{
+			name: "devices and VFs",
+			passthrough: PassthroughConfig{
+				VFIOIDs:       []string{"10de:1db4", "8086:1521"},
+				VFIOAddresses: []string{"0000:3b:00.0"},
+				SRIOV:         []SRIOVConfig{{Interface: "ens1f0", NumVFs: 8}},
+			},
+		},
+		{
+			name:        "invalid ID",
+			passthrough: PassthroughConfig{VFIOIDs: []string{"10DE-1DB4"}},
+			errMsg:      `passthrough.vfioIds[0] is invalid: "10DE-1DB4"`,
+		},
+		{
+			name:        "duplicate address",
+			passthrough: PassthroughConfig{VFIOAddresses: []string{"0000:3b:00.0", "0000:3b:00.0"}},
+			errMsg:      `passthrough.vfioAddresses[1] is a duplicate: "0000:3b:00.0"`,
+		},
+		{
+			name:        "not an interface",
+			passthrough: PassthroughConfig{SRIOV: []SRIOVConfig{{Interface: "ens1; reboot", NumVFs: 8}}},
+			errMsg:      `passthrough.sriov[0].interface is not an interface name: "ens1; reboot"`,
+		},
+		{
+			name:        "VFs of a NIC twice",
+			passthrough: PassthroughConfig{SRIOV: []SRIOVConfig{{Interface: "ens1f0", NumVFs: 8}, {Interface: "ens1f0", NumVFs: 4}}},
+			errMsg:      "passthrough.sriov[1] sets the VFs of ens1f0 again",
+		},
+		{
+			name:        "IOMMU turned off",
+			passthrough: PassthroughConfig{VFIOIDs: []string{"10de:1db4"}},
+			kernelArgs:  KernelArguments{Add: []string{"iommu=off"}},
+			errMsg:      "passthrough needs the IOMMU, kernel arguments intel_iommu=on amd_iommu=on iommu=pt can't be changed",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewHarvesterConfig()
+			c.Passthrough = tc.passthrough
+			c.OS.KernelArguments = tc.kernelArgs
+			err := ValidatePassthroughConfig(c)
+			if tc.errMsg != "" {
+				assert.EqualError(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestConvertToCos_Passthrough(t *testing.T) {
+	conf, err := LoadHarvesterConfig(util.LoadFixture(t, "harvester-config.yaml"))
+	assert.NoError(t, err)
+	conf.Passthrough = PassthroughConfig{
+		VFIOIDs:       []string{"10de:1db4"},
+		VFIOAddresses: []string{"0000:3b:00.0"},
+		SRIOV:         []SRIOVConfig{{Interface: "ens1f0", NumVFs: 8}},
+	}
+
+	assert.Equal(t, []string{"multipath=off", "rd.driver.pre=vfio-pci", "vfio-pci.ids=10de:1db4"}, conf.AdditionalKernelArgs())
+
+	yipConfig, err := ConvertToCOS(conf)
+	assert.NoError(t, err)
+	commands := yipConfig.Stages["initramfs"][0].Commands
+	assert.Contains(t, commands, "echo vfio-pci > /sys/bus/pci/devices/0000:3b:00.0/driver_override; "+
+		"if [ -e /sys/bus/pci/devices/0000:3b:00.0/driver ]; then echo 0000:3b:00.0 > /sys/bus/pci/devices/0000:3b:00.0/driver/unbind; fi; "+
+		"echo 0000:3b:00.0 > /sys/bus/pci/drivers_probe")
+	var rules string
+	for _, file := range yipConfig.Stages["initramfs"][0].Files {
+		if file.Path == "/etc/udev/rules.d/81-harvester-sriov.rules" {
+			rules = file.Content
+		}
+	}
+	assert.Equal(t, `ACTION=="add", SUBSYSTEM=="net", NAME=="ens1f0", TEST=="device/sriov_numvfs", ATTR{device/sriov_numvfs}="8"`+"\n", rules)
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+// IsPasswordHashed reports whether the OS password is a crypt hash, going by
+// PasswordFormat if it's set.
+func (o *OS) IsPasswordHashed() bool {
+	switch o.PasswordFormat {
+	case PasswordFormatHash:
+		return true
+	case PasswordFormatPlaintext:
+		return false
+	default:
+		return util.IsPasswordHash(o.Password)
+	}
+}
+
+// HashPassword replaces a plain text OS password with its crypt hash, so
+// that what gets written to the system doesn't depend on how later tools
+// tell passwords and hashes apart.
+func (c *HarvesterConfig) HashPassword() error {
+	if c.OS.Password == "" {
+		return nil
+	}
+	if _, ok := c.SecretReferences[secretPathPassword]; ok {
+		// the persisted config gets the reference back, and with it the
+		// format of what the reference points to
+		c.SecretReferences[secretPathPasswordFormat] = c.OS.PasswordFormat
+	}
+	if !c.OS.IsPasswordHashed() {
+		hash, err := util.HashPassword(c.OS.Password, c.OS.PasswordHashAlgorithm)
+		if err != nil {
+			return fmt.Errorf("fail to hash OS password: %w", err)
+		}
+		c.OS.Password = hash
+	}
+	c.OS.PasswordFormat = PasswordFormatHash
+	return nil
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+const testPasswordHash = "$6$MxtBRHZbMLzf2vrg$tLa71bzOYDLZTMzQT1wWtYQAK3wS0mqiaOkppyOUWwo8AgsBqgVvo5b2wsgkrbtYhZlJXAK9bzPudRAxOZn1H1"
+
+func TestHarvesterConfig_HashPassword(t *testing.T) {
+	testCases := []struct {
+		name      string
+		os        OS
+		hashed    bool
+		expectErr bool
+	}{
+		{
+			name: "empty password",
+			os:   OS{},
+		},
+		{
+			name:   "guess hash",
+			os:     OS{Password: testPasswordHash},
+			hashed: true,
+		},
+		{
+			name:   "explicit hash",
+			os:     OS{Password: testPasswordHash, PasswordFormat: PasswordFormatHash},
+			hashed: true,
+		},
+		{
+			name: "guess plain text",
+			os:   OS{Password: "p@ssw0rd"},
+		},
+		{
+			name: "explicit plain text that looks like a hash",
+			os:   OS{Password: testPasswordHash, PasswordFormat: PasswordFormatPlaintext},
+		},
+		{
+			name: "bcrypt",
+			os:   OS{Password: "p@ssw0rd", PasswordFormat: PasswordFormatPlaintext, PasswordHashAlgorithm: util.PasswordHashBcrypt},
+		},
+		{
+			name:      "unknown algorithm",
+			os:        OS{Password: "p@ssw0rd", PasswordHashAlgorithm: "md5"},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewHarvesterConfig()
+			c.OS = tc.os
+			err := c.HashPassword()
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			switch {
+			case tc.os.Password == "":
+				assert.Empty(t, c.OS.Password)
+			case tc.hashed:
+				assert.Equal(t, tc.os.Password, c.OS.Password)
+				assert.Equal(t, PasswordFormatHash, c.OS.PasswordFormat)
+			default:
+				assert.True(t, util.VerifyPasswordHash(tc.os.Password, c.OS.Password))
+				assert.Equal(t, PasswordFormatHash, c.OS.PasswordFormat)
+			}
+		})
+	}
+}
+
+func TestHarvesterConfig_HashPasswordKeepsReference(t *testing.T) {
+	t.Setenv("TEST_OS_PASSWORD", "p@ssw0rd")
+	c := NewHarvesterConfig()
+	c.OS.Password = "env:TEST_OS_PASSWORD"
+	c.OS.PasswordFormat = PasswordFormatPlaintext
+	require.NoError(t, c.ResolveSecretReferences(nil))
+	require.NoError(t, c.HashPassword())
+	assert.True(t, util.VerifyPasswordHash("p@ssw0rd", c.OS.Password))
+
+	persisted, err := c.WithSecretReferences()
+	require.NoError(t, err)
+	assert.Equal(t, "env:TEST_OS_PASSWORD", persisted.OS.Password)
+	assert.Equal(t, PasswordFormatPlaintext, persisted.OS.PasswordFormat)
+}
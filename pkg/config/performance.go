@@ -0,0 +1,229 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	yipSchema "github.com/rancher/yip/pkg/schema"
+)
+
+const numaHugepagesFile = "/sys/devices/system/node/node%d/hugepages/hugepages-%dkB/nr_hugepages"
+
+var (
+	// hugepageSizesKiB are the hugepage sizes of x86_64 and aarch64 with 4K
+	// pages.
+	hugepageSizesKiB = map[string]int{"2M": 2048, "1G": 1048576}
+
+	cpuListRegexp         = regexp.MustCompile(`^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$`)
+	isolCPUsFlagRegexp    = regexp.MustCompile(`^(nohz|domain|managed_irq)$`)
+	cpuManagerPolicies    = []string{"none", "static"}
+	topologyManagerPolicy = []string{"none", "best-effort", "restricted", "single-numa-node"}
+	topologyManagerScopes = []string{"container", "pod"}
+)
+
+// PerformanceConfig tunes the node for latency-sensitive VMs, consistently on
+// the kernel command line and in kubelet.
+type PerformanceConfig struct {
+	Hugepages HugepagesConfig `json:"hugepages,omitempty"`
+	// IsolCPUs is the isolcpus kernel argument, a CPU list optionally after
+	// flags, e.g. "managed_irq,domain,2-15".
+	IsolCPUs string `json:"isolcpus,omitempty"`
+	// NohzFull and RCUNocbs are the CPU lists of the nohz_full and
+	// rcu_nocbs kernel arguments.
+	NohzFull string `json:"nohzFull,omitempty"`
+	RCUNocbs string `json:"rcuNocbs,omitempty"`
+	// ReservedCPUs is the CPU list kubelet keeps for the system and the
+	// Kubernetes daemons, instead of shares of all CPUs.
+	ReservedCPUs string `json:"reservedCpus,omitempty"`
+	// CPUManagerPolicy is none or static.
+	CPUManagerPolicy string `json:"cpuManagerPolicy,omitempty"`
+	// TopologyManagerPolicy is none, best-effort, restricted or
+	// single-numa-node, and TopologyManagerScope container or pod.
+	TopologyManagerPolicy string `json:"topologyManagerPolicy,omitempty"`
+	TopologyManagerScope  string `json:"topologyManagerScope,omitempty"`
+}
+
+// HugepagesConfig are the hugepages allocated at boot.
+type HugepagesConfig struct {
+	// DefaultSize is 2M or 1G.
+	DefaultSize string          `json:"defaultSize,omitempty"`
+	Pages       []HugepageCount `json:"pages,omitempty"`
+}
+
+// HugepageCount is a number of hugepages of a size, on a NUMA node or spread
+// across all of them.
+type HugepageCount struct {
+	Size     string `json:"size"`
+	Count    int    `json:"count"`
+	NUMANode *int   `json:"numaNode,omitempty"`
+}
+
+// parseCPUList returns the CPUs of a list such as "0-3,8".
+func parseCPUList(list string) ([]int, error) {
+	if !cpuListRegexp.MatchString(list) {
+		return nil, fmt.Errorf("not a CPU list: %q", list)
+	}
+	var cpus []int
+	for _, cpuRange := range strings.Split(list, ",") {
+		first, last, found := strings.Cut(cpuRange, "-")
+		if !found {
+			last = first
+		}
+		from, _ := strconv.Atoi(first)
+		to, _ := strconv.Atoi(last)
+		if to < from {
+			return nil, fmt.Errorf("not a CPU list: %q", list)
+		}
+		for cpu := from; cpu <= to; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// isolatedCPUList returns the CPU list of isolcpus, without its flags.
+func isolatedCPUList(isolCPUs string) (string, error) {
+	parts := strings.Split(isolCPUs, ",")
+	for i, part := range parts {
+		if !isolCPUsFlagRegexp.MatchString(part) {
+			return strings.Join(parts[i:], ","), nil
+		}
+	}
+	return "", fmt.Errorf("not a CPU list: %q", isolCPUs)
+}
+
+// ValidatePerformanceConfig checks the hugepages, the CPU lists and the
+// policies, and that kubelet doesn't reserve isolated CPUs.
+func ValidatePerformanceConfig(p PerformanceConfig) error {
+	if size := p.Hugepages.DefaultSize; size != "" {
+		if _, ok := hugepageSizesKiB[size]; !ok {
+			return fmt.Errorf("performance.hugepages.defaultSize must be 2M or 1G: %q", size)
+		}
+	}
+	type hugepagesKey struct {
+		size string
+		node int
+	}
+	var seen []hugepagesKey
+	for i, pages := range p.Hugepages.Pages {
+		if _, ok := hugepageSizesKiB[pages.Size]; !ok {
+			return fmt.Errorf("performance.hugepages.pages[%d].size must be 2M or 1G: %q", i, pages.Size)
+		}
+		if pages.Count <= 0 {
+			return fmt.Errorf("performance.hugepages.pages[%d].count must be positive", i)
+		}
+		key := hugepagesKey{size: pages.Size, node: -1}
+		if pages.NUMANode != nil {
+			if *pages.NUMANode < 0 {
+				return fmt.Errorf("performance.hugepages.pages[%d].numaNode must be positive", i)
+			}
+			key.node = *pages.NUMANode
+		}
+		if slices.Contains(seen, key) {
+			return fmt.Errorf("performance.hugepages.pages[%d] sets the %s hugepages again", i, pages.Size)
+		}
+		seen = append(seen, key)
+	}
+
+	var isolated []int
+	if p.IsolCPUs != "" {
+		list, err := isolatedCPUList(p.IsolCPUs)
+		if err == nil {
+			isolated, err = parseCPUList(list)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid performance.isolcpus: %w", err)
+		}
+	}
+	for _, field := range []struct {
+		name string
+		list string
+	}{{"nohzFull", p.NohzFull}, {"rcuNocbs", p.RCUNocbs}, {"reservedCpus", p.ReservedCPUs}} {
+		if field.list == "" {
+			continue
+		}
+		cpus, err := parseCPUList(field.list)
+		if err != nil {
+			return fmt.Errorf("invalid performance.%s: %w", field.name, err)
+		}
+		if field.name == "reservedCpus" && slices.ContainsFunc(cpus, func(cpu int) bool { return slices.Contains(isolated, cpu) }) {
+			return errors.New("performance.reservedCpus can't be isolated by performance.isolcpus")
+		}
+	}
+
+	for _, field := range []struct {
+		name    string
+		value   string
+		allowed []string
+	}{
+		{"cpuManagerPolicy", p.CPUManagerPolicy, cpuManagerPolicies},
+		{"topologyManagerPolicy", p.TopologyManagerPolicy, topologyManagerPolicy},
+		{"topologyManagerScope", p.TopologyManagerScope, topologyManagerScopes},
+	} {
+		if field.value != "" && !slices.Contains(field.allowed, field.value) {
+			return fmt.Errorf("performance.%s must be one of %s", field.name, strings.Join(field.allowed, ", "))
+		}
+	}
+	return nil
+}
+
+// performanceKernelArgs returns the kernel arguments of the hugepages spread
+// across NUMA nodes and of the CPU isolation.
+func (c *HarvesterConfig) performanceKernelArgs() []string {
+	p := c.Performance
+	var args []string
+	if p.Hugepages.DefaultSize != "" {
+		args = append(args, "default_hugepagesz="+p.Hugepages.DefaultSize)
+	}
+	for _, pages := range p.Hugepages.Pages {
+		if pages.NUMANode == nil {
+			args = append(args, "hugepagesz="+pages.Size, fmt.Sprintf("hugepages=%d", pages.Count))
+		}
+	}
+	for _, arg := range []struct {
+		key   string
+		value string
+	}{{"isolcpus", p.IsolCPUs}, {"nohz_full", p.NohzFull}, {"rcu_nocbs", p.RCUNocbs}} {
+		if arg.value != "" {
+			args = append(args, arg.key+"="+arg.value)
+		}
+	}
+	return args
+}
+
+// performanceKubeletArgs returns the kubelet arguments of the CPU and
+// topology managers.
+func (c *HarvesterConfig) performanceKubeletArgs() []string {
+	p := c.Performance
+	var args []string
+	for _, arg := range []struct {
+		key   string
+		value string
+	}{
+		{"cpu-manager-policy", p.CPUManagerPolicy},
+		{"reserved-cpus", p.ReservedCPUs},
+		{"topology-manager-policy", p.TopologyManagerPolicy},
+		{"topology-manager-scope", p.TopologyManagerScope},
+	} {
+		if arg.value != "" {
+			args = append(args, arg.key+"="+arg.value)
+		}
+	}
+	return args
+}
+
+// addNUMAHugepages allocates the hugepages of NUMA nodes, which the kernel
+// command line can't.
+func addNUMAHugepages(config *HarvesterConfig, stage *yipSchema.Stage) {
+	for _, pages := range config.Performance.Hugepages.Pages {
+		if pages.NUMANode == nil {
+			continue
+		}
+		stage.Commands = append(stage.Commands, fmt.Sprintf("echo %d > "+numaHugepagesFile,
+			pages.Count, *pages.NUMANode, hugepageSizesKiB[pages.Size]))
+	}
+}
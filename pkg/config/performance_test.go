@@ -0,0 +1,116 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+func TestValidatePerformanceConfig(t *testing.T) {
+	node1 := 1
+	testCases := []struct {
+		name        string
+		performance PerformanceConfig
+		errMsg      string
+	}{
+		{
+			name: "NFV profile",
+			performance: PerformanceConfig{
+				Hugepages: HugepagesConfig{
+					DefaultSize: "1G",
+					Pages:       []HugepageCount{{Size: "1G", Count: 16}, {Size: "2M", Count: 512, NUMANode: &node1}},
+				},
+				IsolCPUs:              "managed_irq,domain,2-15",
+				NohzFull:              "2-15",
+				RCUNocbs:              "2-15",
+				ReservedCPUs:          "0-1",
+				CPUManagerPolicy:      "static",
+				TopologyManagerPolicy: "single-numa-node",
+				TopologyManagerScope:  "pod",
+			},
+		},
+		{
+			name:        "unknown default size",
+			performance: PerformanceConfig{Hugepages: HugepagesConfig{DefaultSize: "4M"}},
+			errMsg:      `performance.hugepages.defaultSize must be 2M or 1G: "4M"`,
+		},
+		{
+			name:        "no pages",
+			performance: PerformanceConfig{Hugepages: HugepagesConfig{Pages: []HugepageCount{{Size: "2M"}}}},
+			errMsg:      "performance.hugepages.pages[0].count must be positive",
+		},
+		{
+			name: "pages of a size twice",
+			performance: PerformanceConfig{Hugepages: HugepagesConfig{
+				Pages: []HugepageCount{{Size: "2M", Count: 1, NUMANode: &node1}, {Size: "2M", Count: 2, NUMANode: &node1}},
+			}},
+			errMsg: "performance.hugepages.pages[1] sets the 2M hugepages again",
+		},
+		{
+			name:        "not a CPU list",
+			performance: PerformanceConfig{NohzFull: "2-15,a"},
+			errMsg:      `invalid performance.nohzFull: not a CPU list: "2-15,a"`,
+		},
+		{
+			name:        "reversed range",
+			performance: PerformanceConfig{IsolCPUs: "domain,15-2"},
+			errMsg:      `invalid performance.isolcpus: not a CPU list: "15-2"`,
+		},
+		{
+			name:        "reserved isolated CPUs",
+			performance: PerformanceConfig{IsolCPUs: "1-15", ReservedCPUs: "0-1"},
+			errMsg:      "performance.reservedCpus can't be isolated by performance.isolcpus",
+		},
+		{
+			name:        "unknown policy",
+			performance: PerformanceConfig{TopologyManagerPolicy: "numa"},
+			errMsg:      "performance.topologyManagerPolicy must be one of none, best-effort, restricted, single-numa-node",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidatePerformanceConfig(tc.performance)
+			if tc.errMsg != "" {
+				assert.EqualError(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestConvertToCos_Performance(t *testing.T) {
+	conf, err := LoadHarvesterConfig(util.LoadFixture(t, "harvester-config.yaml"))
+	assert.NoError(t, err)
+	node0 := 0
+	conf.Performance = PerformanceConfig{
+		Hugepages: HugepagesConfig{
+			DefaultSize: "1G",
+			Pages: []HugepageCount{
+				{Size: "1G", Count: 16},
+				{Size: "2M", Count: 16},
+				{Size: "2M", Count: 512, NUMANode: &node0},
+			},
+		},
+		IsolCPUs:         "2-15",
+		CPUManagerPolicy: "static",
+	}
+
+	assert.Nil(t, ValidateKernelArguments(conf))
+	assert.Equal(t, []string{
+		"multipath=off",
+		"default_hugepagesz=1G", "hugepagesz=1G", "hugepages=16", "hugepagesz=2M", "hugepages=16",
+		"isolcpus=2-15",
+	}, conf.AdditionalKernelArgs())
+
+	args, err := conf.GetKubeletArgs()
+	assert.NoError(t, err)
+	assert.Contains(t, args, "cpu-manager-policy=static")
+
+	yipConfig, err := ConvertToCOS(conf)
+	assert.NoError(t, err)
+	assert.Contains(t, yipConfig.Stages["initramfs"][0].Commands,
+		"echo 512 > /sys/devices/system/node/node0/hugepages/hugepages-2048kB/nr_hugepages")
+}
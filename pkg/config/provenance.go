@@ -0,0 +1,294 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of config values recorded in the provenance of a config.
+const (
+	SourceDefault   = "default"
+	SourceCmdline   = "kernel cmdline"
+	SourceTUI       = "TUI input"
+	SourceGenerated = "generated"
+	SourceDHCP      = "DHCP"
+
+	sourceUserDataPrefix = "userdata "
+	sourceRemotePrefix   = "remote "
+	sourceIncludePrefix  = "include "
+	sourceNodePrefix     = "nodes entry "
+
+	sourceUnknown = "unknown"
+)
+
+// SourceUserData is the source of values read from a userdata file.
+func SourceUserData(file string) string {
+	return sourceUserDataPrefix + file
+}
+
+// SourceRemote is the source of values fetched from the config URL.
+func SourceRemote(url string) string {
+	return sourceRemotePrefix + url
+}
+
+// SourceInclude is the source of values from an included config.
+func SourceInclude(ref string) string {
+	return sourceIncludePrefix + ref
+}
+
+// SourceNodeInventory is the source of values from the node inventory entry
+// matched by key.
+func SourceNodeInventory(key string) string {
+	return sourceNodePrefix + key
+}
+
+// Provenance maps config paths, such as "install.managementInterface.vlanId"
+// or "os.labels[rack]", to the source that set the value there. The source
+// of a path without an entry of its own is that of its closest parent, the
+// empty path being the root of the config.
+type Provenance map[string]string
+
+var provenanceType = reflect.TypeOf(Provenance{})
+
+func parentPath(path string) string {
+	if strings.HasSuffix(path, "]") {
+		if i := strings.LastIndex(path, "["); i >= 0 {
+			return path[:i]
+		}
+	}
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+func isBelowPath(path, parent string) bool {
+	if parent == "" {
+		return path != ""
+	}
+	return strings.HasPrefix(path, parent+".") || strings.HasPrefix(path, parent+"[")
+}
+
+// Lookup returns the source of the value at path, or "" if it isn't known.
+func (p Provenance) Lookup(path string) string {
+	for {
+		if source, ok := p[path]; ok {
+			return source
+		}
+		if path == "" {
+			return ""
+		}
+		path = parentPath(path)
+	}
+}
+
+// set records the source of path, forgetting what was recorded below it as
+// the whole value there was set.
+func (p Provenance) set(path, source string) {
+	for k := range p {
+		if isBelowPath(k, path) {
+			delete(p, k)
+		}
+	}
+	p[path] = source
+}
+
+// copyFrom records the sources of the value at path and below as they are
+// recorded in src.
+func (p Provenance) copyFrom(src Provenance, path string) {
+	source := src.Lookup(path)
+	if source == "" {
+		source = sourceUnknown
+	}
+	p.set(path, source)
+	for k, v := range src {
+		if isBelowPath(k, path) {
+			p[k] = v
+		}
+	}
+}
+
+// add records source as one more source of the value at path.
+func (p Provenance) add(path, source string) {
+	existing := p.Lookup(path)
+	switch {
+	case source == "":
+		source = sourceUnknown
+	case existing == "" || existing == source:
+	default:
+		for _, s := range strings.Split(existing, ", ") {
+			if s == source {
+				source = existing
+				break
+			}
+		}
+		if source != existing {
+			source = existing + ", " + source
+		}
+	}
+	p.set(path, source)
+}
+
+func (p Provenance) clone() Provenance {
+	if p == nil {
+		return nil
+	}
+	copied := make(Provenance, len(p))
+	for k, v := range p {
+		copied[k] = v
+	}
+	return copied
+}
+
+// SetSource records that the value at path, and everything below it, was
+// set by source. An empty path means the whole config.
+func (c *HarvesterConfig) SetSource(path, source string) {
+	if c.Provenance == nil {
+		c.Provenance = Provenance{}
+	}
+	c.Provenance.set(path, source)
+}
+
+// CopySource records the source of the value at path as it is recorded in
+// other, for values copied over from other.
+func (c *HarvesterConfig) CopySource(path string, other *HarvesterConfig) {
+	if c.Provenance == nil {
+		c.Provenance = Provenance{}
+	}
+	c.Provenance.copyFrom(other.Provenance, path)
+}
+
+// Clone returns a deep copy of the config, which unlike DeepCopy shares no
+// maps, slices or pointers with it.
+func (c *HarvesterConfig) Clone() *HarvesterConfig {
+	v := redactValue(reflect.ValueOf(c), "", func(s string) string { return s })
+	return v.Interface().(*HarvesterConfig)
+}
+
+// RecordChanges records source as the source of every value that differs
+// from before.
+func (c *HarvesterConfig) RecordChanges(before *HarvesterConfig, source string) {
+	if c.Provenance == nil {
+		c.Provenance = Provenance{}
+	}
+	recordChanges(c.Provenance, reflect.ValueOf(before).Elem(), reflect.ValueOf(c).Elem(), "", source)
+}
+
+func recordChanges(p Provenance, before, after reflect.Value, path, source string) {
+	if reflect.DeepEqual(before.Interface(), after.Interface()) {
+		return
+	}
+	switch after.Kind() {
+	case reflect.Struct:
+		for i := 0; i < after.NumField(); i++ {
+			field := after.Type().Field(i)
+			if !field.IsExported() || field.Type == provenanceType {
+				continue
+			}
+			recordChanges(p, before.Field(i), after.Field(i), joinPath(path, jsonName(field)), source)
+		}
+	case reflect.Map:
+		if before.IsNil() {
+			p.set(path, source)
+			return
+		}
+		for iter := after.MapRange(); iter.Next(); {
+			old := before.MapIndex(iter.Key())
+			if !old.IsValid() || !reflect.DeepEqual(old.Interface(), iter.Value().Interface()) {
+				p.set(fmt.Sprintf("%s[%v]", path, iter.Key()), source)
+			}
+		}
+	default:
+		p.set(path, source)
+	}
+}
+
+// LoadProvenance reads the provenance persisted along with a config.
+func LoadProvenance(yamlBytes []byte) (Provenance, error) {
+	doc := struct {
+		Provenance Provenance `yaml:"provenance"`
+	}{}
+	if err := yaml.Unmarshal(yamlBytes, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal yaml: %v", err)
+	}
+	return doc.Provenance, nil
+}
+
+// Explain lists all values set in the config with their source, one per
+// line. If paths are given, only values at or below them are listed.
+// Sensitive values are redacted.
+func (c *HarvesterConfig) Explain(paths ...string) string {
+	redacted := Redact(*c)
+
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tVALUE\tSOURCE") //nolint:errcheck
+	explainValue(reflect.ValueOf(redacted), "", func(path string, value reflect.Value) {
+		if len(paths) > 0 {
+			matched := false
+			for _, p := range paths {
+				if path == p || isBelowPath(path, p) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return
+			}
+		}
+		source := c.Provenance.Lookup(path)
+		if source == "" {
+			source = sourceUnknown
+		}
+		data, err := json.Marshal(value.Interface())
+		if err != nil {
+			data = []byte(fmt.Sprintf("%v", value.Interface()))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", path, data, source) //nolint:errcheck
+	})
+	w.Flush() //nolint:errcheck
+	return sb.String()
+}
+
+func explainValue(v reflect.Value, path string, leaf func(string, reflect.Value)) {
+	if !v.IsValid() || v.IsZero() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		explainValue(v.Elem(), path, leaf)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name := jsonName(field)
+			if !field.IsExported() || name == "-" || field.Type == provenanceType {
+				continue
+			}
+			explainValue(v.Field(i), joinPath(path, name), leaf)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, k := range keys {
+			explainValue(v.MapIndex(k), fmt.Sprintf("%s[%v]", path, k.Interface()), leaf)
+		}
+	case reflect.Slice:
+		if elem := v.Type().Elem(); elem.Kind() == reflect.Struct || elem.Kind() == reflect.Map {
+			for i := 0; i < v.Len(); i++ {
+				explainValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), leaf)
+			}
+			return
+		}
+		leaf(path, v)
+	default:
+		leaf(path, v)
+	}
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestProvenance_Lookup(t *testing.T) {
+	p := Provenance{
+		"":                    SourceCmdline,
+		"os":                  SourceUserData("/oem/userdata.yaml"),
+		"os.labels[rack]":     SourceTUI,
+		"install.networks[0]": SourceRemote("http://example.com/config.yaml"),
+	}
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "token", expected: SourceCmdline},
+		{path: "os.hostname", expected: SourceUserData("/oem/userdata.yaml")},
+		{path: "os.labels[rack]", expected: SourceTUI},
+		{path: "os.labels[zone]", expected: SourceUserData("/oem/userdata.yaml")},
+		{path: "install.networks[0].method", expected: SourceRemote("http://example.com/config.yaml")},
+		{path: "install.networks[1].method", expected: SourceCmdline},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			assert.Equal(t, tc.expected, p.Lookup(tc.path))
+		})
+	}
+	assert.Equal(t, "", Provenance{}.Lookup("os.hostname"))
+}
+
+func TestHarvesterConfig_MergeProvenance(t *testing.T) {
+	local := NewHarvesterConfig()
+	local.OS.Hostname = "local"
+	local.OS.NTPServers = []string{"ntp1"}
+	local.SetSource("", SourceCmdline)
+
+	remote := NewHarvesterConfig()
+	remote.OS.Hostname = "remote"
+	remote.OS.Password = "p@ssw0rd"
+	remote.OS.NTPServers = []string{"ntp2"}
+	remote.OS.Labels = map[string]string{"rack": "1"}
+	remote.SetSource("", SourceRemote("http://example.com/config.yaml"))
+
+	merged := local.Clone()
+	assert.Nil(t, merged.Merge(*remote))
+	assert.Equal(t, "local", merged.OS.Hostname)
+	assert.Equal(t, SourceCmdline, merged.Provenance.Lookup("os.hostname"))
+	assert.Equal(t, "remote http://example.com/config.yaml", merged.Provenance.Lookup("os.password"))
+	assert.Equal(t, "remote http://example.com/config.yaml", merged.Provenance.Lookup("os.labels[rack]"))
+	assert.Equal(t, "kernel cmdline, remote http://example.com/config.yaml", merged.Provenance.Lookup("os.ntpServers"))
+	// the configs merged are left alone
+	assert.Equal(t, Provenance{"": SourceCmdline}, local.Provenance)
+
+	overlaid := local.Clone()
+	assert.Nil(t, overlaid.Overlay(*remote))
+	assert.Equal(t, "remote", overlaid.OS.Hostname)
+	assert.Equal(t, "remote http://example.com/config.yaml", overlaid.Provenance.Lookup("os.hostname"))
+
+	// no provenance is made up for configs without any
+	plain := NewHarvesterConfig()
+	plain.OS.Hostname = "plain"
+	assert.Nil(t, plain.Merge(HarvesterConfig{Token: "token"}))
+	assert.Nil(t, plain.Provenance)
+}
+
+func TestHarvesterConfig_RecordChanges(t *testing.T) {
+	c := NewHarvesterConfig()
+	c.OS.Hostname = "node"
+	c.OS.Labels = map[string]string{"rack": "1"}
+	c.SetSource("", SourceCmdline)
+
+	before := c.Clone()
+	c.OS.Hostname = "node1"
+	c.OS.Labels["zone"] = "a"
+	c.Install.Device = "/dev/sda"
+	c.RecordChanges(before, SourceTUI)
+
+	assert.Equal(t, SourceTUI, c.Provenance.Lookup("os.hostname"))
+	assert.Equal(t, SourceTUI, c.Provenance.Lookup("os.labels[zone]"))
+	assert.Equal(t, SourceCmdline, c.Provenance.Lookup("os.labels[rack]"))
+	assert.Equal(t, SourceTUI, c.Provenance.Lookup("install.device"))
+	assert.Equal(t, SourceCmdline, c.Provenance.Lookup("token"))
+}
+
+func TestSetConfigDefaultValuesProvenance(t *testing.T) {
+	c := NewHarvesterConfig()
+	c.RuntimeVersion = "v1.30.0+rke2r1"
+	c.SetSource("", SourceUserData("/oem/userdata.yaml"))
+
+	setConfigDefaultValues(c)
+	assert.Equal(t, SourceUserData("/oem/userdata.yaml"), c.Provenance.Lookup("runtimeVersion"))
+	assert.Equal(t, SourceDefault, c.Provenance.Lookup("install.harvester.longhorn.defaultSettings.storageReservedPercentageForDefaultDisk"))
+}
+
+func TestHarvesterConfig_Explain(t *testing.T) {
+	c := NewHarvesterConfig()
+	c.Token = "token"
+	c.OS.Hostname = "node1"
+	c.OS.Labels = map[string]string{"rack": "1"}
+	c.Install.Device = "/dev/sda"
+	c.SetSource("", SourceCmdline)
+	c.SetSource("os.hostname", SourceTUI)
+	c.SetSource("install", SourceRemote("http://example.com/config.yaml"))
+
+	expected := `PATH             VALUE       SOURCE
+token            "***"       kernel cmdline
+os.hostname      "node1"     TUI input
+os.labels[rack]  "1"         kernel cmdline
+install.device   "/dev/sda"  remote http://example.com/config.yaml
+`
+	assert.Equal(t, expected, c.Explain())
+
+	expected = `PATH         VALUE    SOURCE
+os.hostname  "node1"  TUI input
+`
+	assert.Equal(t, expected, c.Explain("os.hostname"))
+
+	c.Provenance = nil
+	assert.Contains(t, c.Explain("token"), "unknown")
+}
+
+func TestLoadProvenance(t *testing.T) {
+	c := NewHarvesterConfig()
+	c.OS.Hostname = "node1"
+	c.SetSource("", SourceCmdline)
+	c.SetSource("os.hostname", SourceTUI)
+
+	data, err := yaml.Marshal(c)
+	assert.Nil(t, err)
+
+	// the persisted provenance doesn't get in the way of loading the config
+	loaded, err := LoadHarvesterConfig(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "node1", loaded.OS.Hostname)
+	assert.Nil(t, loaded.Provenance)
+
+	loaded.Provenance, err = LoadProvenance(data)
+	assert.Nil(t, err)
+	assert.Equal(t, c.Provenance, loaded.Provenance)
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	yipSchema "github.com/rancher/yip/pkg/schema"
+)
+
+const (
+	defaultClusterPodCIDR     = "10.52.0.0/16"
+	defaultClusterServiceCIDR = "10.53.0.0/16"
+
+	// proxyDropInFile is the systemd drop-in putting the proxy into the
+	// environment of a service.
+	proxyDropInFile  = "/etc/systemd/system/%s.service.d/90-harvester-proxy.conf"
+	httpProxySetting = "http-proxy"
+)
+
+// defaultNoProxy are always reached directly.
+var defaultNoProxy = []string{"localhost", "127.0.0.1", "0.0.0.0", ".svc", ".cluster.local"}
+
+// systemdEnvironmentEscaper escapes values of quoted Environment= settings.
+// systemd expands specifiers too, such as in percent-encoded credentials.
+var systemdEnvironmentEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%")
+
+// proxyServices run with the proxy. The containerd of RKE2 gets it from
+// rke2-server or rke2-agent.
+var proxyServices = []string{"rke2-server", "rke2-agent", "rancherd"}
+
+// Proxy is the HTTP proxy the node reaches outside networks through, while
+// installing and once installed. Proxy URLs may carry credentials.
+type Proxy struct {
+	HTTP  string `json:"http,omitempty" sensitive:"true"`
+	HTTPS string `json:"https,omitempty" sensitive:"true"`
+	// NoProxy is a comma-separated list of hosts, domains and CIDRs reached
+	// directly. The cluster CIDRs, the VIP and the node subnet are added to
+	// it, see HarvesterConfig.NoProxy.
+	NoProxy string `json:"noProxy,omitempty"`
+	// NodeSubnets are the subnets DHCP gave the management interface, also
+	// reached directly. They are found by the installer, never persisted.
+	NodeSubnets []string `json:"-" yaml:"-"`
+}
+
+// Enabled tells if there is a proxy to go through.
+func (p Proxy) Enabled() bool {
+	return p.HTTP != "" || p.HTTPS != ""
+}
+
+// ValidateProxy checks the proxy URLs.
+func ValidateProxy(p Proxy) error {
+	for _, field := range []struct{ name, value string }{{"http", p.HTTP}, {"https", p.HTTPS}} {
+		if field.value == "" {
+			continue
+		}
+		u, err := url.Parse(field.value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("install.proxy.%s must be like http://[[user][:pass]@]host[:port]/", field.name)
+		}
+	}
+	return nil
+}
+
+// NoProxy returns what is reached directly rather than by proxy: what the
+// config lists, localhost, the pod and service CIDRs of the cluster, the
+// VIP and the subnets of the management interface.
+func (c *HarvesterConfig) NoProxy() string {
+	var entries []string
+	seen := make(map[string]bool)
+	add := func(entry string) {
+		entry = strings.TrimSpace(entry)
+		if entry != "" && !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+	for _, entry := range strings.Split(c.Install.Proxy.NoProxy, ",") {
+		add(entry)
+	}
+	for _, entry := range defaultNoProxy {
+		add(entry)
+	}
+	add(orDefault(c.ClusterPodCIDR, defaultClusterPodCIDR))
+	add(orDefault(c.ClusterServiceCIDR, defaultClusterServiceCIDR))
+	add(c.Vip)
+	if ip := net.ParseIP(c.ManagementInterface.IP); ip != nil && c.ManagementInterface.SubnetMask != "" {
+		if mask := net.ParseIP(c.ManagementInterface.SubnetMask); mask != nil {
+			if v4 := mask.To4(); v4 != nil {
+				mask = v4
+			}
+			subnet := net.IPNet{IP: ip.Mask(net.IPMask(mask)), Mask: net.IPMask(mask)}
+			add(subnet.String())
+		}
+	}
+	for _, subnet := range c.Install.Proxy.NodeSubnets {
+		add(subnet)
+	}
+	return strings.Join(entries, ",")
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// ProxyEnvironment returns the environment variables of the proxy, for
+// processes that go through it.
+func (c *HarvesterConfig) ProxyEnvironment() map[string]string {
+	if !c.Install.Proxy.Enabled() {
+		return nil
+	}
+	env := map[string]string{"NO_PROXY": c.NoProxy()}
+	if c.Install.Proxy.HTTP != "" {
+		env["HTTP_PROXY"] = c.Install.Proxy.HTTP
+	}
+	if c.Install.Proxy.HTTPS != "" {
+		env["HTTPS_PROXY"] = c.Install.Proxy.HTTPS
+	}
+	return env
+}
+
+// proxySetting returns the value of the http-proxy setting of Harvester.
+func (c *HarvesterConfig) proxySetting() string {
+	// a map of strings always marshals
+	setting, _ := json.Marshal(map[string]string{
+		"httpProxy":  c.Install.Proxy.HTTP,
+		"httpsProxy": c.Install.Proxy.HTTPS,
+		"noProxy":    c.NoProxy(),
+	})
+	return string(setting)
+}
+
+// addProxyDropIns puts the proxy into the environment of the services that
+// go through it. RKE2 hands it to its containerd by the CONTAINERD_ ones.
+func addProxyDropIns(config *HarvesterConfig, stage *yipSchema.Stage) error {
+	env := config.ProxyEnvironment()
+	if env == nil {
+		return nil
+	}
+	for _, service := range proxyServices {
+		serviceEnv := make(map[string]string, 2*len(env))
+		for name, value := range env {
+			value = systemdEnvironmentEscaper.Replace(value)
+			serviceEnv[name] = value
+			if strings.HasPrefix(service, "rke2-") {
+				serviceEnv["CONTAINERD_"+name] = value
+			}
+		}
+		content, err := render("systemd-proxy.conf", serviceEnv)
+		if err != nil {
+			return err
+		}
+		stage.Files = append(stage.Files, yipSchema.File{
+			Path:        fmt.Sprintf(proxyDropInFile, service),
+			Content:     content,
+			Permissions: 0600,
+			Owner:       0,
+			Group:       0,
+		})
+	}
+	return nil
+}
@@ -25,7 +25,11 @@ func ReadConfig() (HarvesterConfig, error) {
 	if err = schema.Mapper.ToInternal(data); err != nil {
 		return *result, err
 	}
-	return *result, convert.ToObj(data, result)
+	if err = convert.ToObj(data, result); err != nil {
+		return *result, err
+	}
+	result.SetSource("", SourceCmdline)
+	return *result, nil
 }
 
 func ToEnv(prefix string, obj interface{}) ([]string, error) {
@@ -76,7 +80,11 @@ func readUserData(fileName string) (HarvesterConfig, error) {
 		return *result, err
 	}
 	result, err = LoadHarvesterConfig(tidyContents)
-	return *result, err
+	if err != nil {
+		return *result, err
+	}
+	result.SetSource("", SourceUserData(fileName))
+	return *result, nil
 }
 
 func cleanupFile(content []byte) ([]byte, error) {
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+// sensitiveTag marks config fields holding secrets. `sensitive:"true"` marks
+// the whole field, everything below it included. On a map of strings, the
+// tag may instead list the keys whose values are secrets, e.g.
+// `sensitive:"backup-target,http-proxy"`.
+const sensitiveTag = "sensitive"
+
+// minRedactLength keeps RedactString from masking every occurrence of a
+// very short secret, which would render logs unreadable.
+const minRedactLength = 4
+
+// Redact returns a deep copy of obj in which the values of all fields tagged
+// as sensitive are replaced with SanitizeMask. Unexported struct fields are
+// not copied.
+func Redact[T any](obj T) T {
+	v := redactValue(reflect.ValueOf(&obj).Elem(), "", func(string) string {
+		return SanitizeMask
+	})
+	return v.Interface().(T)
+}
+
+// SensitiveValues returns the values of all fields of obj tagged as
+// sensitive. They are used to scrub secrets from free text, such as
+// rendered files, that can't be redacted field by field.
+func SensitiveValues(obj interface{}) []string {
+	var values []string
+	redactValue(reflect.ValueOf(obj), "", func(s string) string {
+		values = append(values, s)
+		return s
+	})
+	return values
+}
+
+// RedactString replaces every occurrence of the given secret values in s
+// with SanitizeMask.
+func RedactString(s string, values []string) string {
+	sorted := make([]string, 0, len(values))
+	for _, v := range values {
+		if len(v) >= minRedactLength {
+			sorted = append(sorted, v)
+		}
+	}
+	// replace longer values first in case one secret contains another
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+	for _, v := range sorted {
+		s = strings.ReplaceAll(s, v, SanitizeMask)
+	}
+	return s
+}
+
+func redactValue(v reflect.Value, sensitive string, mask func(string) string) reflect.Value {
+	if !v.IsValid() {
+		return v
+	}
+	// a sensitive field stays sensitive all the way down
+	inherited := ""
+	if sensitive == "true" {
+		inherited = sensitive
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if sensitive == "true" && v.String() != "" {
+			return reflect.ValueOf(mask(v.String())).Convert(v.Type())
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.New(v.Type().Elem())
+		n.Elem().Set(redactValue(v.Elem(), inherited, mask))
+		return n
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.New(v.Type()).Elem()
+		n.Set(redactValue(v.Elem(), inherited, mask))
+		return n
+	case reflect.Struct:
+		n := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			tag := field.Tag.Get(sensitiveTag)
+			if inherited != "" {
+				tag = inherited
+			}
+			n.Field(i).Set(redactValue(v.Field(i), tag, mask))
+		}
+		return n
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			n.Index(i).Set(redactValue(v.Index(i), inherited, mask))
+		}
+		return n
+	case reflect.Array:
+		n := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			n.Index(i).Set(redactValue(v.Index(i), inherited, mask))
+		}
+		return n
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		var keys []string
+		if inherited == "" && sensitive != "" {
+			keys = strings.Split(sensitive, ",")
+		}
+		n := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			elemSensitive := inherited
+			if k := iter.Key(); k.Kind() == reflect.String && util.StringSliceContains(keys, k.String()) {
+				elemSensitive = "true"
+			}
+			n.SetMapIndex(iter.Key(), redactValue(iter.Value(), elemSensitive, mask))
+		}
+		return n
+	}
+	return v
+}
+
+// sensitiveSystemSettings returns the system settings tagged as sensitive.
+func sensitiveSystemSettings() []string {
+	field, _ := reflect.TypeOf(HarvesterConfig{}).FieldByName("SystemSettings")
+	return strings.Split(field.Tag.Get(sensitiveTag), ",")
+}
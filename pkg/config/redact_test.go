@@ -0,0 +1,70 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSensitiveConfig() *HarvesterConfig {
+	return &HarvesterConfig{
+		Token: "cluster-token",
+		OS: OS{
+			Hostname: "node1",
+			Password: "os-password",
+		},
+		Install: Install{
+			Webhooks: []Webhook{
+				{
+					URL:       "https://hooks.example.com",
+					Headers:   map[string][]string{"Authorization": {"Bearer webhook-token"}},
+					BasicAuth: HTTPBasicAuth{User: "user", Password: "webhook-password"},
+				},
+			},
+			SecretSource: SecretSource{
+				BasicAuth: HTTPBasicAuth{User: "user", Password: "source-password"},
+			},
+		},
+		SystemSettings: map[string]string{
+			"backup-target": `{"type":"s3","secret":"backup-secret"}`,
+			"log-level":     "Debug",
+		},
+	}
+}
+
+func TestRedact(t *testing.T) {
+	c := newSensitiveConfig()
+	redacted := Redact(*c)
+
+	assert.Equal(t, SanitizeMask, redacted.Token)
+	assert.Equal(t, SanitizeMask, redacted.OS.Password)
+	assert.Equal(t, "node1", redacted.OS.Hostname)
+	assert.Equal(t, "user", redacted.Install.Webhooks[0].BasicAuth.User)
+	assert.Equal(t, SanitizeMask, redacted.Install.Webhooks[0].BasicAuth.Password)
+	assert.Equal(t, []string{SanitizeMask}, redacted.Install.Webhooks[0].Headers["Authorization"])
+	assert.Equal(t, "https://hooks.example.com", redacted.Install.Webhooks[0].URL)
+	assert.Equal(t, SanitizeMask, redacted.Install.SecretSource.BasicAuth.Password)
+	assert.Equal(t, SanitizeMask, redacted.SystemSettings["backup-target"])
+	assert.Equal(t, "Debug", redacted.SystemSettings["log-level"])
+
+	// the original is left untouched
+	assert.Equal(t, newSensitiveConfig(), c)
+}
+
+func TestSensitiveValues(t *testing.T) {
+	assert.ElementsMatch(t, []string{
+		"cluster-token",
+		"os-password",
+		"Bearer webhook-token",
+		"webhook-password",
+		"source-password",
+		`{"type":"s3","secret":"backup-secret"}`,
+	}, SensitiveValues(newSensitiveConfig()))
+}
+
+func TestRedactString(t *testing.T) {
+	values := []string{"cluster-token", "cluster-token-2", "abc"}
+	assert.Equal(t,
+		"token: ***\nother: ***\nname: abc\n",
+		RedactString("token: cluster-token\nother: cluster-token-2\nname: abc\n", values))
+}
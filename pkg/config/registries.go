@@ -0,0 +1,206 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	yipSchema "github.com/rancher/yip/pkg/schema"
+)
+
+const (
+	registriesFile     = "/etc/rancher/rke2/registries.yaml"
+	registryCADir      = "/etc/rancher/rke2/registries.d"
+	containerdRegistry = "containerd-registry"
+)
+
+// Registries configure where containerd pulls images from, from the first
+// images RKE2 pulls on. They end up in the registries.yaml of RKE2 and in the
+// containerd-registry setting of Harvester.
+type Registries struct {
+	Mirrors []RegistryMirror `json:"mirrors,omitempty"`
+	Configs []RegistryConfig `json:"configs,omitempty"`
+}
+
+// RegistryMirror makes images of a registry pulled from the endpoints,
+// tried in order. Registry is a hostname such as docker.io, or "*" for all.
+type RegistryMirror struct {
+	Registry  string   `json:"registry"`
+	Endpoints []string `json:"endpoints,omitempty"`
+	// Rewrites map regular expressions of repositories to their replacement.
+	Rewrites map[string]string `json:"rewrites,omitempty"`
+}
+
+// RegistryConfig sets the credentials and TLS of the registry at Host, which
+// is a hostname or host:port.
+type RegistryConfig struct {
+	Host          string `json:"host"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty" sensitive:"true"`
+	Auth          string `json:"auth,omitempty" sensitive:"true"`
+	IdentityToken string `json:"identityToken,omitempty" sensitive:"true"`
+	// CACerts is PEM text or the path of a PEM file.
+	CACerts  string `json:"caCerts,omitempty"`
+	Insecure bool   `json:"insecure,omitempty"`
+}
+
+// Enabled tells if there is anything to configure.
+func (r Registries) Enabled() bool {
+	return len(r.Mirrors) > 0 || len(r.Configs) > 0
+}
+
+// CAFile returns where the CA certificates of the registry go on the node.
+func (r RegistryConfig) CAFile() string {
+	if r.CACerts == "" {
+		return ""
+	}
+	return filepath.Join(registryCADir, r.Host, "ca.pem")
+}
+
+// ValidateRegistries checks the mirrors have endpoints and the configs have
+// hosts and valid CA certificates.
+func ValidateRegistries(r Registries) error {
+	mirrors := make(map[string]int)
+	for i, mirror := range r.Mirrors {
+		if mirror.Registry == "" {
+			return fmt.Errorf("registries.mirrors[%d] has no registry", i)
+		}
+		// one would silently override the other in registries.yaml
+		if j, ok := mirrors[mirror.Registry]; ok {
+			return fmt.Errorf("registries.mirrors[%d] and registries.mirrors[%d] are both for %s", j, i, mirror.Registry)
+		}
+		mirrors[mirror.Registry] = i
+		if len(mirror.Endpoints) == 0 {
+			return fmt.Errorf("registries.mirrors[%d] has no endpoints", i)
+		}
+		for _, endpoint := range mirror.Endpoints {
+			if u, err := url.Parse(endpoint); err != nil || u.Host == "" {
+				return fmt.Errorf("registries.mirrors[%d] has an invalid endpoint %q", i, endpoint)
+			}
+		}
+	}
+	configs := make(map[string]int)
+	for i, config := range r.Configs {
+		if config.Host == "" {
+			return fmt.Errorf("registries.configs[%d] has no host", i)
+		}
+		if j, ok := configs[config.Host]; ok {
+			return fmt.Errorf("registries.configs[%d] and registries.configs[%d] are both for %s", j, i, config.Host)
+		}
+		configs[config.Host] = i
+		if config.CACerts == "" {
+			continue
+		}
+		pem, err := LoadPEM(config.CACerts)
+		if err == nil {
+			err = ValidateCertificates(pem)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid registries.configs[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// containerdRegistrySetting is the value of the containerd-registry setting
+// of Harvester, which keeps registries.yaml of the nodes in sync with it.
+type containerdRegistrySetting struct {
+	Mirrors map[string]containerdMirror         `json:"Mirrors"`
+	Configs map[string]containerdRegistryConfig `json:"Configs"`
+}
+
+type containerdMirror struct {
+	Endpoints []string          `json:"Endpoints"`
+	Rewrites  map[string]string `json:"Rewrites"`
+}
+
+type containerdRegistryConfig struct {
+	Auth *containerdAuth `json:"Auth"`
+	TLS  *containerdTLS  `json:"TLS"`
+}
+
+type containerdAuth struct {
+	Username      string `json:"Username"`
+	Password      string `json:"Password"`
+	Auth          string `json:"Auth"`
+	IdentityToken string `json:"IdentityToken"`
+}
+
+type containerdTLS struct {
+	CAFile             string `json:"CAFile"`
+	CertFile           string `json:"CertFile"`
+	KeyFile            string `json:"KeyFile"`
+	InsecureSkipVerify bool   `json:"InsecureSkipVerify"`
+}
+
+// ContainerdRegistrySetting returns the value of the containerd-registry setting.
+func (r Registries) ContainerdRegistrySetting() string {
+	setting := containerdRegistrySetting{
+		Mirrors: make(map[string]containerdMirror, len(r.Mirrors)),
+		Configs: make(map[string]containerdRegistryConfig, len(r.Configs)),
+	}
+	for _, mirror := range r.Mirrors {
+		setting.Mirrors[mirror.Registry] = containerdMirror{
+			Endpoints: mirror.Endpoints,
+			Rewrites:  mirror.Rewrites,
+		}
+	}
+	for _, config := range r.Configs {
+		registryConfig := containerdRegistryConfig{}
+		if config.Username != "" || config.Password != "" || config.Auth != "" || config.IdentityToken != "" {
+			registryConfig.Auth = &containerdAuth{
+				Username:      config.Username,
+				Password:      config.Password,
+				Auth:          config.Auth,
+				IdentityToken: config.IdentityToken,
+			}
+		}
+		if config.CACerts != "" || config.Insecure {
+			registryConfig.TLS = &containerdTLS{
+				CAFile:             config.CAFile(),
+				InsecureSkipVerify: config.Insecure,
+			}
+		}
+		setting.Configs[config.Host] = registryConfig
+	}
+	// maps and structs of strings always marshal
+	data, _ := json.Marshal(setting)
+	return string(data)
+}
+
+// addRegistriesFiles writes registries.yaml of RKE2, and the CA certificates
+// it refers to.
+func addRegistriesFiles(config *HarvesterConfig, stage *yipSchema.Stage) error {
+	if !config.Registries.Enabled() {
+		return nil
+	}
+	content, err := render("rke2-registries.yaml", config.Registries)
+	if err != nil {
+		return err
+	}
+	stage.Files = append(stage.Files, yipSchema.File{
+		Path:        registriesFile,
+		Content:     content,
+		Permissions: 0600,
+		Owner:       0,
+		Group:       0,
+	})
+	for _, registryConfig := range config.Registries.Configs {
+		if registryConfig.CACerts == "" {
+			continue
+		}
+		pem, err := LoadPEM(registryConfig.CACerts)
+		if err != nil {
+			return err
+		}
+		stage.Files = append(stage.Files, yipSchema.File{
+			Path:        registryConfig.CAFile(),
+			Content:     string(pem),
+			Permissions: 0644,
+			Owner:       0,
+			Group:       0,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+func TestValidateRegistries(t *testing.T) {
+	testCases := []struct {
+		name       string
+		registries Registries
+		errMsg     string
+	}{
+		{
+			name: "no registries",
+		},
+		{
+			name: "mirror and config",
+			registries: Registries{
+				Mirrors: []RegistryMirror{{Registry: "docker.io", Endpoints: []string{"https://harbor.example.com:8443"}}},
+				Configs: []RegistryConfig{{Host: "harbor.example.com:8443", Username: "admin", Password: "secret"}},
+			},
+		},
+		{
+			name: "mirror without endpoints",
+			registries: Registries{
+				Mirrors: []RegistryMirror{{Registry: "docker.io"}},
+			},
+			errMsg: "registries.mirrors[0] has no endpoints",
+		},
+		{
+			name: "endpoint without host",
+			registries: Registries{
+				Mirrors: []RegistryMirror{{Registry: "docker.io", Endpoints: []string{"harbor.example.com"}}},
+			},
+			errMsg: `registries.mirrors[0] has an invalid endpoint "harbor.example.com"`,
+		},
+		{
+			name: "duplicate mirrors",
+			registries: Registries{
+				Mirrors: []RegistryMirror{
+					{Registry: "docker.io", Endpoints: []string{"https://harbor.example.com"}},
+					{Registry: "docker.io", Endpoints: []string{"https://mirror.example.com"}},
+				},
+			},
+			errMsg: "registries.mirrors[0] and registries.mirrors[1] are both for docker.io",
+		},
+		{
+			name: "duplicate configs",
+			registries: Registries{
+				Configs: []RegistryConfig{{Host: "harbor.example.com", Username: "admin"}, {Host: "harbor.example.com", Username: "robot"}},
+			},
+			errMsg: "registries.configs[0] and registries.configs[1] are both for harbor.example.com",
+		},
+		{
+			name: "config without host",
+			registries: Registries{
+				Configs: []RegistryConfig{{Username: "admin"}},
+			},
+			errMsg: "registries.configs[0] has no host",
+		},
+		{
+			name: "CA without certificates",
+			registries: Registries{
+				Configs: []RegistryConfig{{Host: "harbor.example.com", CACerts: "-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n"}},
+			},
+			errMsg: "invalid registries.configs[0]: no certificates",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRegistries(tc.registries)
+			if tc.errMsg != "" {
+				assert.EqualError(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestConvertToCos_Registries(t *testing.T) {
+	conf, err := LoadHarvesterConfig(util.LoadFixture(t, "harvester-config.yaml"))
+	assert.NoError(t, err)
+	ca := "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+	conf.Registries = Registries{
+		Mirrors: []RegistryMirror{
+			{
+				Registry:  "docker.io",
+				Endpoints: []string{"https://harbor.example.com:8443"},
+				Rewrites:  map[string]string{"^rancher/(.*)": "mirror/rancher/$1"},
+			},
+		},
+		Configs: []RegistryConfig{
+			{Host: "harbor.example.com:8443", Username: "admin", Password: "p\"ss", CACerts: ca},
+			{Host: "registry.local", Insecure: true},
+		},
+	}
+
+	yipConfig, err := ConvertToCOS(conf)
+	assert.NoError(t, err)
+
+	files := map[string]string{}
+	for _, file := range yipConfig.Stages["initramfs"][0].Files {
+		files[file.Path] = file.Content
+	}
+	assert.Equal(t, `
+mirrors:
+  "docker.io":
+    endpoint:
+      - "https://harbor.example.com:8443"
+    rewrite:
+      "^rancher/(.*)": "mirror/rancher/$1"
+configs:
+  "harbor.example.com:8443":
+    auth:
+      username: "admin"
+      password: "p\"ss"
+    tls:
+      ca_file: "/etc/rancher/rke2/registries.d/harbor.example.com:8443/ca.pem"
+  "registry.local":
+    tls:
+      insecure_skip_verify: true
+`, files["/etc/rancher/rke2/registries.yaml"])
+	assert.Equal(t, ca, files["/etc/rancher/rke2/registries.d/harbor.example.com:8443/ca.pem"])
+
+	assert.JSONEq(t, `{
+		"Mirrors": {
+			"docker.io": {"Endpoints": ["https://harbor.example.com:8443"], "Rewrites": {"^rancher/(.*)": "mirror/rancher/$1"}}
+		},
+		"Configs": {
+			"harbor.example.com:8443": {
+				"Auth": {"Username": "admin", "Password": "p\"ss", "Auth": "", "IdentityToken": ""},
+				"TLS": {"CAFile": "/etc/rancher/rke2/registries.d/harbor.example.com:8443/ca.pem", "CertFile": "", "KeyFile": "", "InsecureSkipVerify": false}
+			},
+			"registry.local": {
+				"Auth": null,
+				"TLS": {"CAFile": "", "CertFile": "", "KeyFile": "", "InsecureSkipVerify": true}
+			}
+		}
+	}`, conf.SystemSettings["containerd-registry"])
+}
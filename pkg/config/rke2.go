@@ -0,0 +1,192 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	yipSchema "github.com/rancher/yip/pkg/schema"
+	"gopkg.in/yaml.v3"
+)
+
+const rke2UserConfigFile = "/etc/rancher/rke2/config.yaml.d/95-user.yaml"
+
+var (
+	rke2KeyRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*\+?$`)
+
+	// rke2ListKeySuffixes and rke2ListKeys are the keys RKE2 takes lists
+	// for, which Harvester sets some of too.
+	rke2ListKeySuffixes = []string{"-arg", "-extra-mount", "-extra-env"}
+	rke2ListKeys        = []string{"node-label", "node-taint", "tls-san"}
+
+	// rke2DeniedKeys are set by Harvester, or by rancherd, and can't be
+	// changed without breaking the cluster.
+	rke2DeniedKeys = []string{
+		"agent-token",
+		"agent-token-file",
+		"audit-policy-file",
+		"cluster-cidr",
+		"cluster-dns",
+		"cluster-domain",
+		"cluster-init",
+		"cluster-reset",
+		"cni",
+		"data-dir",
+		"disable",
+		"etcd-disable-snapshots",
+		"etcd-s3",
+		"etcd-s3-access-key",
+		"etcd-s3-bucket",
+		"etcd-s3-endpoint",
+		"etcd-s3-endpoint-ca",
+		"etcd-s3-folder",
+		"etcd-s3-insecure",
+		"etcd-s3-region",
+		"etcd-s3-secret-key",
+		"etcd-s3-skip-ssl-verify",
+		"etcd-snapshot-dir",
+		"etcd-snapshot-retention",
+		"etcd-snapshot-schedule-cron",
+		"node-name",
+		"nonroot-devices",
+		"server",
+		"service-cidr",
+		"token",
+		"token-file",
+	}
+)
+
+// RKE2Config is extra RKE2 configuration, by the keys of its config file.
+// Agent keys apply to every node, server keys to the servers of the cluster
+// too and take precedence there. Lists, such as kube-apiserver-arg
+// or kubelet-arg, are appended to those of Harvester, as are scalars of
+// such keys.
+type RKE2Config struct {
+	Server map[string]interface{} `json:"server,omitempty"`
+	Agent  map[string]interface{} `json:"agent,omitempty"`
+
+	// EtcdSnapshots is the etcd snapshot policy of the nodes running etcd.
+	EtcdSnapshots EtcdSnapshots `json:"etcdSnapshots,omitempty"`
+	// Audit is the audit policy, log and webhook of kube-apiserver.
+	Audit AuditConfig `json:"audit,omitempty"`
+}
+
+// ValidateRKE2Config checks the keys are RKE2 config keys that Harvester
+// doesn't own, with scalar or list values.
+func ValidateRKE2Config(r RKE2Config) error {
+	for _, section := range []struct {
+		name   string
+		config map[string]interface{}
+	}{{"agent", r.Agent}, {"server", r.Server}} {
+		for _, key := range slices.Sorted(maps.Keys(section.config)) {
+			if !rke2KeyRegexp.MatchString(key) {
+				return fmt.Errorf("rke2.%s.%s is not an RKE2 config key", section.name, key)
+			}
+			if slices.Contains(rke2DeniedKeys, strings.TrimSuffix(key, "+")) {
+				return fmt.Errorf("rke2.%s.%s is set by Harvester", section.name, key)
+			}
+			if !isRKE2Value(section.config[key]) {
+				return fmt.Errorf("rke2.%s.%s must be a string, number, boolean or list of them", section.name, key)
+			}
+		}
+	}
+	return nil
+}
+
+func isRKE2Value(value interface{}) bool {
+	switch v := value.(type) {
+	case string, bool, int, int64, float64:
+		return true
+	case []interface{}:
+		for _, elem := range v {
+			if _, ok := elem.([]interface{}); ok || !isRKE2Value(elem) {
+				return false
+			}
+		}
+		return true
+	case []string:
+		return true
+	}
+	return false
+}
+
+// rke2UserConfig returns the keys of the RKE2 config of the node, with the
+// lists appended to those of Harvester.
+func (c *HarvesterConfig) rke2UserConfig() map[string]interface{} {
+	sections := []map[string]interface{}{c.RKE2.Agent}
+	if runsEtcd(c.Install.Role) {
+		sections = append(sections, c.RKE2.Server)
+	}
+	config := make(map[string]interface{})
+	for _, section := range sections {
+		for key, value := range section {
+			if isRKE2ListKey(key) && !isRKE2List(value) {
+				value = []interface{}{value}
+			}
+			if !strings.HasSuffix(key, "+") && isRKE2List(value) {
+				key += "+"
+			}
+			if previous, ok := config[key]; ok && isRKE2List(previous) && isRKE2List(value) {
+				value = append(toRKE2List(previous), toRKE2List(value)...)
+			}
+			config[key] = value
+		}
+	}
+	return config
+}
+
+// isRKE2ListKey reports whether RKE2 takes a list for the key, so that a
+// scalar is a list of one rather than a replacement of the Harvester list.
+func isRKE2ListKey(key string) bool {
+	key = strings.TrimSuffix(key, "+")
+	if slices.Contains(rke2ListKeys, key) {
+		return true
+	}
+	return slices.ContainsFunc(rke2ListKeySuffixes, func(suffix string) bool {
+		return strings.HasSuffix(key, suffix)
+	})
+}
+
+func isRKE2List(value interface{}) bool {
+	switch value.(type) {
+	case []interface{}, []string:
+		return true
+	}
+	return false
+}
+
+func toRKE2List(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return append([]interface{}(nil), v...)
+	case []string:
+		list := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			list = append(list, elem)
+		}
+		return list
+	}
+	return nil
+}
+
+// addRKE2UserConfig writes the extra RKE2 configuration of the node.
+func addRKE2UserConfig(config *HarvesterConfig, stage *yipSchema.Stage) error {
+	userConfig := config.rke2UserConfig()
+	if len(userConfig) == 0 {
+		return nil
+	}
+	content, err := yaml.Marshal(userConfig)
+	if err != nil {
+		return err
+	}
+	stage.Files = append(stage.Files, yipSchema.File{
+		Path:        rke2UserConfigFile,
+		Content:     string(content),
+		Permissions: 0600,
+		Owner:       0,
+		Group:       0,
+	})
+	return nil
+}
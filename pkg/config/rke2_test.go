@@ -0,0 +1,131 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+func TestValidateRKE2Config(t *testing.T) {
+	testCases := []struct {
+		name   string
+		rke2   RKE2Config
+		errMsg string
+	}{
+		{
+			name: "args and scalars",
+			rke2: RKE2Config{
+				Server: map[string]interface{}{
+					"kube-apiserver-arg":  []interface{}{"oidc-client-id=harvester"},
+					"etcd-arg+":           []interface{}{"quota-backend-bytes=8589934592"},
+					"etcd-expose-metrics": true,
+				},
+				Agent: map[string]interface{}{"kubelet-arg": []string{"image-gc-high-threshold=80"}},
+			},
+		},
+		{
+			name:   "denied key",
+			rke2:   RKE2Config{Agent: map[string]interface{}{"token": "secret"}},
+			errMsg: "rke2.agent.token is set by Harvester",
+		},
+		{
+			name:   "denied appended key",
+			rke2:   RKE2Config{Server: map[string]interface{}{"disable+": []interface{}{"rke2-ingress-nginx"}}},
+			errMsg: "rke2.server.disable+ is set by Harvester",
+		},
+		{
+			name:   "not a key",
+			rke2:   RKE2Config{Server: map[string]interface{}{"kube_apiserver_arg": "v=2"}},
+			errMsg: "rke2.server.kube_apiserver_arg is not an RKE2 config key",
+		},
+		{
+			name:   "nested value",
+			rke2:   RKE2Config{Agent: map[string]interface{}{"node-label": map[string]interface{}{"a": "b"}}},
+			errMsg: "rke2.agent.node-label must be a string, number, boolean or list of them",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRKE2Config(tc.rke2)
+			if tc.errMsg != "" {
+				assert.EqualError(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestConvertToCos_RKE2UserConfig(t *testing.T) {
+	conf, err := LoadHarvesterConfig(util.LoadFixture(t, "harvester-config.yaml"))
+	assert.NoError(t, err)
+	conf.ServerURL = ""
+	conf.RKE2 = RKE2Config{
+		Server: map[string]interface{}{
+			"kube-apiserver-arg":  []interface{}{"oidc-client-id=harvester"},
+			"kubelet-arg":         []interface{}{"v=2"},
+			"etcd-expose-metrics": true,
+		},
+		Agent: map[string]interface{}{
+			"kubelet-arg":         []interface{}{"image-gc-high-threshold=80"},
+			"etcd-expose-metrics": false,
+		},
+	}
+
+	yipConfig, err := ConvertToCOS(conf)
+	assert.NoError(t, err)
+	var content string
+	for _, file := range yipConfig.Stages["initramfs"][0].Files {
+		if file.Path == "/etc/rancher/rke2/config.yaml.d/95-user.yaml" {
+			content = file.Content
+		}
+	}
+	assert.Equal(t, `etcd-expose-metrics: true
+kube-apiserver-arg+:
+    - oidc-client-id=harvester
+kubelet-arg+:
+    - image-gc-high-threshold=80
+    - v=2
+`, content)
+
+	// joining servers get the server keys too, workers only the agent ones
+	conf.ServerURL = "https://172.16.0.10:443"
+	assert.Equal(t, map[string]interface{}{
+		"kube-apiserver-arg+": []interface{}{"oidc-client-id=harvester"},
+		"kubelet-arg+":        []interface{}{"image-gc-high-threshold=80", "v=2"},
+		"etcd-expose-metrics": true,
+	}, conf.rke2UserConfig())
+	conf.Install.Role = RoleWorker
+	assert.Equal(t, map[string]interface{}{
+		"kubelet-arg+":        []interface{}{"image-gc-high-threshold=80"},
+		"etcd-expose-metrics": false,
+	}, conf.rke2UserConfig())
+
+	// scalars of list keys are appended as lists of one
+	conf.RKE2.Agent = map[string]interface{}{
+		"kubelet-arg":           "max-pods=200",
+		"kube-apiserver-arg+":   "v=2",
+		"node-label":            "zone=a",
+		"kubelet-extra-mount":   "/data:/data",
+		"etcd-expose-metrics":   true,
+		"kube-proxy-extra-env":  "GOGC=50",
+		"tls-san":               "harvester.example.com",
+		"kube-scheduler-arg":    []string{"v=4"},
+		"write-kubeconfig-mode": "0600",
+	}
+	conf.RKE2.Server = map[string]interface{}{"kubelet-arg": "v=2"}
+	conf.Install.Role = RoleDefault
+	assert.Equal(t, map[string]interface{}{
+		"kubelet-arg+":          []interface{}{"max-pods=200", "v=2"},
+		"kube-apiserver-arg+":   []interface{}{"v=2"},
+		"node-label+":           []interface{}{"zone=a"},
+		"kubelet-extra-mount+":  []interface{}{"/data:/data"},
+		"etcd-expose-metrics":   true,
+		"kube-proxy-extra-env+": []interface{}{"GOGC=50"},
+		"tls-san+":              []interface{}{"harvester.example.com"},
+		"kube-scheduler-arg+":   []string{"v=4"},
+		"write-kubeconfig-mode": "0600",
+	}, conf.rke2UserConfig())
+}
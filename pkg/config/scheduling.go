@@ -0,0 +1,119 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	yipSchema "github.com/rancher/yip/pkg/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	nodeAnnotationsFile    = "/etc/harvester/node-annotations.json"
+	nodeAnnotationsService = "harvester-node-annotations"
+	nodeAnnotationsUnit    = "/etc/systemd/system/" + nodeAnnotationsService + ".service"
+)
+
+var (
+	taintEffects = []string{"NoSchedule", "PreferNoSchedule", "NoExecute"}
+
+	// witnessTaint keeps everything but etcd off witness nodes.
+	witnessTaint = Taint{Key: "node-role.kubernetes.io/etcd", Value: "true", Effect: "NoExecute"}
+)
+
+// Taint is a taint the node registers with, so that pods not tolerating it
+// never get scheduled on the node.
+type Taint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"`
+}
+
+func (t Taint) String() string {
+	if t.Value == "" {
+		return t.Key + ":" + t.Effect
+	}
+	return t.Key + "=" + t.Value + ":" + t.Effect
+}
+
+// ValidateTaints checks the keys and values of the taints are valid like
+// those of labels, and their effects.
+func ValidateTaints(path string, taints []Taint) error {
+	for i, taint := range taints {
+		if errs := validation.IsQualifiedName(taint.Key); len(errs) > 0 {
+			return fmt.Errorf("invalid %s[%d].key '%s': %s", path, i, taint.Key, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(taint.Value); len(errs) > 0 {
+			return fmt.Errorf("invalid %s[%d].value '%s': %s", path, i, taint.Value, strings.Join(errs, ", "))
+		}
+		if !slices.Contains(taintEffects, taint.Effect) {
+			return fmt.Errorf("%s[%d].effect must be one of %s", path, i, strings.Join(taintEffects, ", "))
+		}
+	}
+	return nil
+}
+
+// ValidateAnnotations checks the keys of the annotations.
+func ValidateAnnotations(annotations map[string]string) error {
+	for key := range annotations {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid annotation name '%s': %s", key, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// taints returns the taints of the role of the node, then those configured,
+// leaving out those with the key and effect of an earlier one.
+func (c *HarvesterConfig) taints() []Taint {
+	var taints []Taint
+	if c.Role == RoleWitness {
+		taints = append(taints, witnessTaint)
+	}
+	for _, taint := range c.OS.Taints {
+		if !slices.ContainsFunc(taints, func(t Taint) bool { return t.Key == taint.Key && t.Effect == taint.Effect }) {
+			taints = append(taints, taint)
+		}
+	}
+	return taints
+}
+
+// addNodeAnnotations annotates the node once it is registered. Kubelet can't
+// register with annotations, but may patch its own node afterwards.
+func addNodeAnnotations(config *HarvesterConfig, stage *yipSchema.Stage) error {
+	if len(config.OS.Annotations) == 0 {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": config.OS.Annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	unit, err := render("harvester-node-annotations.service", config)
+	if err != nil {
+		return err
+	}
+	stage.Files = append(stage.Files,
+		yipSchema.File{
+			Path:        nodeAnnotationsFile,
+			Content:     string(patch),
+			Permissions: 0600,
+			Owner:       0,
+			Group:       0,
+		},
+		yipSchema.File{
+			Path:        nodeAnnotationsUnit,
+			Content:     unit,
+			Permissions: 0644,
+			Owner:       0,
+			Group:       0,
+		},
+	)
+	stage.Systemctl.Enable = append(stage.Systemctl.Enable, nodeAnnotationsService)
+	return nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+func TestValidateTaints(t *testing.T) {
+	testCases := []struct {
+		name   string
+		taints []Taint
+		errMsg string
+	}{
+		{
+			name: "valid taints",
+			taints: []Taint{
+				{Key: "tenant", Value: "acme", Effect: "NoSchedule"},
+				{Key: "nvidia.com/gpu", Effect: "PreferNoSchedule"},
+			},
+		},
+		{
+			name:   "invalid key",
+			taints: []Taint{{Key: "???gpu", Effect: "NoSchedule"}},
+			errMsg: "invalid os.taints[0].key '???gpu': name part must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyName',  or 'my.name',  or '123-abc', regex used for validation is '([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]')",
+		},
+		{
+			name:   "invalid value",
+			taints: []Taint{{Key: "tenant", Value: "acme corp", Effect: "NoSchedule"}},
+			errMsg: "invalid os.taints[0].value 'acme corp': a valid label must be an empty string or consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyValue',  or 'my_value',  or '12345', regex used for validation is '(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?')",
+		},
+		{
+			name:   "unknown effect",
+			taints: []Taint{{Key: "tenant", Value: "acme", Effect: "NoExec"}},
+			errMsg: "os.taints[0].effect must be one of NoSchedule, PreferNoSchedule, NoExecute",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateTaints("os.taints", tc.taints)
+			if tc.errMsg != "" {
+				assert.EqualError(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestHarvesterConfig_GetKubeletArgs_Taints(t *testing.T) {
+	c := NewHarvesterConfig()
+	c.Role = RoleWitness
+	c.OS.Taints = []Taint{
+		{Key: "tenant", Value: "acme", Effect: "NoSchedule"},
+		{Key: "node-role.kubernetes.io/etcd", Value: "false", Effect: "NoExecute"},
+		{Key: "nvidia.com/gpu", Effect: "NoSchedule"},
+	}
+
+	args, err := c.GetKubeletArgs()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"max-pods=200",
+		"--register-with-taints=node-role.kubernetes.io/etcd=true:NoExecute,tenant=acme:NoSchedule,nvidia.com/gpu:NoSchedule",
+	}, args)
+
+	c.OS.Taints = []Taint{{Key: "tenant", Effect: "Never"}}
+	_, err = c.GetKubeletArgs()
+	assert.EqualError(t, err, "os.taints[0].effect must be one of NoSchedule, PreferNoSchedule, NoExecute")
+}
+
+func TestConvertToCos_NodeAnnotations(t *testing.T) {
+	conf, err := LoadHarvesterConfig(util.LoadFixture(t, "harvester-config.yaml"))
+	assert.NoError(t, err)
+	conf.OS.Annotations = map[string]string{"example.com/owner": "team 'a'"}
+
+	yipConfig, err := ConvertToCOS(conf)
+	assert.NoError(t, err)
+	initramfs := yipConfig.Stages["initramfs"][0]
+	files := map[string]string{}
+	for _, file := range initramfs.Files {
+		files[file.Path] = file.Content
+	}
+	assert.Equal(t, `{"metadata":{"annotations":{"example.com/owner":"team 'a'"}}}`, files["/etc/harvester/node-annotations.json"])
+	assert.Contains(t, files["/etc/systemd/system/harvester-node-annotations.service"], "kubectl patch node "+conf.OS.Hostname+" --type merge")
+	// retried by systemd rather than blocking the boot until registered
+	assert.Contains(t, files["/etc/systemd/system/harvester-node-annotations.service"], "Type=exec\n")
+	assert.Contains(t, files["/etc/systemd/system/harvester-node-annotations.service"], "Restart=on-failure\n")
+	assert.Contains(t, initramfs.Systemctl.Enable, "harvester-node-annotations")
+}
@@ -38,6 +38,9 @@ func LoadHarvesterConfig(yamlBytes []byte) (*HarvesterConfig, error) {
 	if err := result.ExternalStorage.ParseMultiPathConfig(); err != nil {
 		return result, fmt.Errorf("failed to parse external storage multi-path config: %v", err)
 	}
+	if err := ValidateAdditionalCAs(result.OS.AdditionalCAs); err != nil {
+		return result, err
+	}
 
 	return result, nil
 }
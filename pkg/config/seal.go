@@ -0,0 +1,425 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	yipSchema "github.com/rancher/yip/pkg/schema"
+	"gopkg.in/yaml.v3"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+const (
+	// SecretsFile holds the secrets split out of the persisted configs,
+	// encrypted with the key in SecretsKeyFile.
+	SecretsFile = "/oem/harvester.secrets"
+
+	// SecretsKeyFile is the random key the secrets are sealed with. It is on
+	// the persistent partition, apart from the OEM one the sealed secrets
+	// and the configs are on, but on the same disk: sealing doesn't protect
+	// the secrets from whoever holds the whole disk.
+	SecretsKeyFile = "/usr/local/.harvester/secrets.key"
+
+	// SealedPasswordHash stands in for the password hash of users in the
+	// persisted cOS config. It is not a valid crypt hash, so the account
+	// can't be logged into until the real hash is put back at boot.
+	SealedPasswordHash = "$harvester-sealed$"
+
+	// UnsealSecretsCommand puts the secrets back into files and user
+	// password hashes of a persisted cOS config at boot.
+	UnsealSecretsCommand = "/usr/bin/harvester-installer unseal-secrets"
+
+	secretPlaceholderFmt        = "__HARVESTER_SECRET:%s__"
+	secretQuotedPlaceholderFmt  = "__HARVESTER_SECRET:%s:quoted__"
+	secretSystemdPlaceholderFmt = "__HARVESTER_SECRET:%s:systemd__"
+
+	sealedSecretsVersion  = 2
+	secretsKeySize        = 32
+	recoveryKeyIterations = 600000
+)
+
+// ErrNoSecretsKey means the key the secrets are sealed with is missing.
+var ErrNoSecretsKey = errors.New("the secrets key is missing")
+
+// Secrets maps config paths of secret values to the values.
+type Secrets map[string]string
+
+type sealedSecrets struct {
+	Version int    `json:"version"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+	// Recovery is the secrets key sealed with the recovery key of the
+	// operator, if one was given.
+	Recovery *sealedKey `json:"recovery,omitempty"`
+}
+
+type sealedKey struct {
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+func secretPlaceholder(path string) string {
+	return fmt.Sprintf(secretPlaceholderFmt, path)
+}
+
+func quotedSecretPlaceholder(path string) string {
+	return fmt.Sprintf(secretQuotedPlaceholderFmt, path)
+}
+
+func systemdSecretPlaceholder(path string) string {
+	return fmt.Sprintf(secretSystemdPlaceholderFmt, path)
+}
+
+// quoteInner returns s as printed by %q, without the surrounding quotes.
+func quoteInner(s string) string {
+	quoted := strconv.Quote(s)
+	return quoted[1 : len(quoted)-1]
+}
+
+// sealableFields returns all secret fields of the config that can be split
+// out, including those in system settings.
+func (c *HarvesterConfig) sealableFields() map[string]*string {
+	fields := c.secretFields()
+	fields[secretPathSecretSourcePasswd] = &c.Install.SecretSource.BasicAuth.Password
+	fields[secretPathTLSClientKey] = &c.Install.TLS.ClientKey
+	fields[secretPathProxyHTTP] = &c.Install.Proxy.HTTP
+	fields[secretPathProxyHTTPS] = &c.Install.Proxy.HTTPS
+	for i := range c.Install.TLS.Endpoints {
+		fields[fmt.Sprintf(secretPathTLSEndpointKeyFmt, i)] = &c.Install.TLS.Endpoints[i].ClientKey
+	}
+	for i := range c.Registries.Configs {
+		fields[fmt.Sprintf(secretPathRegistryAuthFmt, i)] = &c.Registries.Configs[i].Auth
+		fields[fmt.Sprintf(secretPathRegistryTokenFmt, i)] = &c.Registries.Configs[i].IdentityToken
+	}
+	return fields
+}
+
+// Secrets returns the secret values in the config, leaving out those that
+// are still secret references.
+func (c *HarvesterConfig) Secrets() Secrets {
+	secrets := Secrets{}
+	for path, value := range c.sealableFields() {
+		// the recovery key is never persisted, sealed or not
+		if path == secretPathSecretsRecoveryKey {
+			continue
+		}
+		if *value != "" && !IsSecretReference(*value) {
+			secrets[path] = *value
+		}
+	}
+	for _, name := range sensitiveSystemSettings() {
+		if value := c.SystemSettings[name]; value != "" && !IsSecretReference(value) {
+			secrets[secretPathSystemSettingPrefix+name] = value
+		}
+	}
+	return secrets
+}
+
+// WithoutSecrets returns a copy of the config in which secret values are
+// replaced with placeholders that RestoreSecrets understands.
+func (c *HarvesterConfig) WithoutSecrets() (*HarvesterConfig, error) {
+	copied, err := c.DeepCopy()
+	if err != nil {
+		return nil, err
+	}
+	if c.SystemSettings != nil {
+		copied.SystemSettings = make(map[string]string, len(c.SystemSettings))
+		for name, value := range c.SystemSettings {
+			copied.SystemSettings[name] = value
+		}
+	}
+
+	fields := copied.sealableFields()
+	for path := range c.Secrets() {
+		if field, ok := fields[path]; ok {
+			*field = secretPlaceholder(path)
+		} else if name, ok := strings.CutPrefix(path, secretPathSystemSettingPrefix); ok {
+			copied.SystemSettings[name] = secretPlaceholder(path)
+		}
+	}
+	return copied, nil
+}
+
+// RestoreSecrets puts the secrets back in place of the placeholders left by
+// WithoutSecrets.
+func (c *HarvesterConfig) RestoreSecrets(secrets Secrets) {
+	for path, field := range c.sealableFields() {
+		if value, ok := secrets[path]; ok && *field == secretPlaceholder(path) {
+			*field = value
+		}
+	}
+	for name, value := range c.SystemSettings {
+		path := secretPathSystemSettingPrefix + name
+		if secret, ok := secrets[path]; ok && value == secretPlaceholder(path) {
+			c.SystemSettings[name] = secret
+		}
+	}
+}
+
+// Seal replaces the secrets in the files and user password hashes of a cOS
+// config with placeholders, and appends a step to every stage it touched
+// that puts the secrets back with UnsealSecretsCommand. cfg is left
+// untouched.
+func (s Secrets) Seal(cfg *yipSchema.YipConfig) (*yipSchema.YipConfig, error) {
+	// deep copy through YAML, which is how the config gets persisted anyway
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sealed := &yipSchema.YipConfig{}
+	if err := yaml.Unmarshal(data, sealed); err != nil {
+		return nil, err
+	}
+
+	for name, stages := range sealed.Stages {
+		var args []string
+		for i := range stages {
+			for j := range stages[i].Files {
+				if content := s.replace(stages[i].Files[j].Content); content != stages[i].Files[j].Content {
+					stages[i].Files[j].Content = content
+					args = append(args, "--file", stages[i].Files[j].Path)
+				}
+			}
+			for user, u := range stages[i].Users {
+				if u.PasswordHash != "" && u.PasswordHash == s[secretPathPassword] {
+					u.PasswordHash = SealedPasswordHash
+					stages[i].Users[user] = u
+					args = append(args, "--user", user)
+				}
+			}
+		}
+		if len(args) > 0 {
+			sealed.Stages[name] = append(stages, yipSchema.Stage{
+				Name:     "Unseal Harvester secrets",
+				Commands: []string{UnsealSecretsCommand + " " + strings.Join(args, " ")},
+			})
+		}
+	}
+	return sealed, nil
+}
+
+func (s Secrets) replace(content string) string {
+	paths := make([]string, 0, len(s))
+	for path := range s {
+		paths = append(paths, path)
+	}
+	// replace longer values first in case one secret contains another
+	sort.Slice(paths, func(i, j int) bool {
+		return len(s[paths[i]]) > len(s[paths[j]])
+	})
+	for _, path := range paths {
+		value := s[path]
+		if len(value) < minRedactLength {
+			continue
+		}
+		// values rendered with %q, e.g. the cluster token in the rancherd config
+		quoted := quoteInner(value)
+		if quoted != value {
+			content = strings.ReplaceAll(content, quoted, quotedSecretPlaceholder(path))
+		}
+		// values escaped for systemd, e.g. the proxy URLs in the drop-ins
+		if escaped := systemdEnvironmentEscaper.Replace(value); escaped != value && escaped != quoted {
+			content = strings.ReplaceAll(content, escaped, systemdSecretPlaceholder(path))
+		}
+		content = strings.ReplaceAll(content, value, secretPlaceholder(path))
+	}
+	return content
+}
+
+// PasswordHash returns the crypt hash of the OS password. The password is
+// hashed here if it was given in plain text.
+func (s Secrets) PasswordHash() (string, error) {
+	password := s[secretPathPassword]
+	if password == "" || util.IsPasswordHash(password) {
+		return password, nil
+	}
+	return util.GetEncryptedPasswd(password)
+}
+
+// Unseal puts the secrets back in place of the placeholders left by Seal.
+func (s Secrets) Unseal(content string) string {
+	for path, value := range s {
+		content = strings.ReplaceAll(content, systemdSecretPlaceholder(path), systemdEnvironmentEscaper.Replace(value))
+		content = strings.ReplaceAll(content, quotedSecretPlaceholder(path), quoteInner(value))
+		content = strings.ReplaceAll(content, secretPlaceholder(path), value)
+	}
+	return content
+}
+
+// NewSecretsKey returns a random key to seal secrets with.
+func NewSecretsKey() ([]byte, error) {
+	key := make([]byte, secretsKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func seal(key, plain []byte) (nonce, data []byte, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plain, nil), nil
+}
+
+func unseal(key, nonce, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %d", len(nonce))
+	}
+	return aead.Open(nil, nonce, data, nil)
+}
+
+func recoveryCipherKey(recoveryKey string, salt []byte, iterations int) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, recoveryKey, salt, iterations, secretsKeySize)
+}
+
+// SealSecrets encrypts the secrets with the key. The key itself is sealed
+// with the recovery key, unless it is empty, so that it can be recovered
+// with RecoverSecretsKey.
+func SealSecrets(secrets Secrets, key []byte, recoveryKey string) ([]byte, error) {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+	sealed := sealedSecrets{Version: sealedSecretsVersion}
+	if sealed.Nonce, sealed.Data, err = seal(key, plain); err != nil {
+		return nil, err
+	}
+	if recoveryKey != "" {
+		recovery := &sealedKey{Salt: make([]byte, 16), Iterations: recoveryKeyIterations}
+		if _, err := rand.Read(recovery.Salt); err != nil {
+			return nil, err
+		}
+		cipherKey, err := recoveryCipherKey(recoveryKey, recovery.Salt, recovery.Iterations)
+		if err != nil {
+			return nil, err
+		}
+		if recovery.Nonce, recovery.Data, err = seal(cipherKey, key); err != nil {
+			return nil, err
+		}
+		sealed.Recovery = recovery
+	}
+	return json.Marshal(sealed)
+}
+
+func parseSealedSecrets(data []byte) (*sealedSecrets, error) {
+	sealed := &sealedSecrets{}
+	if err := json.Unmarshal(data, sealed); err != nil {
+		return nil, err
+	}
+	if sealed.Version != sealedSecretsVersion {
+		return nil, fmt.Errorf("unsupported sealed secrets version %d", sealed.Version)
+	}
+	return sealed, nil
+}
+
+// UnsealSecrets decrypts secrets sealed by SealSecrets with the same key.
+func UnsealSecrets(data, key []byte) (Secrets, error) {
+	sealed, err := parseSealedSecrets(data)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := unseal(key, sealed.Nonce, sealed.Data)
+	if err != nil {
+		return nil, fmt.Errorf("fail to decrypt secrets, were they sealed with another key? %w", err)
+	}
+	secrets := Secrets{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// RecoverSecretsKey returns the key of sealed secrets from the recovery key
+// they were sealed with.
+func RecoverSecretsKey(data []byte, recoveryKey string) ([]byte, error) {
+	sealed, err := parseSealedSecrets(data)
+	if err != nil {
+		return nil, err
+	}
+	if sealed.Recovery == nil {
+		return nil, errors.New("the secrets were sealed without a recovery key")
+	}
+	cipherKey, err := recoveryCipherKey(recoveryKey, sealed.Recovery.Salt, sealed.Recovery.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	key, err := unseal(cipherKey, sealed.Recovery.Nonce, sealed.Recovery.Data)
+	if err != nil {
+		return nil, fmt.Errorf("fail to decrypt the secrets key, is the recovery key right? %w", err)
+	}
+	return key, nil
+}
+
+// ReadSecretsKey reads the key of a key file.
+func ReadSecretsKey(file string) ([]byte, error) {
+	key, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNoSecretsKey, file)
+		}
+		return nil, err
+	}
+	if len(key) != secretsKeySize {
+		return nil, fmt.Errorf("invalid secrets key %s of %d bytes", file, len(key))
+	}
+	return key, nil
+}
+
+// WriteSecretsKey writes a key file only root can read.
+func WriteSecretsKey(file string, key []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(file, key, 0600)
+}
+
+// ReadSecretsFile reads and decrypts a secrets file with the key of keyFile.
+// It returns no secrets and no error if the secrets file doesn't exist, as
+// is the case on nodes installed before secrets were split out, but the key
+// must be there if it does.
+func ReadSecretsFile(file, keyFile string) (Secrets, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	key, err := ReadSecretsKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return UnsealSecrets(data, key)
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	secretFilePrefix = "file://"
+	secretEnvPrefix  = "env:"
+	// secretURLPrefix marks a value as a secret to be fetched from a URL,
+	// e.g. "secret+https://vault.example.com/token". The prefix keeps it
+	// apart from settings whose plain value is a URL.
+	secretURLPrefix = "secret+"
+
+	secretPathToken               = "token"
+	secretPathPassword            = "os.password"
+	secretPathPasswordFormat      = "os.passwordFormat"
+	secretPathSecretSourcePasswd  = "install.secretSource.basicAuth.password"
+	secretPathWebhookPasswdFmt    = "install.webhooks[%d].basicAuth.password"
+	secretPathTLSClientKey        = "install.tls.clientKey"
+	secretPathTLSEndpointKeyFmt   = "install.tls.endpoints[%d].clientKey"
+	secretPathProxyHTTP           = "install.proxy.http"
+	secretPathProxyHTTPS          = "install.proxy.https"
+	secretPathRegistryPasswordFmt = "registries.configs[%d].password"
+	secretPathRegistryAuthFmt     = "registries.configs[%d].auth"
+	secretPathRegistryTokenFmt    = "registries.configs[%d].identityToken"
+	secretPathEtcdS3SecretKey     = "rke2.etcdSnapshots.s3.secretKey"
+	secretPathSecretsRecoveryKey  = "install.secretsRecoveryKey"
+	secretPathSystemSettingPrefix = "systemSettings."
+)
+
+// SecretSource is how secrets referenced by "secret+http(s)://" URLs are
+// fetched. It is kept apart from the config URL so that secrets can be
+// served from a different place with its own credentials.
+type SecretSource struct {
+	Headers   map[string][]string `json:"headers,omitempty" sensitive:"true"`
+	Insecure  bool                `json:"insecure,omitempty"`
+	BasicAuth HTTPBasicAuth       `json:"basicAuth,omitempty"`
+}
+
+// SecretFetcher fetches the secret at url using the given source settings.
+type SecretFetcher func(url string, source SecretSource) (string, error)
+
+// IsSecretReference reports whether value refers to a secret stored
+// elsewhere instead of being the secret itself.
+func IsSecretReference(value string) bool {
+	return strings.HasPrefix(value, secretFilePrefix) ||
+		strings.HasPrefix(value, secretEnvPrefix) ||
+		strings.HasPrefix(value, secretURLPrefix+"http://") ||
+		strings.HasPrefix(value, secretURLPrefix+"https://")
+}
+
+func resolveSecretReference(ref string, source SecretSource, fetch SecretFetcher) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, secretFilePrefix):
+		content, err := os.ReadFile(strings.TrimPrefix(ref, secretFilePrefix))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	case strings.HasPrefix(ref, secretEnvPrefix):
+		name := strings.TrimPrefix(ref, secretEnvPrefix)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	default:
+		if fetch == nil {
+			return "", fmt.Errorf("fetching secrets from URLs is not supported here")
+		}
+		value, err := fetch(strings.TrimPrefix(ref, secretURLPrefix), source)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(value, "\r\n"), nil
+	}
+}
+
+// secretFields returns the string fields that may hold a secret reference,
+// keyed by their path in the config. System settings are handled apart
+// since map values are not addressable.
+func (c *HarvesterConfig) secretFields() map[string]*string {
+	fields := map[string]*string{
+		secretPathToken:    &c.Token,
+		secretPathPassword: &c.OS.Password,
+	}
+	for i := range c.Install.Webhooks {
+		fields[fmt.Sprintf(secretPathWebhookPasswdFmt, i)] = &c.Install.Webhooks[i].BasicAuth.Password
+	}
+	for i := range c.Registries.Configs {
+		fields[fmt.Sprintf(secretPathRegistryPasswordFmt, i)] = &c.Registries.Configs[i].Password
+	}
+	fields[secretPathEtcdS3SecretKey] = &c.RKE2.EtcdSnapshots.S3.SecretKey
+	fields[secretPathSecretsRecoveryKey] = &c.Install.SecretsRecoveryKey
+	return fields
+}
+
+// ResolveSecretReferences replaces secret references in the token, the OS
+// password, webhook and registry passwords, the etcd S3 secret key, the
+// secrets recovery key and system settings with the secrets they point to. The references are remembered so that
+// WithSecretReferences can put them back before the config is persisted.
+func (c *HarvesterConfig) ResolveSecretReferences(fetch SecretFetcher) error {
+	if c.SecretReferences == nil {
+		c.SecretReferences = map[string]string{}
+	}
+
+	resolve := func(path string, value *string) error {
+		if !IsSecretReference(*value) {
+			return nil
+		}
+		resolved, err := resolveSecretReference(*value, c.Install.SecretSource, fetch)
+		if err != nil {
+			return fmt.Errorf("fail to resolve secret reference of %s: %w", path, err)
+		}
+		c.SecretReferences[path] = *value
+		*value = resolved
+		return nil
+	}
+
+	// The secret source credentials are needed to fetch the other secrets,
+	// so they can only refer to local files or environment variables.
+	if strings.HasPrefix(c.Install.SecretSource.BasicAuth.Password, secretURLPrefix) {
+		return fmt.Errorf("%s can't be fetched from a URL", secretPathSecretSourcePasswd)
+	}
+	if err := resolve(secretPathSecretSourcePasswd, &c.Install.SecretSource.BasicAuth.Password); err != nil {
+		return err
+	}
+
+	fields := c.secretFields()
+	paths := make([]string, 0, len(fields))
+	for path := range fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := resolve(path, fields[path]); err != nil {
+			return err
+		}
+	}
+
+	for name, value := range c.SystemSettings {
+		if err := resolve(secretPathSystemSettingPrefix+name, &value); err != nil {
+			return err
+		}
+		c.SystemSettings[name] = value
+	}
+	return nil
+}
+
+// WithSecretReferences returns a copy of the config in which resolved
+// secrets are replaced with the references they were resolved from. This is
+// the copy that should be persisted.
+func (c *HarvesterConfig) WithSecretReferences() (*HarvesterConfig, error) {
+	copied, err := c.DeepCopy()
+	if err != nil {
+		return nil, err
+	}
+	if len(c.SecretReferences) == 0 {
+		return copied, nil
+	}
+
+	// don't modify the map shared with the original config
+	if c.SystemSettings != nil {
+		copied.SystemSettings = make(map[string]string, len(c.SystemSettings))
+		for name, value := range c.SystemSettings {
+			copied.SystemSettings[name] = value
+		}
+	}
+
+	fields := copied.secretFields()
+	fields[secretPathSecretSourcePasswd] = &copied.Install.SecretSource.BasicAuth.Password
+	for path, ref := range c.SecretReferences {
+		if field, ok := fields[path]; ok {
+			*field = ref
+			continue
+		}
+		if path == secretPathPasswordFormat {
+			copied.OS.PasswordFormat = ref
+			continue
+		}
+		if name, ok := strings.CutPrefix(path, secretPathSystemSettingPrefix); ok {
+			if _, ok := copied.SystemSettings[name]; ok {
+				copied.SystemSettings[name] = ref
+			}
+		}
+	}
+	copied.SecretReferences = nil
+	return copied, nil
+}
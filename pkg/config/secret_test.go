@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarvesterConfig_ResolveSecretReferences(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("file-token\n"), 0600))
+	t.Setenv("TEST_SECRET_PASSWORD", "env-password")
+	t.Setenv("TEST_SECRET_SOURCE_PASSWORD", "source-password")
+
+	var fetched []string
+	fetch := func(url string, source SecretSource) (string, error) {
+		assert.Equal(t, "source-password", source.BasicAuth.Password)
+		fetched = append(fetched, url)
+		return "fetched-secret\n", nil
+	}
+
+	conf := NewHarvesterConfig()
+	conf.Token = "file://" + tokenFile
+	conf.OS.Password = "env:TEST_SECRET_PASSWORD"
+	conf.Install.SecretSource.BasicAuth = HTTPBasicAuth{User: "user", Password: "env:TEST_SECRET_SOURCE_PASSWORD"}
+	conf.Install.Webhooks = []Webhook{
+		{BasicAuth: HTTPBasicAuth{User: "user", Password: "inline"}},
+		{BasicAuth: HTTPBasicAuth{User: "user", Password: "secret+https://secrets.example.com/webhook"}},
+	}
+	conf.SystemSettings = map[string]string{
+		"backup-target": "secret+https://secrets.example.com/backup-target",
+		"ui-index":      "https://releases.example.com/index.html",
+	}
+
+	require.NoError(t, conf.ResolveSecretReferences(fetch))
+	assert.Equal(t, "file-token", conf.Token)
+	assert.Equal(t, "env-password", conf.OS.Password)
+	assert.Equal(t, "inline", conf.Install.Webhooks[0].BasicAuth.Password)
+	assert.Equal(t, "fetched-secret", conf.Install.Webhooks[1].BasicAuth.Password)
+	assert.Equal(t, "fetched-secret", conf.SystemSettings["backup-target"])
+	assert.Equal(t, "https://releases.example.com/index.html", conf.SystemSettings["ui-index"])
+	assert.ElementsMatch(t, []string{
+		"https://secrets.example.com/webhook",
+		"https://secrets.example.com/backup-target",
+	}, fetched)
+
+	persisted, err := conf.WithSecretReferences()
+	require.NoError(t, err)
+	assert.Equal(t, "file://"+tokenFile, persisted.Token)
+	assert.Equal(t, "env:TEST_SECRET_PASSWORD", persisted.OS.Password)
+	assert.Equal(t, "env:TEST_SECRET_SOURCE_PASSWORD", persisted.Install.SecretSource.BasicAuth.Password)
+	assert.Equal(t, "inline", persisted.Install.Webhooks[0].BasicAuth.Password)
+	assert.Equal(t, "secret+https://secrets.example.com/webhook", persisted.Install.Webhooks[1].BasicAuth.Password)
+	assert.Equal(t, "secret+https://secrets.example.com/backup-target", persisted.SystemSettings["backup-target"])
+	assert.Nil(t, persisted.SecretReferences)
+
+	// the resolved config is left untouched
+	assert.Equal(t, "file-token", conf.Token)
+	assert.Equal(t, "fetched-secret", conf.SystemSettings["backup-target"])
+}
+
+func TestHarvesterConfig_ResolveSecretReferencesErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		conf   *HarvesterConfig
+		fetch  SecretFetcher
+		errMsg string
+	}{
+		{
+			name:   "missing file",
+			conf:   &HarvesterConfig{Token: "file:///nonexistent/token"},
+			errMsg: "fail to resolve secret reference of token",
+		},
+		{
+			name:   "unset environment variable",
+			conf:   &HarvesterConfig{OS: OS{Password: "env:TEST_SECRET_UNSET"}},
+			errMsg: "environment variable TEST_SECRET_UNSET is not set",
+		},
+		{
+			name:   "no fetcher",
+			conf:   &HarvesterConfig{Token: "secret+https://secrets.example.com/token"},
+			errMsg: "fetching secrets from URLs is not supported here",
+		},
+		{
+			name: "fetch failure",
+			conf: &HarvesterConfig{Token: "secret+https://secrets.example.com/token"},
+			fetch: func(url string, _ SecretSource) (string, error) {
+				return "", fmt.Errorf("got 403 status code from %s", url)
+			},
+			errMsg: "got 403 status code from https://secrets.example.com/token",
+		},
+		{
+			name: "secret source password from URL",
+			conf: &HarvesterConfig{Install: Install{SecretSource: SecretSource{
+				BasicAuth: HTTPBasicAuth{Password: "secret+https://secrets.example.com/password"},
+			}}},
+			errMsg: "install.secretSource.basicAuth.password can't be fetched from a URL",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.conf.ResolveSecretReferences(tc.fetch)
+			assert.ErrorContains(t, err, tc.errMsg)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+const pemPrefix = "-----BEGIN"
+
+// TLSSettings configure the HTTPS requests of the installer, those fetching
+// configs, secrets, SSH keys and the ISO, and those calling webhooks.
+// Certificates and keys are either PEM text or the path of a PEM file.
+type TLSSettings struct {
+	// CACerts is a bundle of CA certificates trusted besides the system ones.
+	CACerts string `json:"caCerts,omitempty"`
+	// ClientCert and ClientKey authenticate the installer by mutual TLS.
+	ClientCert string `json:"clientCert,omitempty"`
+	ClientKey  string `json:"clientKey,omitempty" sensitive:"true"`
+	// Insecure skips the verification of server certificates.
+	Insecure bool `json:"insecure,omitempty"`
+	// Endpoints override the settings above for some hosts.
+	Endpoints []TLSEndpoint `json:"endpoints,omitempty"`
+}
+
+// TLSEndpoint overrides the TLS settings of requests to a host, or to a
+// port of it if Host is host:port.
+type TLSEndpoint struct {
+	Host       string `json:"host"`
+	CACerts    string `json:"caCerts,omitempty"`
+	ClientCert string `json:"clientCert,omitempty"`
+	ClientKey  string `json:"clientKey,omitempty" sensitive:"true"`
+	Insecure   bool   `json:"insecure,omitempty"`
+}
+
+// ForHost returns the settings of requests to hostport. Those of the
+// endpoint matching it most closely, if any, take precedence field by field.
+func (s TLSSettings) ForHost(hostport string) TLSSettings {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	result := s
+	result.Endpoints = nil
+	var byHost, byHostPort *TLSEndpoint
+	for i := range s.Endpoints {
+		switch s.Endpoints[i].Host {
+		case hostport:
+			byHostPort = &s.Endpoints[i]
+		case host:
+			byHost = &s.Endpoints[i]
+		}
+	}
+	for _, endpoint := range []*TLSEndpoint{byHost, byHostPort} {
+		if endpoint == nil {
+			continue
+		}
+		if endpoint.CACerts != "" {
+			result.CACerts = endpoint.CACerts
+		}
+		if endpoint.ClientCert != "" || endpoint.ClientKey != "" {
+			result.ClientCert, result.ClientKey = endpoint.ClientCert, endpoint.ClientKey
+		}
+		result.Insecure = result.Insecure || endpoint.Insecure
+	}
+	return result
+}
+
+// LoadPEM returns value if it is PEM text, otherwise the content of the file
+// at the path value.
+func LoadPEM(value string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), pemPrefix) {
+		return []byte(value), nil
+	}
+	return os.ReadFile(value)
+}
+
+// TLSConfig returns the tls.Config of the settings, leaving out those of
+// the endpoints.
+func (s TLSSettings) TLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: s.Insecure}
+	if s.CACerts != "" {
+		bundle, err := LoadPEM(s.CACerts)
+		if err != nil {
+			return nil, fmt.Errorf("fail to load caCerts: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates in caCerts")
+		}
+		cfg.RootCAs = pool
+	}
+	if s.ClientCert != "" || s.ClientKey != "" {
+		if s.ClientCert == "" || s.ClientKey == "" {
+			return nil, fmt.Errorf("clientCert and clientKey must be set together")
+		}
+		cert, err := LoadPEM(s.ClientCert)
+		if err != nil {
+			return nil, fmt.Errorf("fail to load clientCert: %w", err)
+		}
+		key, err := LoadPEM(s.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("fail to load clientKey: %w", err)
+		}
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return cfg, nil
+}
+
+// ValidateTLSSettings checks that the certificates and keys of the settings
+// can be loaded.
+func ValidateTLSSettings(s TLSSettings) error {
+	if _, err := s.TLSConfig(); err != nil {
+		return fmt.Errorf("invalid install.tls: %w", err)
+	}
+	for i, endpoint := range s.Endpoints {
+		if endpoint.Host == "" {
+			return fmt.Errorf("install.tls.endpoints[%d] has no host", i)
+		}
+		if _, err := s.ForHost(endpoint.Host).TLSConfig(); err != nil {
+			return fmt.Errorf("invalid install.tls.endpoints[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
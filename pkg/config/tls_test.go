@@ -0,0 +1,92 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSSettingsForHost(t *testing.T) {
+	settings := TLSSettings{
+		CACerts:    "global-ca",
+		ClientCert: "global-cert",
+		ClientKey:  "global-key",
+		Endpoints: []TLSEndpoint{
+			{Host: "config.example.com", CACerts: "config-ca"},
+			{Host: "config.example.com:8443", ClientCert: "port-cert", ClientKey: "port-key"},
+			{Host: "webhook.example.com", Insecure: true},
+		},
+	}
+	testCases := []struct {
+		host     string
+		expected TLSSettings
+	}{
+		{
+			host:     "other.example.com",
+			expected: TLSSettings{CACerts: "global-ca", ClientCert: "global-cert", ClientKey: "global-key"},
+		},
+		{
+			host:     "config.example.com",
+			expected: TLSSettings{CACerts: "config-ca", ClientCert: "global-cert", ClientKey: "global-key"},
+		},
+		{
+			host:     "config.example.com:443",
+			expected: TLSSettings{CACerts: "config-ca", ClientCert: "global-cert", ClientKey: "global-key"},
+		},
+		{
+			host:     "config.example.com:8443",
+			expected: TLSSettings{CACerts: "config-ca", ClientCert: "port-cert", ClientKey: "port-key"},
+		},
+		{
+			host:     "webhook.example.com",
+			expected: TLSSettings{CACerts: "global-ca", ClientCert: "global-cert", ClientKey: "global-key", Insecure: true},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.host, func(t *testing.T) {
+			assert.Equal(t, tc.expected, settings.ForHost(tc.host))
+		})
+	}
+}
+
+func TestValidateTLSSettings(t *testing.T) {
+	testCases := []struct {
+		name     string
+		settings TLSSettings
+		errMsg   string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "not a certificate",
+			settings: TLSSettings{CACerts: "-----BEGIN CERTIFICATE-----\nnope\n-----END CERTIFICATE-----\n"},
+			errMsg:   "no certificates in caCerts",
+		},
+		{
+			name:     "missing file",
+			settings: TLSSettings{CACerts: "/nonexistent/ca.pem"},
+			errMsg:   "fail to load caCerts",
+		},
+		{
+			name:     "client certificate without key",
+			settings: TLSSettings{Endpoints: []TLSEndpoint{{Host: "example.com", ClientCert: "/etc/cert.pem"}}},
+			errMsg:   "invalid install.tls.endpoints[0]: clientCert and clientKey must be set together",
+		},
+		{
+			name:     "endpoint without host",
+			settings: TLSSettings{Endpoints: []TLSEndpoint{{Insecure: true}}},
+			errMsg:   "install.tls.endpoints[0] has no host",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateTLSSettings(tc.settings)
+			if tc.errMsg != "" {
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
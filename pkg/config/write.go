@@ -6,7 +6,7 @@ import (
 )
 
 func PrintInstall(cfg HarvesterConfig) ([]byte, error) {
-	data, err := convert.EncodeToMap(cfg.Install)
+	data, err := convert.EncodeToMap(Redact(cfg.Install))
 	if err != nil {
 		return nil, err
 	}
@@ -39,6 +39,7 @@ func initLogs() error {
 		return err
 	}
 	logrus.SetOutput(f)
+	logrus.AddHook(logSecrets)
 	return nil
 }
 
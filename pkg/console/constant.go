@@ -20,6 +20,7 @@ const (
 	passwordConfirmPanel        = "osPasswordConfirm"
 	sshKeyPanel                 = "sshKey"
 	tokenPanel                  = "token"
+	tokenDisplayPanel           = "tokenDisplay"
 	proxyPanel                  = "proxy"
 	askInterfacePanel           = "askInterface"
 	askVlanIDPanel              = "askVlanID"
@@ -53,9 +54,16 @@ const (
 	askRolePanel                = "askRolePanel"
 	wipeDisksPanel              = "wipeDisksPanel"
 	wipeDisksTitlePanel         = "wipeDisksTitlePanel"
+	keymapPanel                 = "keymapPanel"
+	timezonePanel               = "timezonePanel"
+	localePanel                 = "localePanel"
+	localizationSearchPanel     = "localizationSearchPanel"
+	localizationNotePanel       = "localizationNotePanel"
+	localizationValidatorPanel  = "localizationValidatorPanel"
 
 	hostnameTitle         = "Configure hostname for this instance"
 	networkTitle          = "Configure network"
+	localizationTitle     = "Configure keyboard layout, timezone and locale"
 	diskLabel             = "Installation disk"
 	dataDiskLabel         = "Data disk"
 	persistentSizeLabel   = "Persistent size"
@@ -71,6 +79,9 @@ const (
 	dnsServersLabel       = "DNS Servers"
 	ntpServersLabel       = "NTP Servers"
 	wipeDisksLabel        = "Wipe Disks"
+	keymapLabel           = "Keyboard Layout"
+	timezoneLabel         = "Timezone"
+	localeLabel           = "Locale"
 
 	networkMethodDHCPText   = "Automatic (DHCP)"
 	networkMethodStaticText = "Static"
@@ -92,7 +103,7 @@ const (
 	clusterNetworkValidatorPanel = "clusterNetworkValidatorPanel"
 	clusterNetworkNote           = "Note: Leave blank to use the default pod CIDR 10.52.0.0/16, service CIDR 10.53.0.0/16 and cluster DNS 10.53.0.10. If the service CIDR is changed, the DNS IP must be updated to be within the service CIDR."
 
-	clusterTokenCreateNote = "Note: The token is used for adding nodes to the cluster"
+	clusterTokenCreateNote = "Note: The token is used for adding nodes to the cluster. Leave blank to generate a strong random token."
 	clusterTokenJoinNote   = "Note: Input the token of the existing cluster"
 	serverURLNote          = "Note: Input VIP/domain name of the management node"
 	proxyNote              = "Note: In the form of \"http://[[user][:pass]@]host[:port]/\"."
@@ -101,7 +112,10 @@ const (
 	dnsServersNote         = "Note: You can use comma to add more DNS servers. Leave blank to use default DNS."
 	bondNote               = "Note: Select one or more NICs for the Management NIC.\nUse the default value for the Bond Mode if only one NIC is selected."
 	forceMBRNote           = "Note: GPT is used by default. You can use MBR if you encountered compatibility issues."
+	localizationNote       = "Note: Type a name, or a part of it such as \"de\" or \"tokyo\", and press Enter to search. Leave blank to keep the system default."
 	persistentSizeNote     = "Note: persistent partition stores data like system package and container images, not the VM data. \nYou can specify a size like 200Gi or 153600Mi. \nLeave it blank to use the default value."
 
 	defaultHostname = "rancher"
+
+	maxLocalizationMatches = 10
 )
@@ -597,7 +597,14 @@ func (c *Console) getHarvesterConfig() error {
 	if err != nil {
 		return fmt.Errorf("failed to load harvester config from %s: %v", defaultHarvesterConfig, err)
 	}
+	// the dashboard itself doesn't need the secrets, don't block it
+	if secrets, err := config.ReadSecretsFile(config.SecretsFile, config.SecretsKeyFile); err != nil {
+		logrus.Errorf("failed to read secrets from %s: %v", config.SecretsFile, err)
+	} else {
+		conf.RestoreSecrets(secrets)
+	}
 	c.config = conf
+	redactSecretsInLogs(conf)
 
 	return nil
 }
@@ -0,0 +1,113 @@
+package console
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+var (
+	dmiDir = "/sys/class/dmi/id"
+	// So that we can fake the NICs up for unit tests
+	netInterfaces = net.Interfaces
+)
+
+func readDMIFile(name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dmiDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("fail to read DMI %s: %w", name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// getNodeFacts discovers the facts about the node the installer runs on.
+// The MAC addresses of the management interface NICs are taken from the
+// config, so they must have been looked up already.
+func getNodeFacts(cfg *config.HarvesterConfig) (config.NodeFacts, error) {
+	facts := config.NodeFacts{
+		NICs:  make(map[string]string),
+		Disks: make(map[string]string),
+	}
+
+	if hostname, err := os.Hostname(); err == nil && hostname != defaultHostname {
+		facts.Hostname = hostname
+	}
+
+	for _, iface := range cfg.ManagementInterface.Interfaces {
+		if iface.HwAddr != "" {
+			facts.MgmtHwAddrs = append(facts.MgmtHwAddrs, iface.HwAddr)
+		}
+	}
+	ifaces, err := netInterfaces()
+	if err != nil {
+		return facts, fmt.Errorf("fail to list network interfaces: %w", err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) == 0 {
+			continue
+		}
+		facts.NICs[iface.Name] = iface.HardwareAddr.String()
+	}
+	if iface, err := net.InterfaceByName(config.MgmtInterfaceName); err == nil {
+		facts.MACAddr = iface.HardwareAddr.String()
+		facts.IPAddrV4 = getIPAddr(iface, false)
+		facts.IPAddrV6 = getIPAddr(iface, true)
+	}
+
+	for name, field := range map[string]*string{
+		"product_serial": &facts.DMI.Serial,
+		"product_name":   &facts.DMI.ProductName,
+		"product_uuid":   &facts.DMI.UUID,
+	} {
+		if *field, err = readDMIFile(name); err != nil {
+			return facts, err
+		}
+	}
+
+	output, err := run(exec.Command("/bin/sh", "-c", `lsblk -J -d -o NAME,TYPE,SERIAL`))
+	if err != nil {
+		return facts, fmt.Errorf("fail to list disks: %w", err)
+	}
+	disks := &BlockDevices{}
+	if err := json.Unmarshal(output, disks); err != nil {
+		return facts, fmt.Errorf("error unmarshalling lsblk json output: %v", err)
+	}
+	for _, disk := range disks.Disks {
+		if disk.DiskType == diskType && disk.Serial != "" {
+			facts.Disks[disk.Serial] = "/dev/" + disk.Name
+		}
+	}
+	return facts, nil
+}
+
+// renderConfigTemplates renders the templates in the config values with the
+// facts about the node.
+func renderConfigTemplates(cfg *config.HarvesterConfig) error {
+	facts, err := getNodeFacts(cfg)
+	if err != nil {
+		return err
+	}
+	return cfg.RenderTemplates(facts)
+}
+
+// renderedConfig returns a copy of the config with its templates rendered,
+// or the config itself if it has none.
+func renderedConfig(cfg *config.HarvesterConfig) (*config.HarvesterConfig, error) {
+	if !cfg.Templating {
+		return cfg, nil
+	}
+	rendered := cfg.Clone()
+	if err := renderConfigTemplates(rendered); err != nil {
+		return nil, err
+	}
+	return rendered, nil
+}
@@ -0,0 +1,79 @@
+package console
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+func Test_getNodeFacts(t *testing.T) {
+	defer func() {
+		run = runCommand
+		dmiDir = "/sys/class/dmi/id"
+		netInterfaces = net.Interfaces
+	}()
+
+	dmiDir = t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dmiDir, "product_serial"), []byte("SN0001\n"), 0444))
+	assert.Nil(t, os.WriteFile(filepath.Join(dmiDir, "product_name"), []byte("ProLiant DL360 Gen10\n"), 0444))
+	run = func(_ *exec.Cmd) ([]byte, error) {
+		return []byte(`{
+   "blockdevices": [
+      {"name":"sda", "type":"disk", "serial":"DISK0001"},
+      {"name":"sdb", "type":"disk", "serial":null},
+      {"name":"sr0", "type":"rom", "serial":"QM00003"}
+   ]
+}`), nil
+	}
+	netInterfaces = func() ([]net.Interface, error) {
+		return []net.Interface{
+			{Name: "lo", Flags: net.FlagLoopback},
+			{Name: "ens3", HardwareAddr: net.HardwareAddr{0x52, 0x54, 0x00, 0xab, 0xcd, 0x01}},
+			{Name: "ens4", HardwareAddr: net.HardwareAddr{0x52, 0x54, 0x00, 0xab, 0xcd, 0x02}},
+		}, nil
+	}
+
+	cfg := config.NewHarvesterConfig()
+	cfg.ManagementInterface.Interfaces = []config.NetworkInterface{
+		{Name: "ens3", HwAddr: "52:54:00:ab:cd:01"},
+		{Name: "ens5"},
+	}
+	facts, err := getNodeFacts(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"52:54:00:ab:cd:01"}, facts.MgmtHwAddrs)
+	assert.Equal(t, map[string]string{"ens3": "52:54:00:ab:cd:01", "ens4": "52:54:00:ab:cd:02"}, facts.NICs)
+	assert.Equal(t, config.DMIFacts{Serial: "SN0001", ProductName: "ProLiant DL360 Gen10"}, facts.DMI)
+	assert.Equal(t, map[string]string{"DISK0001": "/dev/sda"}, facts.Disks)
+}
+
+func Test_renderedConfig(t *testing.T) {
+	defer func() {
+		run = runCommand
+		dmiDir = "/sys/class/dmi/id"
+	}()
+
+	dmiDir = t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dmiDir, "product_serial"), []byte("SN0001\n"), 0444))
+	run = func(_ *exec.Cmd) ([]byte, error) {
+		return []byte(`{"blockdevices": []}`), nil
+	}
+
+	cfg := config.NewHarvesterConfig()
+	cfg.OS.Hostname = "hv-{{ .DMI.Serial | lower }}"
+	rendered, err := renderedConfig(cfg)
+	assert.Nil(t, err)
+	assert.Same(t, cfg, rendered)
+
+	cfg.Templating = true
+	rendered, err = renderedConfig(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, "hv-sn0001", rendered.OS.Hostname)
+	// templates are rendered again at install, with the final facts
+	assert.Equal(t, "hv-{{ .DMI.Serial | lower }}", cfg.OS.Hostname)
+}
@@ -3,6 +3,7 @@ package console
 import (
 	"github.com/jroimartin/gocui"
 
+	"github.com/harvester/harvester-installer/pkg/config"
 	"github.com/harvester/harvester-installer/pkg/util"
 	"github.com/harvester/harvester-installer/pkg/widgets"
 )
@@ -74,6 +75,7 @@ func (p *passwordWrapper) passwordConfirmVKeyEnter(_ *gocui.Gui, _ *gocui.View)
 		return err
 	}
 	p.c.config.Password = encrypted
+	p.c.config.PasswordFormat = config.PasswordFormatHash
 	//TODO: When booted in install mode.. show steps for application of config
 	if installModeOnly {
 		return showNext(p.c, confirmInstallPanel)
@@ -0,0 +1,198 @@
+package console
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+// systemCABundle is where the CAs trusted by the system are.
+const systemCABundle = "/etc/ssl/ca-bundle.pem"
+
+var (
+	tlsSettingsLock sync.RWMutex
+	// tlsSettings are those of the config, for the HTTP clients to use.
+	tlsSettings config.TLSSettings
+)
+
+// setTLSSettings makes the HTTP clients built from then on use the TLS
+// settings of the config.
+func setTLSSettings(settings config.TLSSettings) {
+	tlsSettingsLock.Lock()
+	defer tlsSettingsLock.Unlock()
+	tlsSettings = settings
+}
+
+// setConfigTLSSettings makes the HTTP clients use the TLS settings of cfg,
+// trusting the additional CAs of the OS fetched so far too.
+func setConfigTLSSettings(cfg *config.HarvesterConfig) error {
+	settings, err := cfg.InstallerTLSSettings()
+	if err != nil {
+		return err
+	}
+	setTLSSettings(settings)
+	return nil
+}
+
+// fetchAdditionalCAs replaces the URLs in os.additionalCAs with the
+// certificates fetched from them, signed if the installation has a trusted
+// key.
+func fetchAdditionalCAs(cfg *config.HarvesterConfig) error {
+	fetch, err := newVerifiedFetcher(cfg.Install)
+	if err != nil {
+		return err
+	}
+	for i, ca := range cfg.OS.AdditionalCAs {
+		if !config.IsCAURL(ca) {
+			continue
+		}
+		pem, err := fetch(ca)
+		if err != nil {
+			return fmt.Errorf("fail to fetch os.additionalCAs[%d]: %w", i, err)
+		}
+		if err := config.ValidateCertificates(pem); err != nil {
+			return fmt.Errorf("invalid os.additionalCAs[%d] from %s: %w", i, ca, err)
+		}
+		cfg.OS.AdditionalCAs[i] = string(pem)
+	}
+	return setConfigTLSSettings(cfg)
+}
+
+func getTLSSettings() config.TLSSettings {
+	tlsSettingsLock.RLock()
+	defer tlsSettingsLock.RUnlock()
+	return tlsSettings
+}
+
+// httpClientOptions are what sets the clients of newHTTPClient apart.
+type httpClientOptions struct {
+	// timeout is defaultHTTPTimeout if zero, and no timeout if negative.
+	timeout time.Duration
+	// noProxy makes requests directly, whatever the proxy environment.
+	noProxy bool
+	// insecure skips the verification of server certificates.
+	insecure bool
+}
+
+// newHTTPClient returns a client for the requests of the installer. It
+// goes through the proxy of the environment and uses the TLS settings of
+// the config, those of the endpoint overrides for the hosts they match.
+func newHTTPClient(opts httpClientOptions) http.Client {
+	timeout := opts.timeout
+	if timeout == 0 {
+		timeout = defaultHTTPTimeout
+	} else if timeout < 0 {
+		timeout = 0
+	}
+	return http.Client{
+		Timeout: timeout,
+		Transport: &hostTransport{
+			settings:   getTLSSettings(),
+			opts:       opts,
+			transports: make(map[string]*http.Transport),
+		},
+	}
+}
+
+// hostTransport makes requests with a transport for each host, set up with
+// the TLS settings of the host. Redirects to other hosts get their settings.
+type hostTransport struct {
+	settings config.TLSSettings
+	opts     httpClientOptions
+
+	lock       sync.Mutex
+	transports map[string]*http.Transport
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport, err := t.transport(req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	return transport.RoundTrip(req)
+}
+
+func (t *hostTransport) transport(host string) (*http.Transport, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if transport, ok := t.transports[host]; ok {
+		return transport, nil
+	}
+	settings := t.settings.ForHost(host)
+	settings.Insecure = settings.Insecure || t.opts.insecure
+	tlsConfig, err := settings.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+	if !t.opts.noProxy {
+		transport.Proxy = proxyFromEnvironment
+	}
+	t.transports[host] = transport
+	return transport, nil
+}
+
+// writeCurlConfig writes a .curlrc with the TLS settings of the host of
+// rawURL, for the downloads of harv-install. It returns the directory to
+// set CURL_HOME to, or an empty string if there are no settings to write.
+func writeCurlConfig(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", err
+	}
+	settings := getTLSSettings().ForHost(u.Host)
+	if settings.CACerts == "" && settings.ClientCert == "" && !settings.Insecure {
+		return "", nil
+	}
+	dir, err := os.MkdirTemp("/tmp", "curl.")
+	if err != nil {
+		return "", err
+	}
+	var curlrc strings.Builder
+	if settings.Insecure {
+		curlrc.WriteString("insecure\n")
+	}
+	if settings.CACerts != "" {
+		// curl trusts only the bundle it is given, add the system CAs
+		bundle, err := os.ReadFile(systemCABundle)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		extra, err := config.LoadPEM(settings.CACerts)
+		if err != nil {
+			return "", err
+		}
+		path := filepath.Join(dir, "ca-bundle.pem")
+		if err := os.WriteFile(path, append(append(bundle, '\n'), extra...), 0644); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&curlrc, "cacert = %q\n", path)
+	}
+	if settings.ClientCert != "" {
+		for option, value := range map[string]string{"cert": settings.ClientCert, "key": settings.ClientKey} {
+			pem, err := config.LoadPEM(value)
+			if err != nil {
+				return "", err
+			}
+			path := filepath.Join(dir, option+".pem")
+			if err := os.WriteFile(path, pem, 0600); err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&curlrc, "%s = %q\n", option, path)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".curlrc"), []byte(curlrc.String()), 0600); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
@@ -0,0 +1,160 @@
+package console
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+// newTestCert returns a PEM certificate and key signed by parent, or a
+// self-signed CA if parent is nil.
+func newTestCert(t *testing.T, parent *tls.Certificate, template *x509.Certificate) (string, string, tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, any(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	assert.Nil(t, err)
+	pair.Leaf, err = x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return certPEM, keyPEM, pair
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	caPEM, _, ca := newTestCert(t, nil, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "internal CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	_, _, serverCert := newTestCert(t, &ca, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "config server"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	clientPEM, clientKeyPEM, _ := newTestCert(t, &ca, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "installer"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	assert.Nil(t, os.WriteFile(caFile, []byte(caPEM), 0644))
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.Leaf)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	testCases := []struct {
+		name     string
+		settings config.TLSSettings
+		opts     httpClientOptions
+		errMsg   string
+	}{
+		{
+			name:   "system roots",
+			errMsg: "certificate signed by unknown authority",
+		},
+		{
+			name:     "no client certificate",
+			settings: config.TLSSettings{CACerts: caFile},
+			errMsg:   "certificate required",
+		},
+		{
+			name:     "mutual TLS",
+			settings: config.TLSSettings{CACerts: caFile, ClientCert: clientPEM, ClientKey: clientKeyPEM},
+		},
+		{
+			name: "endpoint override",
+			settings: config.TLSSettings{
+				CACerts: "/nonexistent/ca.pem",
+				Endpoints: []config.TLSEndpoint{
+					{Host: host, CACerts: caPEM, ClientCert: clientPEM, ClientKey: clientKeyPEM},
+				},
+			},
+		},
+		{
+			name: "insecure by the caller",
+			settings: config.TLSSettings{
+				Endpoints: []config.TLSEndpoint{{Host: "127.0.0.1", ClientCert: clientPEM, ClientKey: clientKeyPEM}},
+			},
+			opts: httpClientOptions{insecure: true},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setTLSSettings(tc.settings)
+			defer setTLSSettings(config.TLSSettings{})
+			body, err := getURL(newHTTPClient(tc.opts), server.URL)
+			if tc.errMsg != "" {
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "ok", string(body))
+		})
+	}
+}
+
+func TestFetchAdditionalCAs(t *testing.T) {
+	caPEM, _, _ := newTestCert(t, nil, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "internal CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ca.pem" {
+			_, _ = w.Write([]byte(caPEM))
+			return
+		}
+		_, _ = w.Write([]byte("not a certificate"))
+	}))
+	defer server.Close()
+	defer setTLSSettings(config.TLSSettings{})
+
+	cfg := config.NewHarvesterConfig()
+	cfg.OS.AdditionalCAs = []string{server.URL + "/ca.pem"}
+	assert.Nil(t, fetchAdditionalCAs(cfg))
+	assert.Equal(t, []string{caPEM}, cfg.OS.AdditionalCAs)
+	assert.Equal(t, caPEM, getTLSSettings().CACerts)
+
+	cfg.OS.AdditionalCAs = []string{server.URL + "/index.html"}
+	assert.ErrorContains(t, fetchAdditionalCAs(cfg), "invalid os.additionalCAs[0]")
+}
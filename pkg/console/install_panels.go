@@ -94,7 +94,24 @@ func (c *Console) layoutInstall(_ *gocui.Gui) error {
 			initPanel = preflightCheckPanel
 		}
 
+		// startAutomatic goes straight to the installation if a config
+		// asks for it, on the first console only
+		startAutomatic := func(automatic bool) {
+			if !automatic || !isFirstConsoleTTY() {
+				return
+			}
+			logrus.Info("Start automatic installation...")
+			// setup InstallMode to ensure that during automatic install
+			// we are only copying binaries and ignoring network / rancherd setup
+			// needed for generating pre-installed qcow2 image
+			if c.config.Install.Mode == config.ModeInstall && !alreadyInstalled {
+				installModeOnly = true
+			}
+			initPanel = installPanel
+		}
+
 		c.config.OS.Modules = []string{"kvm", "vhost_net"}
+		c.config.SetSource("os.modules", config.SourceDefault)
 
 		// if already installed then lets check if cloud init allows us to provision
 		if alreadyInstalled {
@@ -115,25 +132,47 @@ func (c *Console) layoutInstall(_ *gocui.Gui) error {
 				logrus.Errorf("error merging config file: %v", err)
 				return
 			}
-			if cfg.Install.Automatic && isFirstConsoleTTY() {
-				logrus.Info("Start automatic installation...")
-				// setup InstallMode to ensure that during automatic install
-				// we are only copying binaries and ignoring network / rancherd setup
-				// needed for generating pre-installed qcow2 image
-				if c.config.Install.Mode == config.ModeInstall && !alreadyInstalled {
-					installModeOnly = true
-				}
-				initPanel = installPanel
-			}
+			startAutomatic(cfg.Install.Automatic)
 		} else {
 			logrus.Errorf("automatic install failed: %v\n", err)
 		}
 
+		// Config volumes, e.g. attached through the BMC as virtual media,
+		// fill in what the kernel cmdline leaves out.
+		volumeConfigs, volumeErr := readConfigVolumes(c.config.Install)
+		if volumeErr != nil {
+			logrus.Errorf("fail to read config volumes: %v", volumeErr)
+		}
+		for _, cfg := range volumeConfigs {
+			if err = c.config.Merge(*cfg); err != nil {
+				logrus.Errorf("error merging config volume: %v", err)
+				return
+			}
+			startAutomatic(cfg.Install.Automatic)
+		}
+
+		if err = setConfigTLSSettings(c.config); err != nil {
+			logrus.Errorf("error setting TLS: %v", err)
+			return
+		}
+		if c.config.Install.Proxy.Enabled() {
+			if err = setProxyEnvironment(c.config); err != nil {
+				logrus.Errorf("error setting the proxy: %v", err)
+				return
+			}
+		}
+		// the TUI applies them as they are chosen
+		if err := applyLocalization(c.config); err != nil {
+			logrus.Errorf("error applying the timezone, locale and keymap: %v", err)
+		}
+
 		// add SchemeVersion in non-automatic mode
 		// in automatic mode, SchemeVersion should be from config.yaml directly
 		if !c.config.Install.Automatic {
 			c.config.SchemeVersion = config.SchemeVersion
+			c.config.SetSource("schemeVersion", config.SourceDefault)
 		}
+		markTUIBaseline(c.config)
 
 		initElements := []string{
 			titlePanel,
@@ -165,6 +204,7 @@ func setPanels(c *Console) error {
 		addPreflightCheckPanel,
 		addAskCreatePanel,
 		addAskRolePanel,
+		addLocalizationPanel,
 		addDiskPanel,
 		addHostnamePanel,
 		addNetworkPanel,
@@ -174,6 +214,7 @@ func setPanels(c *Console) error {
 		addNTPServersPanel,
 		addServerURLPanel,
 		addTokenPanel,
+		addTokenDisplayPanel,
 		addPasswordPanels,
 		addSSHKeyPanel,
 		addProxyPanel,
@@ -323,10 +364,7 @@ func addDiskPanel(c *Console) error {
 	gotoPrevPage := func(_ *gocui.Gui, _ *gocui.View) error {
 		closeThisPage()
 		diskConfirmed = false
-		if c.config.Install.Mode == config.ModeJoin {
-			return showNext(c, askRolePanel)
-		}
-		return showNext(c, askCreatePanel)
+		return showLocalizationPage(c)
 	}
 
 	diskFatalV := widgets.NewPanel(c.Gui, diskFatalPanel)
@@ -960,15 +998,10 @@ func addAskCreatePanel(c *Console) error {
 				return showNext(c, confirmUpgradePanel)
 			}
 
-			// all packages are already install
-			// configure hostname and network
 			if c.config.Install.Mode == config.ModeJoin {
 				return showRolePage(c)
 			}
-			if alreadyInstalled {
-				return showNetworkPage(c)
-			}
-			return showDiskPage(c)
+			return showLocalizationPage(c)
 		},
 	}
 	c.AddElement(askCreatePanel, askCreateV)
@@ -1025,10 +1058,7 @@ func addAskRolePanel(c *Console) error {
 			if err = askRoleV.Close(); err != nil {
 				return err
 			}
-			if alreadyInstalled {
-				return showNetworkPage(c)
-			}
-			return showDiskPage(c)
+			return showLocalizationPage(c)
 		},
 		gocui.KeyEsc: gotoPrevPage,
 	}
@@ -1036,6 +1066,195 @@ func addAskRolePanel(c *Console) error {
 	return nil
 }
 
+func showLocalizationPage(c *Console) error {
+	names := []string{localizationNotePanel, localizationValidatorPanel}
+	for i := len(localizationSettings) - 1; i >= 0; i-- {
+		names = append(names, localizationSettings[i].panel)
+	}
+	return showNext(c, names...)
+}
+
+func addLocalizationPanel(c *Console) error {
+	setLocation := createVerticalLocator(c)
+
+	// the field searched and its matches
+	var (
+		searching     int
+		searchMatches []string
+	)
+	// the values that failed to apply, kept if entered again
+	failed := map[string]string{}
+	inputs := make([]*widgets.Input, len(localizationSettings))
+
+	closePage := func() {
+		names := []string{localizationSearchPanel, localizationNotePanel, localizationValidatorPanel}
+		for _, s := range localizationSettings {
+			names = append(names, s.panel)
+		}
+		c.CloseElements(names...)
+	}
+	prevPage := func(_ *gocui.Gui, _ *gocui.View) error {
+		closePage()
+		if c.config.Install.Mode == config.ModeJoin {
+			return showNext(c, askRolePanel)
+		}
+		return showNext(c, askCreatePanel)
+	}
+	showAfter := func(i int) error {
+		if i+1 < len(localizationSettings) {
+			return showNext(c, localizationSettings[i+1].panel)
+		}
+		closePage()
+		if alreadyInstalled {
+			return showNetworkPage(c)
+		}
+		return showDiskPage(c)
+	}
+	// choose sets the field and applies it to the installer right away
+	choose := func(i int, value string) error {
+		s := localizationSettings[i]
+		osConfig := c.config.OS
+		*s.field(&osConfig) = value
+		if err := config.ValidateLocalization(osConfig); err != nil {
+			return c.setContentByName(localizationValidatorPanel, err.Error())
+		}
+		*s.field(&c.config.OS) = value
+		if err := inputs[i].SetData(value); err != nil {
+			return err
+		}
+		if value != "" && failed[s.name] != value {
+			if err := s.applyLive(value); err != nil {
+				failed[s.name] = value
+				return c.setContentByName(localizationValidatorPanel,
+					fmt.Sprintf("%v. Press Enter again to use it anyway, or change the value.", err))
+			}
+		}
+		if err := c.setContentByName(localizationValidatorPanel, ""); err != nil {
+			return err
+		}
+		return showAfter(i)
+	}
+	confirm := func(i int) func(*gocui.Gui, *gocui.View) error {
+		return func(_ *gocui.Gui, _ *gocui.View) error {
+			s := localizationSettings[i]
+			query, err := inputs[i].GetData()
+			if err != nil {
+				return err
+			}
+			query = strings.TrimSpace(query)
+			if query == "" || query == failed[s.name] {
+				return choose(i, query)
+			}
+			names, err := s.names()
+			if err != nil {
+				// the system can't list them, take the value as it is
+				logrus.Warnf("fail to list the %ss: %v", s.name, err)
+				return choose(i, query)
+			}
+			matches := searchNames(names, query)
+			switch len(matches) {
+			case 0:
+				return c.setContentByName(localizationValidatorPanel, fmt.Sprintf("No %s matches %q", s.name, query))
+			case 1:
+				return choose(i, matches[0])
+			}
+			searching, searchMatches = i, matches
+			return showNext(c, localizationSearchPanel)
+		}
+	}
+
+	for i, s := range localizationSettings {
+		input, err := widgets.NewInput(c.Gui, s.panel, s.label, false)
+		if err != nil {
+			return err
+		}
+		input.PreShow = func() error {
+			c.Gui.Cursor = true
+			input.Value = *s.field(&c.config.OS)
+			if i > 0 {
+				return nil
+			}
+			if err := c.setContentByName(titlePanel, localizationTitle); err != nil {
+				return err
+			}
+			if err := c.setContentByName(localizationNotePanel, localizationNote); err != nil {
+				return err
+			}
+			return c.setContentByName(localizationValidatorPanel, "")
+		}
+		prevField := prevPage
+		if i > 0 {
+			prevField = func(_ *gocui.Gui, _ *gocui.View) error {
+				return showNext(c, localizationSettings[i-1].panel)
+			}
+		}
+		input.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+			gocui.KeyEsc:       prevPage,
+			gocui.KeyArrowUp:   prevField,
+			gocui.KeyArrowDown: confirm(i),
+			gocui.KeyEnter:     confirm(i),
+		}
+		setLocation(input, 3)
+		inputs[i] = input
+		c.AddElement(s.panel, input)
+	}
+
+	notePanel := widgets.NewPanel(c.Gui, localizationNotePanel)
+	notePanel.Focus = false
+	notePanel.Wrap = true
+	setLocation(notePanel, 4)
+	c.AddElement(localizationNotePanel, notePanel)
+
+	validatorPanel := widgets.NewPanel(c.Gui, localizationValidatorPanel)
+	validatorPanel.FgColor = gocui.ColorRed
+	validatorPanel.Focus = false
+	validatorPanel.Wrap = true
+	setLocation(validatorPanel, 3)
+	c.AddElement(localizationValidatorPanel, validatorPanel)
+
+	searchV, err := widgets.NewSelect(c.Gui, localizationSearchPanel, "", func() ([]widgets.Option, error) {
+		var options []widgets.Option
+		for _, name := range searchMatches[:min(len(searchMatches), maxLocalizationMatches)] {
+			options = append(options, widgets.Option{Value: name, Text: name})
+		}
+		return options, nil
+	})
+	if err != nil {
+		return err
+	}
+	searchV.PreShow = func() error {
+		c.Gui.Cursor = false
+		searchV.Value = ""
+		if len(searchMatches) > maxLocalizationMatches {
+			return c.setContentByName(localizationValidatorPanel, fmt.Sprintf(
+				"%d matches, showing the first %d. Press Esc to refine the search.", len(searchMatches), maxLocalizationMatches))
+		}
+		return c.setContentByName(localizationValidatorPanel, "")
+	}
+	searchV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter: func(_ *gocui.Gui, _ *gocui.View) error {
+			value, err := searchV.GetData()
+			if err != nil {
+				return err
+			}
+			if err = searchV.Close(); err != nil {
+				return err
+			}
+			return choose(searching, value)
+		},
+		gocui.KeyEsc: func(_ *gocui.Gui, _ *gocui.View) error {
+			if err := searchV.Close(); err != nil {
+				return err
+			}
+			return showNext(c, localizationSettings[searching].panel)
+		},
+	}
+	setLocation(searchV, maxLocalizationMatches+2)
+	c.AddElement(localizationSearchPanel, searchV)
+
+	return nil
+}
+
 func addServerURLPanel(c *Console) error {
 	serverURLV, err := widgets.NewInput(c.Gui, serverURLPanel, "Management address", false)
 	if err != nil {
@@ -1285,6 +1504,15 @@ func addTokenPanel(c *Console) error {
 			if err != nil {
 				return err
 			}
+			if c.config.Install.Mode == config.ModeCreate && (token == "" || token == config.TokenAuto) {
+				if c.config.Token, err = util.GenerateToken(); err != nil {
+					return err
+				}
+				if err := closeThisPage(); err != nil {
+					return err
+				}
+				return showNext(c, tokenDisplayPanel)
+			}
 			if token == "" {
 				return c.setContentByName(validatorPanel, "Cluster token is required")
 			}
@@ -1312,6 +1540,41 @@ func addTokenPanel(c *Console) error {
 	return nil
 }
 
+func addTokenDisplayPanel(c *Console) error {
+	tokenDisplayV := widgets.NewPanel(c.Gui, tokenDisplayPanel)
+	tokenDisplayV.PreShow = func() error {
+		c.Gui.Cursor = false
+		content := fmt.Sprintf("A cluster token has been generated:\n\n    %s\n\n", c.config.Token)
+		content += "Write it down or scan the QR code below. It is needed to add more nodes to the cluster,\n" +
+			"and can be printed again on this node with \"harvester-installer show-token\".\n\n"
+		if qrCode, err := util.RenderQRCode(c.config.Token); err != nil {
+			logrus.Warnf("Failed to render QR code for the cluster token: %v", err)
+		} else if strings.Count(content+qrCode, "\n") < tokenDisplayV.Y1-tokenDisplayV.Y0-1 {
+			// only show the QR code when it fits, a truncated one can't be scanned
+			content += qrCode
+		}
+		// set content directly so that the QR code is neither wrapped nor truncated
+		tokenDisplayV.Content = content
+		return c.setContentByName(titlePanel, "Generated cluster token")
+	}
+	tokenDisplayV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
+		gocui.KeyEnter: func(_ *gocui.Gui, _ *gocui.View) error {
+			if err := tokenDisplayV.Close(); err != nil {
+				return err
+			}
+			return showNext(c, passwordConfirmPanel, passwordPanel)
+		},
+		gocui.KeyEsc: func(_ *gocui.Gui, _ *gocui.View) error {
+			if err := tokenDisplayV.Close(); err != nil {
+				return err
+			}
+			return showNext(c, tokenPanel)
+		},
+	}
+	c.AddElement(tokenDisplayPanel, tokenDisplayV)
+	return nil
+}
+
 func showNetworkPage(c *Console) error {
 	if mgmtNetwork.Method != config.NetworkMethodStatic {
 		return showNext(c, askVlanIDPanel, askBondModePanel, askNetworkMethodPanel, askInterfacePanel)
@@ -1653,10 +1916,7 @@ func addNetworkPanel(c *Console) error {
 	gotoPrevPage := func(_ *gocui.Gui, _ *gocui.View) error {
 		closeThisPage()
 		if alreadyInstalled {
-			if c.config.Install.Mode == config.ModeJoin {
-				return showNext(c, askRolePanel)
-			}
-			return showNext(c, askCreatePanel)
+			return showLocalizationPage(c)
 		}
 		return showDiskPage(c)
 	}
@@ -2299,7 +2559,10 @@ func addProxyPanel(c *Console) error {
 	}
 	proxyV.PreShow = func() error {
 		c.Gui.Cursor = true
-		proxyV.Value = os.Getenv("HTTP_PROXY")
+		proxyV.Value = c.config.Install.Proxy.HTTP
+		if proxyV.Value == "" {
+			proxyV.Value = os.Getenv("HTTP_PROXY")
+		}
 		if err := c.setContentByName(titlePanel, "Optional: configure proxy"); err != nil {
 			return err
 		}
@@ -2311,20 +2574,16 @@ func addProxyPanel(c *Console) error {
 			if err != nil {
 				return err
 			}
-			if proxy != "" {
-				if err = os.Setenv("HTTP_PROXY", proxy); err != nil {
-					return err
-				}
-				if err = os.Setenv("HTTPS_PROXY ", proxy); err != nil {
-					return err
-				}
-			} else {
-				if err = os.Unsetenv("HTTP_PROXY"); err != nil {
-					return err
-				}
-				if err = os.Unsetenv("HTTPS_PROXY"); err != nil {
-					return err
-				}
+			if proxy != c.config.Install.Proxy.HTTP {
+				c.config.Install.Proxy.HTTP = proxy
+				c.config.Install.Proxy.HTTPS = proxy
+			}
+			if err = config.ValidateProxy(c.config.Install.Proxy); err != nil {
+				return c.setContentByName(validatorPanel, err.Error())
+			}
+			c.CloseElement(validatorPanel)
+			if err = setProxyEnvironment(c.config); err != nil {
+				return err
 			}
 			if err = proxyV.Close(); err != nil {
 				return err
@@ -2343,6 +2602,7 @@ func addProxyPanel(c *Console) error {
 				return err
 			}
 			c.CloseElement(notePanel)
+			c.CloseElement(validatorPanel)
 			return showNext(c, ntpServersPanel)
 		},
 	}
@@ -2351,7 +2611,7 @@ func addProxyPanel(c *Console) error {
 }
 
 func addCloudInitPanel(c *Console) error {
-	cloudInitV, err := widgets.NewInput(c.Gui, cloudInitPanel, "HTTP URL", false)
+	cloudInitV, err := widgets.NewInput(c.Gui, cloudInitPanel, "Config URL", false)
 	if err != nil {
 		return err
 	}
@@ -2389,7 +2649,7 @@ func addCloudInitPanel(c *Console) error {
 				spinner.Start()
 
 				go func(g *gocui.Gui) {
-					if _, err = getRemoteConfig(configURL); err != nil {
+					if _, err = getRemoteConfig(c.config.Install); err != nil {
 						spinner.Stop(true, err.Error())
 						g.Update(func(_ *gocui.Gui) error {
 							return showNext(c, cloudInitPanel)
@@ -2439,30 +2699,60 @@ func addConfirmInstallPanel(c *Console) error {
 	if err != nil {
 		return err
 	}
+	showProvenance := false
 	confirmV.PreShow = func() error {
-		installBytes, err := config.PrintInstall(*c.config)
+		recordTUIInput(c.config)
+		setNodeSubnets(c.config)
+		if showProvenance {
+			confirmV.SetContent(c.config.Explain())
+			c.Gui.Cursor = false
+			if err := c.setContentByName(footerPanel, "<Press F2 to return to the installation options>"); err != nil {
+				return err
+			}
+			return c.setContentByName(titlePanel, "Sources of the configuration values")
+		}
+		// show the values the templates render to with the facts known so
+		// far, they are rendered again at install
+		var options string
+		shown, err := renderedConfig(c.config)
+		if err != nil {
+			logrus.Error(err)
+			options += fmt.Sprintf("fail to render config templates: %s\n", err)
+			shown = c.config
+		}
+		installBytes, err := config.PrintInstall(*shown)
 		if err != nil {
 			return err
 		}
-		options := fmt.Sprintf("install mode: %v\n", c.config.Install.Mode)
+		options += fmt.Sprintf("install mode: %v\n", shown.Install.Mode)
 		if !installModeOnly {
-			options += fmt.Sprintf("install role: %v\n", c.config.Install.Role)
+			options += fmt.Sprintf("install role: %v\n", shown.Install.Role)
 		}
-		options += fmt.Sprintf("hostname: %v\n", c.config.OS.Hostname)
+		options += fmt.Sprintf("hostname: %v\n", shown.OS.Hostname)
 		if userInputData.DNSServers != "" {
 			options += fmt.Sprintf("dns servers: %v\n", userInputData.DNSServers)
 		}
 		if userInputData.NTPServers != "" {
 			options += fmt.Sprintf("ntp servers: %v\n", userInputData.NTPServers)
 		}
-		if proxy := os.Getenv("HTTP_PROXY"); proxy != "" {
-			options += fmt.Sprintf("proxy address: %v\n", proxy)
+		for _, s := range localizationSettings {
+			if value := *s.field(&shown.OS); value != "" {
+				options += fmt.Sprintf("%s: %v\n", s.name, value)
+			}
+		}
+		if proxy := shown.Install.Proxy; proxy.Enabled() {
+			options += fmt.Sprintf("proxy address: %v\n", redactURL(proxy.HTTP))
+			if proxy.HTTPS != proxy.HTTP {
+				options += fmt.Sprintf("https proxy address: %v\n", redactURL(proxy.HTTPS))
+			}
+			options += fmt.Sprintf("no proxy: %v\n", shown.NoProxy())
 		}
 		if userInputData.SSHKeyURL != "" {
 			options += fmt.Sprintf("ssh key url: %v\n", userInputData.SSHKeyURL)
 		}
+		options += fmt.Sprintf("kernel arguments: %v\n", strings.Join(shown.KernelArgs(), " "))
 		options += string(installBytes)
-		logrus.Debug("cfm cfg: ", fmt.Sprintf("%+v", c.config.Install))
+		logrus.Debug("cfm cfg: ", fmt.Sprintf("%+v", config.Redact(c.config.Install)))
 		if !c.config.Install.Silent {
 			if alreadyInstalled {
 				confirmV.SetContent(options +
@@ -2476,6 +2766,9 @@ func addConfirmInstallPanel(c *Console) error {
 			}
 		}
 		c.Gui.Cursor = false
+		if err := c.setContentByName(footerPanel, "<Press F2 to show where the configuration values come from>"); err != nil {
+			return err
+		}
 		return c.setContentByName(titlePanel, "Confirm installation options")
 	}
 	confirmV.KeyBindings = map[gocui.Key]func(*gocui.Gui, *gocui.View) error{
@@ -2502,10 +2795,21 @@ func addConfirmInstallPanel(c *Console) error {
 			}
 			return showNext(c, installPanel)
 		},
+		gocui.KeyF2: func(_ *gocui.Gui, _ *gocui.View) error {
+			showProvenance = !showProvenance
+			if err := confirmV.Close(); err != nil {
+				return err
+			}
+			return confirmV.Show()
+		},
 		gocui.KeyEsc: func(_ *gocui.Gui, _ *gocui.View) error {
 			if err = confirmV.Close(); err != nil {
 				return err
 			}
+			if err = c.setContentByName(footerPanel, ""); err != nil {
+				return err
+			}
+			showProvenance = false
 			if installModeOnly {
 				return showNext(c, passwordConfirmPanel, passwordPanel)
 			}
@@ -2570,11 +2874,24 @@ func addInstallPanel(c *Console) error {
 				configureInstallModeDHCP(c)
 			}
 
+			recordTUIInput(c.config)
+
 			// Need to merge remote config first
+			fetch, err := newVerifiedFetcher(c.config.Install)
+			if err != nil {
+				logrus.Error(err)
+				printToPanel(c.Gui, err.Error(), installPanel)
+				return
+			}
+			if err := c.config.ApplyIncludes("", fetch); err != nil {
+				logrus.Error(err)
+				printToPanel(c.Gui, fmt.Sprintf("fail to apply includes: %s", err), installPanel)
+				return
+			}
 			logrus.Info("Local config: ", c.config)
 			if c.config.Install.ConfigURL != "" {
 				printToPanel(c.Gui, fmt.Sprintf("Fetching %s...", c.config.Install.ConfigURL), installPanel)
-				remoteConfig, err := retryRemoteConfig(c.config.Install.ConfigURL, c.Gui)
+				remoteConfig, err := retryRemoteConfig(c.config.Install, c.Gui)
 				if err != nil {
 					logrus.Error(err)
 					printToPanel(c.Gui, err.Error(), installPanel)
@@ -2586,7 +2903,49 @@ func addInstallPanel(c *Console) error {
 					return
 				}
 				logrus.Info("Local config (merged): ", c.config)
+				if err = setConfigTLSSettings(c.config); err != nil {
+					printToPanel(c.Gui, fmt.Sprintf("fail to set TLS: %s", err), installPanel)
+					return
+				}
+				if c.config.Install.Proxy.Enabled() {
+					if err = setProxyEnvironment(c.config); err != nil {
+						printToPanel(c.Gui, fmt.Sprintf("fail to set the proxy: %s", err), installPanel)
+						return
+					}
+				}
+			}
+
+			if err := c.config.ResolveSecretReferences(fetchSecret); err != nil {
+				logrus.Error(err)
+				printToPanel(c.Gui, err.Error(), installPanel)
+				return
+			}
+
+			if err := fetchAdditionalCAs(c.config); err != nil {
+				logrus.Error(err)
+				printToPanel(c.Gui, err.Error(), installPanel)
+				return
+			}
+
+			if c.config.Install.Mode == config.ModeCreate && c.config.Token == config.TokenAuto {
+				token, err := util.GenerateToken()
+				if err != nil {
+					printToPanel(c.Gui, fmt.Sprintf("fail to generate token: %s", err), installPanel)
+					return
+				}
+				c.config.Token = token
+				c.config.SetSource("token", config.SourceGenerated)
+				logrus.Info("Generated a random cluster token, run \"harvester-installer show-token\" on the node to print it")
+			}
+			// every secret is final but the password, whose plain text is
+			// gone once hashed: redact both the plain text and the hash
+			redactSecretsInLogs(c.config)
+			if err := c.config.HashPassword(); err != nil {
+				logrus.Error(err)
+				printToPanel(c.Gui, err.Error(), installPanel)
+				return
 			}
+			redactSecretsInLogs(c.config)
 
 			// case insensitive for network method and vip mode
 			c.config.ManagementInterface.Method = strings.ToLower(c.config.ManagementInterface.Method)
@@ -2604,15 +2963,48 @@ func addInstallPanel(c *Console) error {
 				}
 			}
 
-			if c.config.Automatic && c.config.Install.ManagementInterface.Method == config.NetworkMethodDHCP {
-				// Only need to do this for automatic installs, as manual installs will
-				// have already run applyNetworks()
+			// The node inventory may be keyed by the MAC addresses just
+			// looked up, and may set a static IP, so it goes before
+			// networks are applied. It is validated first, as the rest of
+			// the config is only once the networks are up.
+			if err := config.ValidateNodes(c.config.Nodes, c.config.ManagementInterface, c.config.OS.DNSNameservers); err != nil {
+				logrus.Error(err)
+				printToPanel(c.Gui, fmt.Sprintf("Invalid node inventory: %s", err), installPanel)
+				return
+			}
+			node, err := applyNodeInventory(c.config)
+			if err != nil {
+				logrus.Error(err)
+				printToPanel(c.Gui, fmt.Sprintf("fail to apply node inventory: %s", err), installPanel)
+				return
+			}
+			inventoryNetwork := node != nil && node.IP != ""
+
+			// A templated hostname isn't rendered until the network is up,
+			// so the networks are applied without it and it is set once
+			// rendered.
+			liveHostname := c.config.Hostname
+			templatedHostname := c.config.Templating && strings.Contains(liveHostname, "{{")
+			if templatedHostname {
+				liveHostname = ""
+			}
+
+			// Only need to do this for automatic installs, as manual installs will
+			// have already run applyNetworks(), unless the inventory replaced
+			// the network they applied
+			if (c.config.Automatic && c.config.Install.ManagementInterface.Method == config.NetworkMethodDHCP) || inventoryNetwork {
 				printToPanel(c.Gui, "Configuring network...", installPanel)
-				if output, err := applyNetworks(c.config.ManagementInterface, c.config.Hostname); err != nil {
+				if output, err := applyNetworks(c.config.ManagementInterface, liveHostname); err != nil {
 					printToPanel(c.Gui, fmt.Sprintf("Can't apply networks: %s\n%s", err, string(output)), installPanel)
 					return
 				}
 			}
+			if inventoryNetwork {
+				if err := updateDNSServersAndReloadNetConfig(c.config.OS.DNSNameservers, c.config.ManagementInterface.VlanID); err != nil {
+					printToPanel(c.Gui, fmt.Sprintf("Can't set DNS servers: %s", err), installPanel)
+					return
+				}
+			}
 
 			if needToGetVIPFromDHCP(c.config.VipMode, c.config.Vip, c.config.VipHwAddr) {
 				vip, err := getVipThroughDHCP(getManagementInterfaceName(c.config.ManagementInterface), "")
@@ -2622,12 +3014,29 @@ func addInstallPanel(c *Console) error {
 				}
 				c.config.Vip = vip.ipv4Addr
 				c.config.VipHwAddr = vip.hwAddr
+				c.config.SetSource("install.vip", config.SourceDHCP)
+				c.config.SetSource("install.vipHwAddr", config.SourceDHCP)
+			}
+
+			// Values may refer to facts like the DHCP-assigned IP, so
+			// templates are rendered once the network is up.
+			if err := renderConfigTemplates(c.config); err != nil {
+				logrus.Error(err)
+				printToPanel(c.Gui, fmt.Sprintf("fail to render config templates: %s", err), installPanel)
+				return
 			}
 
 			// If no hostname was provided in the config, this function will
 			// default the hostname to either what's supplied by the DHCP sever,
 			// or a randomly generated name.
 			checkDHCPHostname(c.config, true)
+			if templatedHostname {
+				if err := setLiveHostname(c.config.Hostname); err != nil {
+					logrus.Error(err)
+					printToPanel(c.Gui, err.Error(), installPanel)
+					return
+				}
+			}
 
 			if c.config.TTY == "" {
 				c.config.TTY = getFirstConsoleTTY()
@@ -3222,9 +3631,11 @@ func checkDHCPHostname(c *config.HarvesterConfig, generate bool) {
 
 		if hostname != defaultHostname && hostname != "" {
 			c.Hostname = hostname
+			c.SetSource("os.hostname", config.SourceDHCP)
 		} else {
 			if generate {
 				c.Hostname = generateHostName()
+				c.SetSource("os.hostname", config.SourceGenerated)
 			}
 		}
 	}
@@ -3241,9 +3652,15 @@ func mergeCloudInit(c *config.HarvesterConfig) error {
 		}
 		if cloudConfig.OS.Hostname != "" {
 			c.OS.Hostname = cloudConfig.OS.Hostname
+			c.CopySource("os.hostname", &cloudConfig)
 		}
 		if cloudConfig.OS.Password != "" {
 			c.OS.Password = cloudConfig.OS.Password
+			c.OS.PasswordFormat = cloudConfig.OS.PasswordFormat
+			c.OS.PasswordHashAlgorithm = cloudConfig.OS.PasswordHashAlgorithm
+			for _, path := range []string{"os.password", "os.passwordFormat", "os.passwordHashAlgorithm"} {
+				c.CopySource(path, &cloudConfig)
+			}
 		}
 	}
 
@@ -0,0 +1,307 @@
+package console
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+var (
+	// trustedKeyFile is the public key built into the ISO, if any.
+	trustedKeyFile = "/etc/harvester/installer.pub"
+
+	errIntegrity       = errors.New("integrity check failed")
+	errUnreadableImage = errors.New("can't read the image before installing")
+)
+
+// trustedPublicKey returns the key signatures must be made with, the one
+// configured or else the one built into the ISO. It returns nil if there
+// is neither, then nothing has to be signed.
+func trustedPublicKey(install config.Install) (*util.PublicKey, error) {
+	text := install.PublicKey
+	if text == "" {
+		b, err := os.ReadFile(trustedKeyFile)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+	key, err := util.ParsePublicKey(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return key, nil
+}
+
+// mergeDigests returns the digest given either way, which must agree if
+// given both ways.
+func mergeDigests(digest, urlDigest string) (string, error) {
+	digest = strings.ToLower(digest)
+	if digest != "" && urlDigest != "" && digest != urlDigest {
+		return "", fmt.Errorf("%s %s of the URL doesn't match the configured %s", util.SHA256Param, urlDigest, digest)
+	}
+	if digest == "" {
+		return urlDigest, nil
+	}
+	return digest, nil
+}
+
+// verifiedConfigSource checks the config of a source against a digest and
+// a detached signature.
+type verifiedConfigSource struct {
+	ConfigSource
+	digest string
+	key    *util.PublicKey
+	// signature is where the signature is read from, nil if the config
+	// doesn't have to be signed.
+	signature ConfigSource
+}
+
+func (s *verifiedConfigSource) Fetch() ([]byte, error) {
+	data, err := s.ConfigSource.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	var signature *util.Signature
+	if s.signature != nil {
+		b, err := s.signature.Fetch()
+		if err != nil {
+			// not errNoConfig, an unsigned config is no reason to go on without it
+			return nil, fmt.Errorf("%w: fail to fetch the signature %s: %v", errIntegrity, s.signature, err)
+		}
+		if signature, err = util.ParseSignature(string(b)); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", errIntegrity, s.signature, err)
+		}
+	}
+	verifier, err := util.NewVerifier(s.digest, s.key, signature)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := verifier.Write(data); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", errIntegrity, s, err)
+	}
+	if _, err := verifier.Verify(); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", errIntegrity, s, err)
+	}
+	return data, nil
+}
+
+// signatureSource returns where the signature of the config of a source is
+// by default, next to the config.
+func signatureSource(source ConfigSource) (ConfigSource, error) {
+	switch s := source.(type) {
+	case httpConfigSource:
+		return s + util.SignatureSuffix, nil
+	case *fileConfigSource:
+		return &fileConfigSource{label: s.label, path: s.path + util.SignatureSuffix}, nil
+	case *volumeConfigSource:
+		return &fileConfigSource{label: s.label, path: s.path + util.SignatureSuffix}, nil
+	default:
+		return nil, fmt.Errorf("no default signature location for %s, set configSignatureUrl", source)
+	}
+}
+
+// verifyConfigSource makes the source check its config against the digest,
+// and against a signature if a key is given. The signature is read from
+// signatureURL, or from next to the config if it is empty.
+func verifyConfigSource(source ConfigSource, digest string, key *util.PublicKey, signatureURL string) (ConfigSource, error) {
+	verified, ok := source.(*verifiedConfigSource)
+	if !ok {
+		verified = &verifiedConfigSource{ConfigSource: source}
+	}
+	var err error
+	if verified.digest, err = mergeDigests(digest, verified.digest); err != nil {
+		return nil, err
+	}
+	if key != nil {
+		verified.key = key
+		if signatureURL != "" {
+			verified.signature, err = newConfigSource(signatureURL)
+		} else {
+			verified.signature, err = signatureSource(verified.ConfigSource)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if verified.digest == "" && verified.signature == nil {
+		return source, nil
+	}
+	return verified, nil
+}
+
+// newVerifiedFetcher returns a fetcher checking what it fetches against the
+// digest of its URL and, if the installation has a trusted key, against the
+// signature next to it, for included configs and CA certificates.
+func newVerifiedFetcher(install config.Install) (config.ConfigFetcher, error) {
+	key, err := trustedPublicKey(install)
+	if err != nil {
+		return nil, err
+	}
+	return func(configURL string) ([]byte, error) {
+		source, err := newConfigSource(configURL)
+		if err != nil {
+			return nil, err
+		}
+		if source, err = verifyConfigSource(source, "", key, ""); err != nil {
+			return nil, err
+		}
+		return source.Fetch()
+	}, nil
+}
+
+// newInstallConfigSource returns the source of the config at the config URL
+// of the installation, checked as the installation says.
+func newInstallConfigSource(install config.Install) (ConfigSource, error) {
+	source, err := newConfigSource(install.ConfigURL)
+	if err != nil {
+		return nil, err
+	}
+	key, err := trustedPublicKey(install)
+	if err != nil {
+		return nil, err
+	}
+	return verifyConfigSource(source, install.ConfigSHA256, key, install.ConfigSignatureURL)
+}
+
+// isVerifiedConfig tells if the config of the installation is checked when
+// it is fetched.
+func isVerifiedConfig(install config.Install) (bool, error) {
+	if install.ConfigURL == "" {
+		return false, nil
+	}
+	source, err := newInstallConfigSource(install)
+	if err != nil {
+		return false, err
+	}
+	_, ok := source.(*verifiedConfigSource)
+	return ok, nil
+}
+
+// openImage returns the content of the image at imageURL, if it can be read
+// before installing.
+func openImage(imageURL string) (io.ReadCloser, error) {
+	switch {
+	case isHTTPConfigURL(imageURL):
+		// an image takes longer than a config to download
+		client := newHTTPClient(httpClientOptions{timeout: -1})
+		resp, err := client.Get(imageURL)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("got %d status code from %s", resp.StatusCode, imageURL)
+		}
+		return resp.Body, nil
+	case strings.Contains(imageURL, "://"):
+		return nil, fmt.Errorf("%w: %s", errUnreadableImage, imageURL)
+	default:
+		return os.Open(imageURL)
+	}
+}
+
+// verifyISO checks the ISO against its digest and signature before anything
+// is written to the disks. It removes the digest from the ISO URL and sets
+// the digest of the ISO checked, for harv-install to check the copy it
+// downloads against. Progress is reported to report.
+func verifyISO(install *config.Install, report func(string)) error {
+	if install.ISOURL == "" {
+		return nil
+	}
+	isoURL, digest, err := verifyImage(*install, install.ISOURL, install.ISOSHA256, install.ISOSignatureURL, report)
+	if err != nil {
+		return err
+	}
+	install.ISOURL, install.ISOSHA256 = isoURL, digest
+	return nil
+}
+
+// verifyRawDiskImage checks the raw disk image as verifyISO checks the ISO,
+// for stream-disk to check the copy it streams to the disk against.
+func verifyRawDiskImage(install *config.Install, report func(string)) error {
+	if install.RawDiskImagePath == "" {
+		return nil
+	}
+	imageURL, digest, err := verifyImage(*install, install.RawDiskImagePath, install.RawDiskImageSHA256, install.RawDiskImageSignatureURL, report)
+	if err != nil {
+		return err
+	}
+	install.RawDiskImagePath, install.RawDiskImageSHA256 = imageURL, digest
+	return nil
+}
+
+// verifyImage checks the image at imageURL against the digest, of the
+// install or of the URL, and the signature if the installation has a trusted
+// key. It returns the URL without the digest, and the digest checked.
+func verifyImage(install config.Install, imageURL, digest, signatureURL string, report func(string)) (string, string, error) {
+	imageURL, urlDigest, err := util.SplitDigestURL(imageURL)
+	if err != nil {
+		return "", "", err
+	}
+	if digest, err = mergeDigests(digest, urlDigest); err != nil {
+		return "", "", err
+	}
+	key, err := trustedPublicKey(install)
+	if err != nil {
+		return "", "", err
+	}
+	if digest == "" && key == nil {
+		return imageURL, "", nil
+	}
+
+	var signature *util.Signature
+	if key != nil {
+		if signatureURL == "" {
+			signatureURL = imageURL + util.SignatureSuffix
+		}
+		var b []byte
+		if strings.Contains(signatureURL, "://") {
+			b, err = fetchConfig(signatureURL)
+		} else {
+			b, err = os.ReadFile(signatureURL)
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("%w: fail to fetch the signature %s: %v", errIntegrity, signatureURL, err)
+		}
+		if signature, err = util.ParseSignature(string(b)); err != nil {
+			return "", "", fmt.Errorf("%w: %s: %v", errIntegrity, signatureURL, err)
+		}
+	}
+
+	image, err := openImage(imageURL)
+	if err != nil {
+		if errors.Is(err, errUnreadableImage) && signature == nil {
+			// the install scripts check the digest once they have
+			// downloaded the image
+			logrus.Warnf("Checking the digest of %s after the disks are partitioned: %v", imageURL, err)
+			return imageURL, digest, nil
+		}
+		return "", "", fmt.Errorf("fail to check the signature of %s: %w", imageURL, err)
+	}
+	defer image.Close() //nolint:errcheck
+
+	report(fmt.Sprintf("Verifying %s...", imageURL))
+	verifier, err := util.NewVerifier(digest, key, signature)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := io.Copy(verifier, image); err != nil {
+		return "", "", fmt.Errorf("%w: %s: %v", errIntegrity, imageURL, err)
+	}
+	if digest, err = verifier.Verify(); err != nil {
+		return "", "", fmt.Errorf("%w: %s: %v", errIntegrity, imageURL, err)
+	}
+	logrus.Infof("Verified %s, SHA-256 digest %s", imageURL, digest)
+	return imageURL, digest, nil
+}
@@ -0,0 +1,299 @@
+package console
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fakeTrustedKey fakes up the public key built into the ISO.
+func fakeTrustedKey(t *testing.T, publicKey string) {
+	path := filepath.Join(t.TempDir(), "installer.pub")
+	if publicKey != "" {
+		assert.Nil(t, os.WriteFile(path, []byte(publicKey), 0644))
+	}
+	trustedKeyFile = path
+	t.Cleanup(func() { trustedKeyFile = "/etc/harvester/installer.pub" })
+}
+
+func TestInstallConfigSource(t *testing.T) {
+	userData := "os:\n  hostname: node1\n"
+	publicKey, sign := util.MinisignKeyPair(t)
+	fakeDevices(t, map[string]map[string]string{
+		"/dev/sda2": {
+			"signed.yaml":           userData,
+			"signed.yaml.minisig":   sign([]byte(userData), true),
+			"tampered.yaml":         userData + "  password: p@ssw0rd\n",
+			"tampered.yaml.minisig": sign([]byte(userData), true),
+			"unsigned.yaml":         userData,
+		},
+	})
+
+	testCases := []struct {
+		name       string
+		install    config.Install
+		trustedKey string
+		errMsg     string
+	}{
+		{
+			name:    "digest in URL",
+			install: config.Install{ConfigURL: "file:///unsigned.yaml?sha256=" + sha256Hex([]byte(userData))},
+		},
+		{
+			name:    "configured digest",
+			install: config.Install{ConfigURL: "file:///unsigned.yaml", ConfigSHA256: sha256Hex([]byte(userData))},
+		},
+		{
+			name:    "digest mismatch",
+			install: config.Install{ConfigURL: "file:///tampered.yaml", ConfigSHA256: sha256Hex([]byte(userData))},
+			errMsg:  "doesn't match the expected",
+		},
+		{
+			name:    "conflicting digests",
+			install: config.Install{ConfigURL: "file:///unsigned.yaml?sha256=" + sha256Hex([]byte(userData)), ConfigSHA256: sha256Hex(nil)},
+			errMsg:  "doesn't match the configured",
+		},
+		{
+			name:    "signed",
+			install: config.Install{ConfigURL: "file:///signed.yaml", PublicKey: publicKey},
+		},
+		{
+			name:       "signed with built-in key",
+			install:    config.Install{ConfigURL: "file:///signed.yaml"},
+			trustedKey: publicKey,
+		},
+		{
+			name:    "signature elsewhere",
+			install: config.Install{ConfigURL: "file:///unsigned.yaml", PublicKey: publicKey, ConfigSignatureURL: "file:///signed.yaml.minisig"},
+		},
+		{
+			name:    "tampered",
+			install: config.Install{ConfigURL: "file:///tampered.yaml", PublicKey: publicKey},
+			errMsg:  "invalid signature",
+		},
+		{
+			name:       "unsigned",
+			install:    config.Install{ConfigURL: "file:///unsigned.yaml"},
+			trustedKey: publicKey,
+			errMsg:     "fail to fetch the signature",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeTrustedKey(t, tc.trustedKey)
+			source, err := newInstallConfigSource(tc.install)
+			if err == nil {
+				var data []byte
+				data, err = source.Fetch()
+				if err == nil {
+					assert.Equal(t, userData, string(data))
+				}
+			}
+			if tc.errMsg != "" {
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestReadSignedConfigVolumes(t *testing.T) {
+	userData := "os:\n  hostname: node1\n"
+	publicKey, sign := util.MinisignKeyPair(t)
+	fakeTrustedKey(t, publicKey)
+
+	fakeDevices(t, map[string]map[string]string{
+		"/dev/sr1": {"user-data": userData},
+	})
+	_, err := readConfigVolumes(config.Install{})
+	assert.True(t, errors.Is(err, errIntegrity))
+
+	fakeDevices(t, map[string]map[string]string{
+		"/dev/sr1": {"user-data": userData, "user-data.minisig": sign([]byte(userData), false)},
+	})
+	configs, err := readConfigVolumes(config.Install{})
+	assert.Nil(t, err)
+	if assert.Len(t, configs, 1) {
+		assert.Equal(t, "node1", configs[0].OS.Hostname)
+	}
+}
+
+func TestVerifyISO(t *testing.T) {
+	iso := []byte("harvester ISO")
+	publicKey, sign := util.MinisignKeyPair(t)
+	fakeTrustedKey(t, "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/harvester.iso":
+			_, _ = w.Write(iso)
+		case "/harvester.iso.minisig":
+			_, _ = w.Write([]byte(sign(iso, true)))
+		case "/cached.iso":
+			_, _ = w.Write(iso[:5])
+		case "/cached.iso.minisig":
+			_, _ = w.Write([]byte(sign(iso, true)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	localISO := filepath.Join(t.TempDir(), "harvester.iso")
+	assert.Nil(t, os.WriteFile(localISO, iso, 0644))
+
+	testCases := []struct {
+		name           string
+		install        config.Install
+		expectedURL    string
+		expectedDigest string
+		errMsg         string
+	}{
+		{
+			name:        "nothing to check",
+			install:     config.Install{ISOURL: server.URL + "/harvester.iso"},
+			expectedURL: server.URL + "/harvester.iso",
+		},
+		{
+			name:           "digest in URL",
+			install:        config.Install{ISOURL: server.URL + "/harvester.iso?sha256=" + sha256Hex(iso)},
+			expectedURL:    server.URL + "/harvester.iso",
+			expectedDigest: sha256Hex(iso),
+		},
+		{
+			name:           "signed",
+			install:        config.Install{ISOURL: server.URL + "/harvester.iso", PublicKey: publicKey},
+			expectedURL:    server.URL + "/harvester.iso",
+			expectedDigest: sha256Hex(iso),
+		},
+		{
+			name:           "local file",
+			install:        config.Install{ISOURL: localISO, ISOSHA256: sha256Hex(iso)},
+			expectedURL:    localISO,
+			expectedDigest: sha256Hex(iso),
+		},
+		{
+			name:    "truncated by a proxy",
+			install: config.Install{ISOURL: server.URL + "/cached.iso", PublicKey: publicKey},
+			errMsg:  "invalid signature",
+		},
+		{
+			name:    "digest mismatch",
+			install: config.Install{ISOURL: server.URL + "/cached.iso", ISOSHA256: sha256Hex(iso)},
+			errMsg:  "doesn't match the expected",
+		},
+		{
+			name:           "checked by harv-install",
+			install:        config.Install{ISOURL: "tftp://10.0.0.1/harvester.iso", ISOSHA256: sha256Hex(iso)},
+			expectedURL:    "tftp://10.0.0.1/harvester.iso",
+			expectedDigest: sha256Hex(iso),
+		},
+		{
+			name:    "signed but unreadable",
+			install: config.Install{ISOURL: "tftp://10.0.0.1/harvester.iso", PublicKey: publicKey, ISOSignatureURL: server.URL + "/harvester.iso.minisig"},
+			errMsg:  "fail to check the signature",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			install := tc.install
+			err := verifyISO(&install, func(string) {})
+			if tc.errMsg != "" {
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectedURL, install.ISOURL)
+			assert.Equal(t, tc.expectedDigest, install.ISOSHA256)
+		})
+	}
+}
+
+func TestVerifiedFetcher(t *testing.T) {
+	include := []byte("os:\n  hostname: node1\n")
+	publicKey, sign := util.MinisignKeyPair(t)
+	fakeTrustedKey(t, "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/signed.yaml", "/unsigned.yaml":
+			_, _ = w.Write(include)
+		case "/signed.yaml.minisig":
+			_, _ = w.Write([]byte(sign(include, true)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	// without a trusted key only digests of the URLs are checked
+	fetch, err := newVerifiedFetcher(config.Install{})
+	assert.Nil(t, err)
+	data, err := fetch(server.URL + "/unsigned.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, include, data)
+	_, err = fetch(server.URL + "/unsigned.yaml?sha256=" + sha256Hex([]byte("other")))
+	assert.ErrorIs(t, err, errIntegrity)
+
+	// with one everything fetched must be signed
+	fetch, err = newVerifiedFetcher(config.Install{PublicKey: publicKey})
+	assert.Nil(t, err)
+	data, err = fetch(server.URL + "/signed.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, include, data)
+	_, err = fetch(server.URL + "/unsigned.yaml")
+	assert.ErrorIs(t, err, errIntegrity)
+
+	cfg := config.NewHarvesterConfig()
+	cfg.Install.PublicKey = publicKey
+	cfg.Include = []string{server.URL + "/unsigned.yaml"}
+	assert.ErrorIs(t, cfg.ApplyIncludes("", fetch), errIntegrity)
+}
+
+func TestVerifyRawDiskImage(t *testing.T) {
+	image := []byte("harvester raw disk image")
+	publicKey, sign := util.MinisignKeyPair(t)
+	fakeTrustedKey(t, "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/harvester.raw.zst":
+			_, _ = w.Write(image)
+		case "/signatures/harvester.raw.zst.minisig":
+			_, _ = w.Write([]byte(sign(image, true)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	// the ISO isn't checked for stream-disk, which doesn't use it
+	install := config.Install{
+		ISOURL:                   server.URL + "/harvester.iso",
+		RawDiskImagePath:         server.URL + "/harvester.raw.zst",
+		RawDiskImageSignatureURL: server.URL + "/signatures/harvester.raw.zst.minisig",
+		PublicKey:                publicKey,
+	}
+	assert.Nil(t, verifyRawDiskImage(&install, func(string) {}))
+	assert.Equal(t, server.URL+"/harvester.raw.zst", install.RawDiskImagePath)
+	assert.Equal(t, sha256Hex(image), install.RawDiskImageSHA256)
+
+	install = config.Install{RawDiskImagePath: server.URL + "/harvester.raw.zst?sha256=" + sha256Hex([]byte("other"))}
+	assert.ErrorContains(t, verifyRawDiskImage(&install, func(string) {}), "doesn't match the expected")
+}
@@ -0,0 +1,30 @@
+package console
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+// applyNodeInventory applies the entry of the node inventory matching the
+// node the installer runs on, and returns it.
+func applyNodeInventory(c *config.HarvesterConfig) (*config.Node, error) {
+	if len(c.Nodes) == 0 {
+		return nil, nil
+	}
+	facts, err := getNodeFacts(c)
+	if err != nil {
+		return nil, err
+	}
+	node, err := c.ApplyNodeInventory(facts)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		logrus.Warnf("No entry of the node inventory matches this node (MAC addresses %v, system serial %q, disk serials %v)",
+			facts.MgmtHwAddrs, facts.DMI.Serial, facts.Disks)
+		return nil, nil
+	}
+	logrus.Infof("Applied node inventory entry %+v", *node)
+	return node, nil
+}
@@ -0,0 +1,138 @@
+package console
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+// zoneinfoDir is where the timezones known to the system are.
+var zoneinfoDir = "/usr/share/zoneinfo"
+
+// localizationSetting is a field of the localization page, one of the names
+// the system lists, applied to the live system when it is chosen.
+type localizationSetting struct {
+	name        string
+	panel       string
+	label       string
+	list        []string
+	apply       []string
+	applyFormat string
+	field       func(*config.OS) *string
+}
+
+// localizationSettings are in the order of the page, the keymap first for
+// everything typed after it.
+var localizationSettings = []localizationSetting{
+	{
+		name:        "keymap",
+		panel:       keymapPanel,
+		label:       keymapLabel,
+		list:        []string{"localectl", "list-keymaps"},
+		apply:       []string{"localectl", "set-keymap"},
+		applyFormat: "%s",
+		field:       func(os *config.OS) *string { return &os.Keymap },
+	},
+	{
+		name:        "timezone",
+		panel:       timezonePanel,
+		label:       timezoneLabel,
+		list:        []string{"timedatectl", "list-timezones"},
+		apply:       []string{"timedatectl", "set-timezone"},
+		applyFormat: "%s",
+		field:       func(os *config.OS) *string { return &os.Timezone },
+	},
+	{
+		name:        "locale",
+		panel:       localePanel,
+		label:       localeLabel,
+		list:        []string{"localectl", "list-locales"},
+		apply:       []string{"localectl", "set-locale"},
+		applyFormat: "LANG=%s",
+		field:       func(os *config.OS) *string { return &os.Locale },
+	},
+}
+
+// names returns the names the system knows.
+func (s localizationSetting) names() ([]string, error) {
+	output, err := exec.Command(s.list[0], s.list[1:]...).Output()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(output)), nil
+}
+
+// applyLive applies the value to the installer, the keymap to the consoles
+// the passwords and tokens are typed on.
+func (s localizationSetting) applyLive(value string) error {
+	args := append(slices.Clone(s.apply[1:]), fmt.Sprintf(s.applyFormat, value))
+	output, err := exec.Command(s.apply[0], args...).CombinedOutput()
+	if err != nil {
+		logrus.Error(err, string(output))
+		return fmt.Errorf("fail to set the %s: %w", s.name, err)
+	}
+	return nil
+}
+
+// searchNames returns the name matching the query exactly, or those
+// containing it, case-insensitively and with spaces as underscores.
+func searchNames(names []string, query string) []string {
+	query = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(query)), " ", "_")
+	var matches []string
+	for _, name := range names {
+		lower := strings.ToLower(name)
+		if lower == query {
+			return []string{name}
+		}
+		if strings.Contains(lower, query) {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
+
+// checkLocalization checks the timezone is in the tz database of the system,
+// and the locale and keymap are among those it lists, if it can list them.
+func checkLocalization(cfg *config.HarvesterConfig) error {
+	for _, s := range localizationSettings {
+		value := *s.field(&cfg.OS)
+		if value == "" {
+			continue
+		}
+		if s.name == "timezone" {
+			if info, err := os.Stat(filepath.Join(zoneinfoDir, value)); err != nil || !info.Mode().IsRegular() {
+				return fmt.Errorf("os.timezone %s is not a known timezone", value)
+			}
+			continue
+		}
+		names, err := s.names()
+		if err != nil {
+			logrus.Warnf("Fail to list the %ss, os.%s %s is not checked: %v", s.name, s.name, value, err)
+			continue
+		}
+		if !slices.Contains(names, value) {
+			return fmt.Errorf("os.%s %s is not a known %s", s.name, value, s.name)
+		}
+	}
+	return nil
+}
+
+// applyLocalization applies the timezone, locale and keymap of the config to
+// the installer.
+func applyLocalization(cfg *config.HarvesterConfig) error {
+	var errs []error
+	for _, s := range localizationSettings {
+		if value := *s.field(&cfg.OS); value != "" {
+			errs = append(errs, s.applyLive(value))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,110 @@
+package console
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+func TestSearchNames(t *testing.T) {
+	names := []string{"America/New_York", "Asia/Taipei", "Asia/Tokyo", "Europe/Berlin", "de", "de-latin1", "jp106"}
+	testCases := []struct {
+		name    string
+		query   string
+		matches []string
+	}{
+		{
+			name:    "exact match among others",
+			query:   "de",
+			matches: []string{"de"},
+		},
+		{
+			name:    "exact match in another case",
+			query:   "asia/tokyo",
+			matches: []string{"Asia/Tokyo"},
+		},
+		{
+			name:    "part of the names",
+			query:   "asia/t",
+			matches: []string{"Asia/Taipei", "Asia/Tokyo"},
+		},
+		{
+			name:    "space as underscore",
+			query:   " new york ",
+			matches: []string{"America/New_York"},
+		},
+		{
+			name:  "no match",
+			query: "Mars",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.matches, searchNames(names, tc.query))
+		})
+	}
+}
+
+func TestCheckLocalization(t *testing.T) {
+	origSettings, origZoneinfoDir := localizationSettings, zoneinfoDir
+	defer func() {
+		localizationSettings, zoneinfoDir = origSettings, origZoneinfoDir
+	}()
+
+	zoneinfoDir = t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(zoneinfoDir, "Asia"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(zoneinfoDir, "Asia", "Tokyo"), nil, 0644))
+	localizationSettings = slices.Clone(origSettings)
+	for i := range localizationSettings {
+		switch localizationSettings[i].name {
+		case "keymap":
+			localizationSettings[i].list = []string{"echo", "us\njp106"}
+		case "locale":
+			// the locales can't be listed, they aren't checked
+			localizationSettings[i].list = []string{"false"}
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		os     config.OS
+		errMsg string
+	}{
+		{
+			name: "known names",
+			os:   config.OS{Timezone: "Asia/Tokyo", Keymap: "jp106", Locale: "xx_XX.UTF-8"},
+		},
+		{
+			name:   "unknown timezone",
+			os:     config.OS{Timezone: "Asia/Edo"},
+			errMsg: "os.timezone Asia/Edo is not a known timezone",
+		},
+		{
+			name:   "timezone directory",
+			os:     config.OS{Timezone: "Asia"},
+			errMsg: "os.timezone Asia is not a known timezone",
+		},
+		{
+			name:   "unknown keymap",
+			os:     config.OS{Keymap: "dvorak-jp"},
+			errMsg: "os.keymap dvorak-jp is not a known keymap",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.NewHarvesterConfig()
+			cfg.OS = tc.os
+			err := checkLocalization(cfg)
+			if tc.errMsg != "" {
+				assert.EqualError(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
@@ -19,6 +19,15 @@ import (
 	"github.com/harvester/harvester-installer/pkg/config"
 )
 
+// setLiveHostname sets the hostname of the installer system, as
+// applyNetworks() does before configuring the network.
+func setLiveHostname(hostname string) error {
+	if _, err := run(exec.Command("hostnamectl", "hostname", hostname)); err != nil {
+		return fmt.Errorf("fail to set hostname %s: %w", hostname, err)
+	}
+	return nil
+}
+
 func checkDefaultRoute() (bool, error) {
 	routes, err := netlink.RouteList(nil, syscall.AF_INET)
 	if err != nil {
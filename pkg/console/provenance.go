@@ -0,0 +1,23 @@
+package console
+
+import (
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+// tuiBaseline is the config as it was before the user last went through
+// the installer panels. Whatever changed since then was input in the TUI.
+var tuiBaseline *config.HarvesterConfig
+
+func markTUIBaseline(c *config.HarvesterConfig) {
+	tuiBaseline = c.Clone()
+}
+
+// recordTUIInput records the values changed since the baseline as input in
+// the TUI, and moves the baseline forward.
+func recordTUIInput(c *config.HarvesterConfig) {
+	if tuiBaseline == nil {
+		return
+	}
+	c.RecordChanges(tuiBaseline, config.SourceTUI)
+	markTUIBaseline(c)
+}
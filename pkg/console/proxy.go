@@ -0,0 +1,75 @@
+package console
+
+import (
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+// proxyVariables are the environment variables of the proxy.
+var proxyVariables = []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"}
+
+// setProxyEnvironment makes the installer, and the commands it runs, go
+// through the proxy of the config, or directly if there is none.
+func setProxyEnvironment(cfg *config.HarvesterConfig) error {
+	env := cfg.ProxyEnvironment()
+	for _, name := range proxyVariables {
+		if value := env[name]; value != "" {
+			if err := os.Setenv(name, value); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.Unsetenv(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setNodeSubnets reaches the subnets of the management interface directly
+// when it is configured by DHCP. The config already knows a static one.
+func setNodeSubnets(cfg *config.HarvesterConfig) {
+	cfg.Install.Proxy.NodeSubnets = nil
+	if !cfg.Install.Proxy.Enabled() || cfg.ManagementInterface.Method != config.NetworkMethodDHCP {
+		return
+	}
+	iface, err := net.InterfaceByName(config.MgmtInterfaceName)
+	if err != nil {
+		logrus.Warnf("fail to get the subnet of %s for noProxy: %s", config.MgmtInterfaceName, err)
+		return
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		logrus.Warnf("fail to get the subnet of %s for noProxy: %s", config.MgmtInterfaceName, err)
+		return
+	}
+	cfg.Install.Proxy.NodeSubnets = globalSubnets(addrs)
+}
+
+// globalSubnets returns the global unicast subnets of addrs.
+func globalSubnets(addrs []net.Addr) []string {
+	var subnets []string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || !ipNet.IP.IsGlobalUnicast() {
+			continue
+		}
+		subnet := net.IPNet{IP: ipNet.IP.Mask(ipNet.Mask), Mask: ipNet.Mask}
+		subnets = append(subnets, subnet.String())
+	}
+	return subnets
+}
+
+// redactURL hides the password of a proxy URL, for showing it.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,46 @@
+package console
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+func TestSetProxyEnvironment(t *testing.T) {
+	for _, name := range proxyVariables {
+		t.Setenv(name, "http://old:3128")
+	}
+
+	cfg := config.NewHarvesterConfig()
+	cfg.Install.Proxy = config.Proxy{HTTP: "http://proxy:3128"}
+	assert.Nil(t, setProxyEnvironment(cfg))
+	assert.Equal(t, "http://proxy:3128", os.Getenv("HTTP_PROXY"))
+	assert.Equal(t, "", os.Getenv("HTTPS_PROXY"))
+	assert.Equal(t, cfg.NoProxy(), os.Getenv("NO_PROXY"))
+
+	cfg.Install.Proxy = config.Proxy{}
+	assert.Nil(t, setProxyEnvironment(cfg))
+	for _, name := range proxyVariables {
+		_, ok := os.LookupEnv(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestGlobalSubnets(t *testing.T) {
+	mustParseCIDR := func(s string) net.Addr {
+		ip, ipNet, err := net.ParseCIDR(s)
+		assert.Nil(t, err)
+		ipNet.IP = ip
+		return ipNet
+	}
+	addrs := []net.Addr{
+		mustParseCIDR("192.168.1.10/24"),
+		mustParseCIDR("fe80::1/64"),
+		mustParseCIDR("2001:db8::10/64"),
+	}
+	assert.Equal(t, []string{"192.168.1.0/24", "2001:db8::/64"}, globalSubnets(addrs))
+}
@@ -0,0 +1,107 @@
+package console
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+// secretsHook scrubs secrets from log entries. Config structs are redacted
+// field by field with config.Redact, but rendered files such as the cOS
+// config embed the same secrets in free text.
+type secretsHook struct {
+	lock   sync.RWMutex
+	values []string
+}
+
+var logSecrets = &secretsHook{}
+
+func (h *secretsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *secretsHook) Fire(entry *logrus.Entry) error {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if len(h.values) == 0 {
+		return nil
+	}
+	entry.Message = config.RedactString(entry.Message, h.values)
+	for k, v := range entry.Data {
+		if s, ok := v.(string); ok {
+			entry.Data[k] = config.RedactString(s, h.values)
+		}
+	}
+	return nil
+}
+
+// redactSecretsInLogs makes sure the values of all sensitive fields of cfg
+// never show up in the logs from now on.
+func redactSecretsInLogs(cfg *config.HarvesterConfig) {
+	values := config.SensitiveValues(cfg)
+	logSecrets.lock.Lock()
+	defer logSecrets.lock.Unlock()
+	for _, value := range values {
+		if !util.StringSliceContains(logSecrets.values, value) {
+			logSecrets.values = append(logSecrets.values, value)
+		}
+	}
+}
+
+func (h *secretsHook) secrets() []string {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return append([]string{}, h.values...)
+}
+
+// redactSupportBundle scrubs the secrets from a supportconfig tarball, whose
+// logs and configs aren't all written through logrus.
+func redactSupportBundle(ctx context.Context, bundle string) error {
+	dir, err := os.MkdirTemp("", "scc-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck
+	if output, err := exec.CommandContext(ctx, "tar", "-xJf", bundle, "-C", dir).CombinedOutput(); err != nil {
+		logrus.Error(err, string(output))
+		return err
+	}
+	if err := redactFiles(dir, logSecrets.secrets()); err != nil {
+		return err
+	}
+	if output, err := exec.CommandContext(ctx, "tar", "-cJf", bundle, "-C", dir, ".").CombinedOutput(); err != nil {
+		logrus.Error(err, string(output))
+		return err
+	}
+	return nil
+}
+
+// redactFiles replaces the secret values in the files under dir.
+func redactFiles(dir string, values []string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		redacted := config.RedactString(string(content), values)
+		if redacted == string(content) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(redacted), info.Mode().Perm())
+	})
+}
@@ -0,0 +1,44 @@
+package console
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+func TestSecretsHook(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(buf)
+	hook := &secretsHook{
+		values: config.SensitiveValues(&config.HarvesterConfig{Token: "cluster-token"}),
+	}
+	logger.AddHook(hook)
+
+	logger.WithField("file", "token: cluster-token").Infof("Content of %s: %s", "/tmp/cos.123", "token: \"cluster-token\"")
+	assert.NotContains(t, buf.String(), "cluster-token")
+	assert.Contains(t, buf.String(), `token: \"***\"`)
+}
+
+func TestRedactFiles(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "rootfs", "var", "log", "console.log")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(logFile), 0755))
+	assert.Nil(t, os.WriteFile(logFile, []byte("token: cluster-token\n"), 0600))
+	otherFile := filepath.Join(dir, "basic-environment.txt")
+	assert.Nil(t, os.WriteFile(otherFile, []byte("nothing secret\n"), 0644))
+
+	assert.Nil(t, redactFiles(dir, []string{"cluster-token"}))
+	content, err := os.ReadFile(logFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "token: ***\n", string(content))
+	content, err = os.ReadFile(otherFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "nothing secret\n", string(content))
+}
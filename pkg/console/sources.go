@@ -0,0 +1,323 @@
+package console
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/harvester/harvester-installer/pkg/util"
+)
+
+// Config URL schemes of sources other than HTTP(S).
+const (
+	configSchemeFile        = "file"
+	configSchemeNoCloud     = "nocloud"
+	configSchemeConfigDrive = "configdrive"
+	configSchemeEC2         = "ec2"
+
+	noCloudLabel         = "cidata"
+	noCloudUserData      = "user-data"
+	configDriveLabel     = "config-2"
+	configDriveUserData  = "openstack/latest/user_data"
+	ec2MetadataEndpoint  = "http://169.254.169.254"
+	ec2TokenPath         = "/latest/api/token"
+	ec2UserDataPath      = "/latest/user-data"
+	ec2TokenHeader       = "X-aws-ec2-metadata-token"
+	ec2TokenTTLHeader    = "X-aws-ec2-metadata-token-ttl-seconds"
+	ec2TokenTTLSeconds   = "300"
+	configVolumeMountDir = "/tmp"
+)
+
+// errNoConfig means a config source has no config to offer.
+var errNoConfig = errors.New("no config found")
+
+// ConfigSource is somewhere a config document can be read from.
+type ConfigSource interface {
+	// String returns the URL of the source.
+	String() string
+	// Fetch returns the config document, or errNoConfig if there is none.
+	Fetch() ([]byte, error)
+}
+
+var (
+	// So that we can fake mounts up for unit tests
+	mountReadOnly = mountDeviceReadOnly
+)
+
+// newConfigSource returns the source of the config URL. Besides HTTP(S)
+// URLs, these are supported:
+//
+//   - file:///path looks for the file on the filesystems of all block
+//     devices, file://LABEL/path only on those labelled LABEL.
+//   - nocloud: reads user-data from a NoCloud volume labelled CIDATA.
+//   - configdrive: reads the user data from an OpenStack config drive.
+//   - ec2:// reads the user data from the EC2 instance metadata service,
+//     ec2://host:port from a compatible one at that address.
+//
+// A sha256 query parameter of the URL is the expected digest of the config.
+func newConfigSource(configURL string) (ConfigSource, error) {
+	configURL, digest, err := util.SplitDigestURL(configURL)
+	if err != nil {
+		return nil, err
+	}
+	source, err := newUnverifiedConfigSource(configURL)
+	if err != nil || digest == "" {
+		return source, err
+	}
+	return &verifiedConfigSource{ConfigSource: source, digest: digest}, nil
+}
+
+func newUnverifiedConfigSource(configURL string) (ConfigSource, error) {
+	u, err := url.Parse(configURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return httpConfigSource(configURL), nil
+	case configSchemeFile:
+		if u.Path == "" {
+			return nil, fmt.Errorf("no path in %s", configURL)
+		}
+		return &fileConfigSource{label: u.Host, path: u.Path}, nil
+	case configSchemeNoCloud:
+		return &volumeConfigSource{label: noCloudLabel, path: noCloudUserData, scheme: configSchemeNoCloud}, nil
+	case configSchemeConfigDrive:
+		return &volumeConfigSource{label: configDriveLabel, path: configDriveUserData, scheme: configSchemeConfigDrive}, nil
+	case configSchemeEC2:
+		endpoint := ec2MetadataEndpoint
+		if u.Host != "" {
+			endpoint = "http://" + u.Host
+		}
+		return &ec2ConfigSource{endpoint: endpoint}, nil
+	default:
+		return nil, fmt.Errorf("unsupported config URL %s", configURL)
+	}
+}
+
+// isHTTPConfigURL tells if the config URL can be fetched by any HTTP
+// client, such as curl in the stream-disk script.
+func isHTTPConfigURL(configURL string) bool {
+	return strings.HasPrefix(configURL, "http://") || strings.HasPrefix(configURL, "https://")
+}
+
+// discoverConfigSources returns the sources of config volumes attached to
+// the node, e.g. by virtual media.
+func discoverConfigSources() ([]ConfigSource, error) {
+	devices, err := listFilesystems()
+	if err != nil {
+		return nil, err
+	}
+	var sources []ConfigSource
+	for _, source := range []*volumeConfigSource{
+		{label: noCloudLabel, path: noCloudUserData, scheme: configSchemeNoCloud},
+		{label: configDriveLabel, path: configDriveUserData, scheme: configSchemeConfigDrive},
+	} {
+		for _, device := range devices {
+			if strings.EqualFold(device.Label, source.label) {
+				sources = append(sources, source)
+				break
+			}
+		}
+	}
+	return sources, nil
+}
+
+type httpConfigSource string
+
+func (s httpConfigSource) String() string {
+	return string(s)
+}
+
+func (s httpConfigSource) Fetch() ([]byte, error) {
+	return getURL(newHTTPClient(httpClientOptions{}), string(s))
+}
+
+// fileConfigSource reads a file from the filesystem of a block device.
+type fileConfigSource struct {
+	// label restricts the search to filesystems with this label.
+	label string
+	path  string
+}
+
+func (s *fileConfigSource) String() string {
+	return fmt.Sprintf("%s://%s%s", configSchemeFile, s.label, s.path)
+}
+
+func (s *fileConfigSource) Fetch() ([]byte, error) {
+	devices, err := listFilesystems()
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		if s.label != "" && !strings.EqualFold(device.Label, s.label) {
+			continue
+		}
+		data, err := readFromDevice(device, s.path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			logrus.Warnf("Fail to look for %s on %s: %s", s.path, device.Name, err)
+			continue
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%w: %s isn't on any block device", errNoConfig, s)
+}
+
+// volumeConfigSource reads the user data of cloud-init style config
+// volumes, such as NoCloud and ConfigDrive.
+type volumeConfigSource struct {
+	label  string
+	path   string
+	scheme string
+}
+
+func (s *volumeConfigSource) String() string {
+	return s.scheme + ":"
+}
+
+func (s *volumeConfigSource) Fetch() ([]byte, error) {
+	return (&fileConfigSource{label: s.label, path: s.path}).Fetch()
+}
+
+// ec2ConfigSource reads the user data from an EC2-style instance metadata
+// service, with a session token if the service supports them.
+type ec2ConfigSource struct {
+	endpoint string
+}
+
+func (s *ec2ConfigSource) String() string {
+	return strings.Replace(s.endpoint, "http://", configSchemeEC2+"://", 1)
+}
+
+func (s *ec2ConfigSource) Fetch() ([]byte, error) {
+	// the metadata service is link-local, never to be reached by proxy
+	client := newHTTPClient(httpClientOptions{noProxy: true})
+
+	req, err := http.NewRequest(http.MethodGet, s.endpoint+ec2UserDataPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token, err := s.token(client); err != nil {
+		logrus.Infof("No metadata session token, falling back to IMDSv1: %s", err)
+	} else {
+		req.Header.Set(ec2TokenHeader, token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: no user data in %s", errNoConfig, s)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("got %d status code from %s, body: %s", resp.StatusCode, req.URL, string(body))
+	}
+	return body, nil
+}
+
+func (s *ec2ConfigSource) token(client http.Client) (string, error) {
+	req, err := http.NewRequest(http.MethodPut, s.endpoint+ec2TokenPath, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(ec2TokenTTLHeader, ec2TokenTTLSeconds)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("got %d status code", resp.StatusCode)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// listFilesystems returns the block devices that have a filesystem, disks
+// and partitions alike.
+func listFilesystems() ([]Device, error) {
+	output, err := run(exec.Command("/bin/sh", "-c", `lsblk -J -p -o NAME,TYPE,FSTYPE,LABEL`))
+	if err != nil {
+		return nil, fmt.Errorf("fail to list block devices: %w", err)
+	}
+	devices := &BlockDevices{}
+	if err := json.Unmarshal(output, devices); err != nil {
+		return nil, fmt.Errorf("error unmarshalling lsblk json output: %v", err)
+	}
+	var result []Device
+	var walk func([]Device)
+	walk = func(devices []Device) {
+		for _, device := range devices {
+			if device.FSType != "" {
+				result = append(result, device)
+			}
+			walk(device.Children)
+		}
+	}
+	walk(devices.Disks)
+	return result, nil
+}
+
+func readFromDevice(device Device, path string) ([]byte, error) {
+	dir, unmount, err := mountReadOnly(device.Name, device.FSType)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := unmount(); err != nil {
+			logrus.Warnf("Fail to unmount %s: %s", device.Name, err)
+		}
+	}()
+	return os.ReadFile(filepath.Join(dir, filepath.Clean("/"+path)))
+}
+
+// readOnlyMountOptions returns the options mounting a filesystem of fsType
+// without writing to it. A read-only mount still replays the journal of
+// ext and xfs filesystems, which would write to the disks of the node.
+func readOnlyMountOptions(fsType string) string {
+	switch fsType {
+	case "ext3", "ext4":
+		return "ro,noload"
+	case "xfs":
+		return "ro,norecovery"
+	default:
+		return "ro"
+	}
+}
+
+func mountDeviceReadOnly(device, fsType string) (string, func() error, error) {
+	dir, err := os.MkdirTemp(configVolumeMountDir, "config-volume.")
+	if err != nil {
+		return "", nil, err
+	}
+	if output, err := exec.Command("mount", "-o", readOnlyMountOptions(fsType), device, dir).CombinedOutput(); err != nil {
+		_ = os.Remove(dir)
+		return "", nil, fmt.Errorf("fail to mount %s: %w: %s", device, err, string(output))
+	}
+	unmount := func() error {
+		if output, err := exec.Command("umount", dir).CombinedOutput(); err != nil {
+			return fmt.Errorf("%w: %s", err, string(output))
+		}
+		return os.Remove(dir)
+	}
+	return dir, unmount, nil
+}
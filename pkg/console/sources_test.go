@@ -0,0 +1,184 @@
+package console
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/harvester/harvester-installer/pkg/config"
+)
+
+const sampleFilesystemsOutput = `{
+   "blockdevices": [
+      {"name":"/dev/sda", "type":"disk", "fstype":null, "label":null,
+         "children": [
+            {"name":"/dev/sda1", "type":"part", "fstype":"vfat", "label":"EFI"},
+            {"name":"/dev/sda2", "type":"part", "fstype":"ext4", "label":"DATA"}
+         ]
+      },
+      {"name":"/dev/sr0", "type":"rom", "fstype":"iso9660", "label":"COS_LIVE"},
+      {"name":"/dev/sr1", "type":"rom", "fstype":"iso9660", "label":"CIDATA"}
+   ]
+}`
+
+// fakeDevices fakes up the block devices of sampleFilesystemsOutput, with
+// the given files on their filesystems.
+func fakeDevices(t *testing.T, files map[string]map[string]string) {
+	dirs := make(map[string]string)
+	for device, deviceFiles := range files {
+		dir := t.TempDir()
+		for name, content := range deviceFiles {
+			path := filepath.Join(dir, name)
+			assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+			assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+		}
+		dirs[device] = dir
+	}
+	run = func(_ *exec.Cmd) ([]byte, error) {
+		return []byte(sampleFilesystemsOutput), nil
+	}
+	mountReadOnly = func(device, _ string) (string, func() error, error) {
+		dir, ok := dirs[device]
+		if !ok {
+			dir = t.TempDir()
+		}
+		return dir, func() error { return nil }, nil
+	}
+	t.Cleanup(func() {
+		run = runCommand
+		mountReadOnly = mountDeviceReadOnly
+	})
+}
+
+func TestNewConfigSource(t *testing.T) {
+	testCases := []struct {
+		url      string
+		expected string
+		errMsg   string
+	}{
+		{url: "https://example.com/config.yaml", expected: "https://example.com/config.yaml"},
+		{url: "file:///harvester/config.yaml", expected: "file:///harvester/config.yaml"},
+		{url: "file://MEDIA/harvester/config.yaml", expected: "file://MEDIA/harvester/config.yaml"},
+		{url: "nocloud:", expected: "nocloud:"},
+		{url: "configdrive:", expected: "configdrive:"},
+		{url: "ec2://", expected: "ec2://169.254.169.254"},
+		{url: "ec2://127.0.0.1:8080", expected: "ec2://127.0.0.1:8080"},
+		{url: "file://MEDIA", errMsg: "no path in file://MEDIA"},
+		{url: "ftp://example.com/config.yaml", errMsg: "unsupported config URL"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			source, err := newConfigSource(tc.url)
+			if tc.errMsg != "" {
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, source.String())
+		})
+	}
+}
+
+func TestFileConfigSource(t *testing.T) {
+	fakeDevices(t, map[string]map[string]string{
+		"/dev/sda2": {"harvester/config.yaml": "on data"},
+		"/dev/sr1":  {"harvester/config.yaml": "on cidata"},
+	})
+
+	data, err := fetchConfig("file:///harvester/config.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, "on data", string(data))
+
+	data, err = fetchConfig("file://cidata/harvester/config.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, "on cidata", string(data))
+
+	_, err = fetchConfig("file:///harvester/missing.yaml")
+	assert.True(t, errors.Is(err, errNoConfig))
+}
+
+func TestReadConfigVolumes(t *testing.T) {
+	fakeDevices(t, map[string]map[string]string{
+		"/dev/sr1": {"user-data": "#cloud-config\nos:\n  hostname: node1\ninstall:\n  automatic: true\n"},
+	})
+
+	configs, err := readConfigVolumes(config.Install{})
+	assert.Nil(t, err)
+	if assert.Len(t, configs, 1) {
+		assert.Equal(t, "node1", configs[0].OS.Hostname)
+		assert.True(t, configs[0].Install.Automatic)
+		assert.Equal(t, "remote nocloud:", configs[0].Provenance.Lookup("os.hostname"))
+	}
+}
+
+func TestEC2ConfigSource(t *testing.T) {
+	testCases := []struct {
+		name        string
+		tokens      bool
+		userData    string
+		expected    string
+		errNoConfig bool
+	}{
+		{
+			name:     "IMDSv2",
+			tokens:   true,
+			userData: "os:\n  hostname: node1\n",
+			expected: "os:\n  hostname: node1\n",
+		},
+		{
+			name:     "IMDSv1",
+			userData: "os:\n  hostname: node1\n",
+			expected: "os:\n  hostname: node1\n",
+		},
+		{
+			name:        "no user data",
+			tokens:      true,
+			errNoConfig: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodPut && r.URL.Path == ec2TokenPath && tc.tokens:
+					assert.Equal(t, ec2TokenTTLSeconds, r.Header.Get(ec2TokenTTLHeader))
+					_, _ = w.Write([]byte("token"))
+				case r.Method == http.MethodGet && r.URL.Path == ec2UserDataPath:
+					if tc.tokens && r.Header.Get(ec2TokenHeader) != "token" {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					if tc.userData == "" {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					_, _ = w.Write([]byte(tc.userData))
+				default:
+					w.WriteHeader(http.StatusForbidden)
+				}
+			}))
+			defer server.Close()
+
+			data, err := fetchConfig(strings.Replace(server.URL, "http://", "ec2://", 1))
+			if tc.errNoConfig {
+				assert.True(t, errors.Is(err, errNoConfig))
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, string(data))
+		})
+	}
+}
+
+func Test_readOnlyMountOptions(t *testing.T) {
+	assert.Equal(t, "ro,noload", readOnlyMountOptions("ext4"))
+	assert.Equal(t, "ro,norecovery", readOnlyMountOptions("xfs"))
+	assert.Equal(t, "ro", readOnlyMountOptions("iso9660"))
+}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -51,21 +50,11 @@ You can see the full installation log by:
 
 	ElementalConfigDir  = "/tmp/elemental"
 	ElementalConfigFile = "config.yaml"
-	multipathOff        = "multipath=off"
 	PartitionType       = "part"
 	MpathType           = "mpath"
 	CosDiskLabelPrefix  = "COS_OEM"
 )
 
-func newProxyClient() http.Client {
-	return http.Client{
-		Timeout: defaultHTTPTimeout,
-		Transport: &http.Transport{
-			Proxy: proxyFromEnvironment,
-		},
-	}
-}
-
 func proxyFromEnvironment(req *http.Request) (*url.URL, error) {
 	return httpproxy.FromEnvironment().ProxyFunc()(req.URL)
 }
@@ -90,14 +79,9 @@ func getURL(client http.Client, url string) ([]byte, error) {
 }
 
 func validatePingServerURL(url string) error {
-	client := http.Client{
-		Timeout: defaultHTTPTimeout,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-		},
-	}
+	// only checks that the server is up, which may not have a certificate
+	// trusted yet
+	client := newHTTPClient(httpClientOptions{noProxy: true, insecure: true})
 	// After configure the network, network need a few seconds to be available.
 	return retryOnError(3, 2, func() error {
 		_, err := getURL(client, url)
@@ -274,7 +258,7 @@ func retryOnError(retryNum, retryInterval int64, process func() error) error {
 }
 
 func getRemoteSSHKeys(url string) ([]string, error) {
-	client := newProxyClient()
+	client := newHTTPClient(httpClientOptions{})
 	b, err := getURL(client, url)
 	if err != nil {
 		return nil, err
@@ -494,6 +478,118 @@ func saveTemp(obj interface{}, prefix string) (string, error) {
 	return tempFile.Name(), nil
 }
 
+// saveHarvesterConfigTemp saves a config with the resolved secrets replaced
+// with the references they came from.
+func saveHarvesterConfigTemp(hvstConfig *config.HarvesterConfig, prefix string) (string, error) {
+	persisted, err := hvstConfig.WithSecretReferences()
+	if err != nil {
+		return "", err
+	}
+	return saveTemp(persisted, prefix)
+}
+
+// persistedConfigs are the temporary files of the Harvester and cOS configs
+// persisted on the node, of the secrets split out of both and of the key the
+// secrets are sealed with.
+type persistedConfigs struct {
+	cosConfig       string
+	harvesterConfig string
+	secrets         string
+	secretsKey      string
+}
+
+// savePersistedConfigs saves the configs that get persisted on the node.
+// Secrets are split out of both into a file sealed with a new random key,
+// and the key with the recovery key too if there is one.
+func savePersistedConfigs(hvstConfig *config.HarvesterConfig, cosConfig *yipSchema.YipConfig, hvstPrefix string) (*persistedConfigs, error) {
+	persisted, err := hvstConfig.WithSecretReferences()
+	if err != nil {
+		return nil, err
+	}
+	persisted.Install.SecretsRecoveryKey = ""
+
+	key, err := config.NewSecretsKey()
+	if err != nil {
+		return nil, err
+	}
+	if hvstConfig.Install.SecretsRecoveryKey == "" {
+		logrus.Warnf("install.secretsRecoveryKey is not set, the sealed secrets can't be recovered if %s is lost", config.SecretsKeyFile)
+	}
+	secrets := hvstConfig.Secrets()
+	sealed, err := config.SealSecrets(secrets, key, hvstConfig.Install.SecretsRecoveryKey)
+	if err != nil {
+		return nil, err
+	}
+
+	files := &persistedConfigs{}
+	sealedCosConfig, err := secrets.Seal(cosConfig)
+	if err != nil {
+		return nil, err
+	}
+	if files.cosConfig, err = saveTemp(sealedCosConfig, "cos"); err != nil {
+		return nil, err
+	}
+	strippedConfig, err := persisted.WithoutSecrets()
+	if err != nil {
+		return nil, err
+	}
+	if files.harvesterConfig, err = saveTemp(strippedConfig, hvstPrefix); err != nil {
+		return nil, err
+	}
+	if files.secrets, err = writeSecretTemp("secrets.", sealed); err != nil {
+		return nil, err
+	}
+	if files.secretsKey, err = writeSecretTemp("secrets-key.", key); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// writeSecretTemp writes data to a temporary file only root can read.
+func writeSecretTemp(pattern string, data []byte) (string, error) {
+	f, err := os.CreateTemp("/tmp", pattern)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() //nolint:errcheck
+	if _, err := f.Write(data); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func fetchSecret(secretURL string, source config.SecretSource) (string, error) {
+	client := newHTTPClient(httpClientOptions{insecure: source.Insecure})
+
+	req, err := http.NewRequest(http.MethodGet, secretURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if source.BasicAuth.User != "" && source.BasicAuth.Password != "" {
+		req.SetBasicAuth(source.BasicAuth.User, source.BasicAuth.Password)
+	}
+	for k, vv := range source.Headers {
+		for _, v := range vv {
+			req.Header.Add(k, v)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	// unlike getURL, don't put the body into the error, it may be the secret
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return "", fmt.Errorf("got %d status code from %s", resp.StatusCode, secretURL)
+	}
+	return string(body), nil
+}
+
 func roleSetup(c *config.HarvesterConfig) error {
 	if c.Role == "" {
 		return nil
@@ -529,13 +625,29 @@ func doInstall(g *gocui.Gui, hvstConfig *config.HarvesterConfig, webhooks Render
 	if err := roleSetup(hvstConfig); err != nil {
 		return err
 	}
+	setNodeSubnets(hvstConfig)
+
+	// check the ISO, or the raw disk image streamed instead, before
+	// anything is written to the disks
+	report := func(message string) {
+		printToPanel(g, message, installPanel)
+	}
+	streamDisk := hvstConfig.Install.Automatic && hvstConfig.Install.Mode == config.ModeInstall && hvstConfig.Install.RawDiskImagePath != ""
+	verify := verifyISO
+	if streamDisk {
+		verify = verifyRawDiskImage
+	}
+	if err := verify(&hvstConfig.Install, report); err != nil {
+		printToPanel(g, err.Error(), installPanel)
+		return err
+	}
 
 	env, elementalConfig, err := generateEnvAndConfig(g, hvstConfig)
 	if err != nil {
 		return err
 	}
 
-	if hvstConfig.Install.Automatic && hvstConfig.Install.Mode == config.ModeInstall && hvstConfig.Install.RawDiskImagePath != "" {
+	if streamDisk {
 		return streamImageToDisk(ctx, g, env, *hvstConfig)
 	}
 
@@ -553,11 +665,14 @@ func doInstall(g *gocui.Gui, hvstConfig *config.HarvesterConfig, webhooks Render
 		env = append(env, fmt.Sprintf("HARVESTER_DATA_DISK=%s", hvstConfig.DataDisk))
 	}
 
-	if !hvstConfig.OS.ExternalStorage.Enabled {
-		env = append(env, fmt.Sprintf("HARVESTER_ADDITIONAL_KERNEL_ARGUMENTS=%s", multipathOff))
+	if args := hvstConfig.AdditionalKernelArgs(); len(args) > 0 {
+		env = append(env, fmt.Sprintf("HARVESTER_ADDITIONAL_KERNEL_ARGUMENTS=%s", strings.Join(args, " ")))
 	}
-	if hvstConfig.OS.AdditionalKernelArguments != "" {
-		env = append(env, fmt.Sprintf("HARVESTER_ADDITIONAL_KERNEL_ARGUMENTS=%s", hvstConfig.OS.AdditionalKernelArguments))
+	if args := hvstConfig.RemovedKernelArgs(); len(args) > 0 {
+		env = append(env, fmt.Sprintf("HARVESTER_REMOVED_KERNEL_ARGUMENTS=%s", strings.Join(args, " ")))
+	}
+	if hvstConfig.OS.Kdump.Enabled && hvstConfig.OS.Kdump.CrashKernel == "" {
+		env = append(env, "HARVESTER_KDUMP_CRASH_KERNEL_AUTO=true")
 	}
 
 	// when WipeAllDisks is enabled then find all non installation disks with COS_ prefixed labels
@@ -599,9 +714,17 @@ func doInstall(g *gocui.Gui, hvstConfig *config.HarvesterConfig, webhooks Render
 			fileSuffix := fmt.Sprintf("harvester_%s", rand.String(5))
 			scErr := executeSupportconfig(ctx, fileSuffix)
 			if scErr != nil {
-				printToPanel(g, fmt.Sprintf("support config collection failed %v", err), installPanel)
+				printToPanel(g, fmt.Sprintf("support config collection failed %v", scErr), installPanel)
 			}
-			printToPanel(g, fmt.Sprintf("support config is available at /var/log/scc_%s.txz", fileSuffix), installPanel)
+			bundle := fmt.Sprintf("/var/log/scc_%s.txz", fileSuffix)
+			if scErr = redactSupportBundle(ctx, bundle); scErr != nil {
+				// don't hand out a bundle with the secrets in it
+				logrus.Errorf("fail to redact the support config: %v", scErr)
+				_ = os.Remove(bundle)
+				printToPanel(g, "support config is removed as it could not be redacted", installPanel)
+				return err
+			}
+			printToPanel(g, fmt.Sprintf("support config is available at %s", bundle), installPanel)
 		}
 		return err
 	}
@@ -677,28 +800,117 @@ func printToPanel(g *gocui.Gui, message string, panelName string) {
 	<-ch
 }
 
-func getRemoteConfig(configURL string) (*config.HarvesterConfig, error) {
-	client := newProxyClient()
-	b, err := getURL(client, configURL)
+func fetchConfig(configURL string) ([]byte, error) {
+	source, err := newConfigSource(configURL)
+	if err != nil {
+		return nil, err
+	}
+	return source.Fetch()
+}
+
+// loadRemoteConfig loads the config fetched from configURL, along with the
+// configs it includes, checked as the installation says.
+func loadRemoteConfig(install config.Install, configURL string, data []byte) (*config.HarvesterConfig, error) {
+	harvestCfg, err := config.LoadHarvesterConfig(data)
 	if err != nil {
 		return nil, err
 	}
-	harvestCfg, err := config.LoadHarvesterConfig(b)
+	harvestCfg.SetSource("", config.SourceRemote(configURL))
+	// relative includes only make sense next to a config at an HTTP or
+	// file URL, the others have no path to resolve them against
+	location := ""
+	if isHTTPConfigURL(configURL) || strings.HasPrefix(configURL, configSchemeFile+"://") {
+		location = configURL
+	}
+	fetch, err := newVerifiedFetcher(install)
 	if err != nil {
 		return nil, err
 	}
+	if err := harvestCfg.ApplyIncludes(location, fetch); err != nil {
+		return nil, err
+	}
 	return harvestCfg, nil
 }
 
-func retryRemoteConfig(configURL string, g *gocui.Gui) (*config.HarvesterConfig, error) {
+func getRemoteConfig(install config.Install) (*config.HarvesterConfig, error) {
+	source, err := newInstallConfigSource(install)
+	if err != nil {
+		return nil, err
+	}
+	b, err := source.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	return loadRemoteConfig(install, source.String(), b)
+}
+
+// readConfigVolumes reads the configs of the config volumes attached to the
+// node, if any. They must be signed if the installation has a trusted key.
+func readConfigVolumes(install config.Install) ([]*config.HarvesterConfig, error) {
+	sources, err := discoverConfigSources()
+	if err != nil {
+		return nil, err
+	}
+	key, err := trustedPublicKey(install)
+	if err != nil {
+		return nil, err
+	}
+	var configs []*config.HarvesterConfig
+	for _, source := range sources {
+		if source, err = verifyConfigSource(source, "", key, ""); err != nil {
+			return nil, err
+		}
+		data, err := source.Fetch()
+		if errors.Is(err, errNoConfig) {
+			logrus.Infof("Config volume %s has no config: %s", source, err)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		cfg, err := loadRemoteConfig(install, source.String(), data)
+		if err != nil {
+			return nil, fmt.Errorf("fail to load config from %s: %w", source, err)
+		}
+		logrus.Infof("Read config from %s", source)
+		configs = append(configs, cfg)
+	}
+	return configs, nil
+}
+
+// saveConfigCopy saves the config document of the installation to a
+// temporary file, and returns its file:// URL.
+func saveConfigCopy(install config.Install) (string, error) {
+	source, err := newInstallConfigSource(install)
+	if err != nil {
+		return "", err
+	}
+	data, err := source.Fetch()
+	if err != nil {
+		return "", fmt.Errorf("fail to fetch config: %w", err)
+	}
+	f, err := os.CreateTemp("/tmp", "userdata.")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() //nolint:errcheck
+	if _, err := f.Write(data); err != nil {
+		return "", err
+	}
+	return "file://" + f.Name(), nil
+}
+
+func retryRemoteConfig(install config.Install, g *gocui.Gui) (*config.HarvesterConfig, error) {
 	var confData []byte
-	client := newProxyClient()
+	source, err := newInstallConfigSource(install)
+	if err != nil {
+		return nil, err
+	}
 
 	retries := 30
 	interval := 10
-	err := retryOnError(int64(retries), int64(interval), func() error {
+	err = retryOnError(int64(retries), int64(interval), func() error {
 		var e error
-		confData, e = getURL(client, configURL)
+		confData, e = source.Fetch()
 		if e != nil {
 			logrus.Error(e)
 			printToPanel(g, e.Error(), installPanel)
@@ -712,7 +924,7 @@ func retryRemoteConfig(configURL string, g *gocui.Gui) (*config.HarvesterConfig,
 		return nil, fmt.Errorf("fail to fetch config: %w", err)
 	}
 
-	harvestCfg, err := config.LoadHarvesterConfig(confData)
+	harvestCfg, err := loadRemoteConfig(install, source.String(), confData)
 	if err != nil {
 		return nil, fmt.Errorf("fail to load config: %w", err)
 	}
@@ -834,6 +1046,15 @@ func configureInstalledNode(g *gocui.Gui, hvstConfig *config.HarvesterConfig, we
 	if err := roleSetup(hvstConfig); err != nil {
 		return err
 	}
+	setNodeSubnets(hvstConfig)
+
+	// check the ISO before anything is written to the disks
+	if err := verifyISO(&hvstConfig.Install, func(message string) {
+		printToPanel(g, message, installPanel)
+	}); err != nil {
+		printToPanel(g, err.Error(), installPanel)
+		return err
+	}
 
 	// skip rancherd and network config in the cos config
 	cosConfig, cosConfigFile, hvstConfigFile, err := generateTempConfigFiles(hvstConfig)
@@ -916,12 +1137,7 @@ func applyRancherdConfig(ctx context.Context, g *gocui.Gui, hvstConfig *config.H
 	cosConfig.Stages["initramfs"] = append(cosConfig.Stages["initramfs"], conf.Stages["live"]...)
 
 	// additional config to copy files over to persist the new changes
-	cosConfigFile, err := saveTemp(cosConfig, "cos")
-	if err != nil {
-		return err
-	}
-
-	hvstConfigFile, err := saveTemp(hvstConfig, "hvst")
+	files, err := savePersistedConfigs(hvstConfig, cosConfig, "hvst")
 	if err != nil {
 		return err
 	}
@@ -929,8 +1145,10 @@ func applyRancherdConfig(ctx context.Context, g *gocui.Gui, hvstConfig *config.H
 	copyFiles := yipSchema.Stage{
 		Name: "copy files",
 		Commands: []string{
-			fmt.Sprintf("cp %s %s", cosConfigFile, defaultCustomConfig),
-			fmt.Sprintf("cp %s %s", hvstConfigFile, defaultHarvesterConfig),
+			fmt.Sprintf("install -D -m 0600 %s %s", files.secretsKey, config.SecretsKeyFile),
+			fmt.Sprintf("install -m 0600 %s %s", files.secrets, config.SecretsFile),
+			fmt.Sprintf("cp %s %s", files.cosConfig, defaultCustomConfig),
+			fmt.Sprintf("cp %s %s", files.harvesterConfig, defaultHarvesterConfig),
 		},
 	}
 
@@ -961,7 +1179,7 @@ func generateTempConfigFiles(hvstConfig *config.HarvesterConfig) (*yipSchema.Yip
 		return nil, "", "", err
 	}
 
-	hvstConfigFile, err := saveTemp(hvstConfig, "harvester")
+	hvstConfigFile, err := saveHarvesterConfigTemp(hvstConfig, "harvester")
 	if err != nil {
 		return nil, "", "", err
 	}
@@ -987,18 +1205,24 @@ func generateEnvAndConfig(g *gocui.Gui, hvstConfig *config.HarvesterConfig) ([]s
 		printToPanel(g, err.Error(), installPanel)
 		return nil, nil, err
 	}
-	cosConfigFile, err := saveTemp(cosConfig, "cos")
+	files, err := savePersistedConfigs(hvstConfig, cosConfig, "harvester")
 	if err != nil {
 		return nil, nil, err
 	}
 
-	hvstConfigFile, err := saveTemp(hvstConfig, "harvester")
+	userDataURL := hvstConfig.Install.ConfigURL
+	verified, err := isVerifiedConfig(hvstConfig.Install)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	userDataURL := hvstConfig.Install.ConfigURL
-	hvstConfig.Install.ConfigURL = cosConfigFile
+	if userDataURL != "" && (verified || !isHTTPConfigURL(userDataURL)) {
+		// stream-disk curls the config, hand it a copy it can read, and
+		// that has been checked
+		if userDataURL, err = saveConfigCopy(hvstConfig.Install); err != nil {
+			return nil, nil, err
+		}
+	}
+	hvstConfig.Install.ConfigURL = files.cosConfig
 	elementalConfig, err := config.ConvertToElementalConfig(hvstConfig)
 	if err != nil {
 		return nil, nil, err
@@ -1010,9 +1234,19 @@ func generateEnvAndConfig(g *gocui.Gui, hvstConfig *config.HarvesterConfig) ([]s
 		return nil, nil, nil
 	}
 	env := append(os.Environ(), ev...)
-	env = append(env, fmt.Sprintf("HARVESTER_CONFIG=%s", hvstConfigFile))
+	env = append(env, fmt.Sprintf("HARVESTER_CONFIG=%s", files.harvesterConfig))
+	env = append(env, fmt.Sprintf("HARVESTER_SECRETS=%s", files.secrets))
+	env = append(env, fmt.Sprintf("HARVESTER_SECRETS_KEY=%s", files.secretsKey))
 	env = append(env, fmt.Sprintf("HARVESTER_INSTALLATION_LOG=%s", defaultLogFilePath))
 	env = append(env, fmt.Sprintf("HARVESTER_STREAMDISK_CLOUDINIT_URL=%s", userDataURL))
+	curlHome, err := writeCurlConfig(hvstConfig.Install.ISOURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if curlHome != "" {
+		// harv-install downloads the ISO with curl
+		env = append(env, fmt.Sprintf("CURL_HOME=%s", curlHome))
+	}
 	return env, elementalConfig, nil
 }
 
@@ -1028,6 +1262,7 @@ type Device struct {
 	WWN      string   `json:"wwn,omitempty"`
 	Serial   string   `json:"serial,omitempty"`
 	Label    string   `json:"label,omitempty"`
+	FSType   string   `json:"fstype,omitempty"`
 	Children []Device `json:"children,omitempty"`
 }
 
@@ -1254,3 +1254,28 @@ func Test_getWipeDisksOptions(t *testing.T) {
 	hvstConfig.Install.DataDisk = "/dev/sdc"
 	assert.Equal([]widgets.Option(nil), doc.getWipeDisksOptions(hvstConfig), "expected to skip data disk")
 }
+
+func TestFetchSecret(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "user" || password != "password" || r.Header.Get("X-Secret-Scope") != "install" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "denied") //nolint:errcheck
+			return
+		}
+		fmt.Fprint(w, "the-secret") //nolint:errcheck
+	}))
+	defer ts.Close()
+
+	source := config.SecretSource{
+		Headers:   map[string][]string{"X-Secret-Scope": {"install"}},
+		BasicAuth: config.HTTPBasicAuth{User: "user", Password: "password"},
+	}
+	secret, err := fetchSecret(ts.URL, source)
+	assert.Nil(t, err)
+	assert.Equal(t, "the-secret", secret)
+
+	source.BasicAuth.Password = "wrong"
+	_, err = fetchSecret(ts.URL, source)
+	assert.EqualError(t, err, fmt.Sprintf("got 403 status code from %s", ts.URL))
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -32,6 +33,7 @@ var (
 	ErrMsgModeJoinServerURLNotSpecified = fmt.Sprintf("ServerURL can't empty in %s mode", config.ModeJoin)
 	ErrMsgModeUnknown                   = "unknown mode"
 	ErrMsgTokenNotSpecified             = "token not specified"
+	ErrMsgTokenAutoNotInCreate          = fmt.Sprintf("token %q is only allowed in %s mode", config.TokenAuto, config.ModeCreate)
 	ErrMsgISOURLNotSpecified            = "iso_url is required in automatic installation"
 
 	ErrMsgMgmtInterfaceNotSpecified    = "no management interface specified"
@@ -41,10 +43,14 @@ var (
 	ErrMsgInterfaceNotSpecifiedForMgmt = "no interface specified for management network"
 	ErrMsgInterfaceNotFound            = "interface not found"
 	ErrMsgInterfaceIsLoop              = "interface is a loopback interface"
+	ErrMsgInterfaceNoSRIOV             = "interface doesn't support SR-IOV"
 	ErrMsgDeviceNotSpecified           = "no device specified"
 	ErrMsgDeviceNotFound               = "device not found"
 	ErrMsgDeviceTooSmall               = fmt.Sprintf("device size too small. At least %dG is required", config.SingleDiskMinSizeGiB)
 	ErrMsgNoCredentials                = "no SSH authorized keys or passwords are set"
+	ErrMsgPasswordFormatUnknown        = "unknown password format"
+	ErrMsgPasswordHashAlgorithmUnknown = "unknown password hash algorithm"
+	ErrMsgPasswordNotAHash             = "os.password is not a supported crypt hash"
 	ErrMsgForceMBROnLargeDisk          = "disk size too large for MBR partitioning table"
 	ErrMsgForceMBROnUEFI               = "cannot force MBR on UEFI system"
 
@@ -57,6 +63,7 @@ var (
 	ErrMsgUnsupportedSchemeVersion    = "Unsupported Harvester Scheme Version %d, please use new config and refer https://docs.harvesterhci.io/v1.1/install/harvester-configuration/"
 
 	ErrContainerdRegistrySettingNotValidJSON = "could not parse containerd-registry as JSON"
+	ErrMsgRegistriesAndContainerdRegistry    = "registries and the containerd-registry setting can't be both set"
 )
 
 type ValidatorInterface interface {
@@ -101,6 +108,23 @@ func checkInterface(iface config.NetworkInterface) error {
 	return prettyError(ErrMsgInterfaceNotFound, iface.Name)
 }
 
+// sriovTotalVFsFile tells how many virtual functions a NIC supports.
+var sriovTotalVFsFile = "/sys/class/net/%s/device/sriov_totalvfs"
+
+// checkSRIOV checks the NICs support the virtual functions configured.
+func checkSRIOV(sriovs []config.SRIOVConfig) error {
+	for _, sriov := range sriovs {
+		data, err := os.ReadFile(fmt.Sprintf(sriovTotalVFsFile, sriov.Interface))
+		if err != nil {
+			return prettyError(ErrMsgInterfaceNoSRIOV, sriov.Interface)
+		}
+		if totalVFs, err := strconv.Atoi(strings.TrimSpace(string(data))); err != nil || totalVFs < sriov.NumVFs {
+			return errors.Errorf("interface %s supports %s virtual functions, not %d", sriov.Interface, strings.TrimSpace(string(data)), sriov.NumVFs)
+		}
+	}
+	return nil
+}
+
 func checkDevice(cfg *config.HarvesterConfig) error {
 	installDisk := cfg.Install.Device
 	dataDisk := cfg.Install.DataDisk
@@ -407,7 +431,7 @@ func (v ConfigValidator) Validate(cfg *config.HarvesterConfig) error {
 		return err
 	}
 
-	return nil
+	return checkSRIOV(cfg.Passthrough.SRIOV)
 }
 
 func commonCheck(cfg *config.HarvesterConfig) error {
@@ -435,13 +459,143 @@ func commonCheck(cfg *config.HarvesterConfig) error {
 		return errors.New(ErrMsgTokenNotSpecified)
 	}
 
+	if cfg.Install.Mode != config.ModeCreate && cfg.Token == config.TokenAuto {
+		return errors.New(ErrMsgTokenAutoNotInCreate)
+	}
+
 	if len(cfg.SSHAuthorizedKeys) == 0 && cfg.Password == "" {
 		return errors.New(ErrMsgNoCredentials)
 	}
 
+	if err := checkPassword(cfg.OS); err != nil {
+		return err
+	}
+
+	if err := config.ValidateMergeStrategies(cfg.MergeStrategies); err != nil {
+		return err
+	}
+
+	if err := config.ValidateNodes(cfg.Nodes, cfg.ManagementInterface, cfg.OS.DNSNameservers); err != nil {
+		return err
+	}
+
+	if err := checkIntegrity(cfg.Install); err != nil {
+		return err
+	}
+
+	if err := config.ValidateTLSSettings(cfg.Install.TLS); err != nil {
+		return err
+	}
+
+	if err := config.ValidateProxy(cfg.Install.Proxy); err != nil {
+		return err
+	}
+
+	if err := config.ValidateAdditionalCAs(cfg.OS.AdditionalCAs); err != nil {
+		return err
+	}
+
+	if err := config.ValidateKubeletConfig(cfg.OS.Kubelet); err != nil {
+		return err
+	}
+
+	if err := config.ValidateTaints("os.taints", cfg.OS.Taints); err != nil {
+		return err
+	}
+
+	if err := config.ValidateAnnotations(cfg.OS.Annotations); err != nil {
+		return err
+	}
+
+	if err := config.ValidatePerformanceConfig(cfg.Performance); err != nil {
+		return err
+	}
+
+	if err := config.ValidateKernelArguments(cfg); err != nil {
+		return err
+	}
+
+	if err := config.ValidatePassthroughConfig(cfg); err != nil {
+		return err
+	}
+
+	if err := config.ValidateKdumpConfig(cfg); err != nil {
+		return err
+	}
+
+	if err := config.ValidateLocalization(cfg.OS); err != nil {
+		return err
+	}
+
+	if err := checkLocalization(cfg); err != nil {
+		return err
+	}
+
+	if err := config.ValidateRegistries(cfg.Registries); err != nil {
+		return err
+	}
+	// the setting seeded from the registries is theirs
+	if setting := cfg.SystemSettings["containerd-registry"]; cfg.Registries.Enabled() && setting != "" && setting != cfg.Registries.ContainerdRegistrySetting() {
+		return errors.New(ErrMsgRegistriesAndContainerdRegistry)
+	}
+
+	if err := config.ValidateRKE2Config(cfg.RKE2); err != nil {
+		return err
+	}
+
+	if err := config.ValidateEtcdSnapshots(cfg.RKE2.EtcdSnapshots, cfg.Install.Role); err != nil {
+		return err
+	}
+
+	if err := config.ValidateAuditConfig(cfg.RKE2.Audit); err != nil {
+		return err
+	}
+
 	return checkPersistentStatePaths(cfg.OS.PersistentStatePaths)
 }
 
+// checkIntegrity checks the digests and the key the config and the images
+// are verified with.
+func checkIntegrity(install config.Install) error {
+	if install.ConfigSHA256 != "" {
+		if err := util.ValidateSHA256(install.ConfigSHA256); err != nil {
+			return fmt.Errorf("invalid configSha256: %w", err)
+		}
+	}
+	if install.ISOSHA256 != "" {
+		if err := util.ValidateSHA256(install.ISOSHA256); err != nil {
+			return fmt.Errorf("invalid isoSha256: %w", err)
+		}
+	}
+	if install.RawDiskImageSHA256 != "" {
+		if err := util.ValidateSHA256(install.RawDiskImageSHA256); err != nil {
+			return fmt.Errorf("invalid rawDiskImageSha256: %w", err)
+		}
+	}
+	if install.PublicKey != "" {
+		if _, err := util.ParsePublicKey(install.PublicKey); err != nil {
+			return fmt.Errorf("invalid publicKey: %w", err)
+		}
+	}
+	return nil
+}
+
+func checkPassword(osConfig config.OS) error {
+	switch osConfig.PasswordFormat {
+	case "", config.PasswordFormatPlaintext:
+	case config.PasswordFormatHash:
+		if osConfig.Password != "" && !config.IsSecretReference(osConfig.Password) && !util.IsPasswordHash(osConfig.Password) {
+			return errors.New(ErrMsgPasswordNotAHash)
+		}
+	default:
+		return prettyError(ErrMsgPasswordFormatUnknown, osConfig.PasswordFormat)
+	}
+	if osConfig.PasswordHashAlgorithm != "" && !util.StringSliceContains(util.PasswordHashAlgorithms, osConfig.PasswordHashAlgorithm) {
+		return prettyError(ErrMsgPasswordHashAlgorithmUnknown, osConfig.PasswordHashAlgorithm)
+	}
+	return nil
+}
+
 func validateConfig(v ValidatorInterface, cfg *config.HarvesterConfig) error {
 	logrus.Debug("Validating config: ", cfg)
 	if err := commonCheck(cfg); err != nil {
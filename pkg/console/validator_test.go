@@ -1,6 +1,8 @@
 package console
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -102,6 +104,146 @@ func TestValidateConfig(t *testing.T) {
 			name: "valid join config",
 			cfg:  createJoinConfig(),
 		},
+		{
+			name: "invalid join config: auto token",
+			cfg:  createJoinConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.Token = config.TokenAuto
+			},
+			errMsg: ErrMsgTokenAutoNotInCreate,
+		},
+		{
+			name: "invalid create config: unknown password format",
+			cfg:  createCreateConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.OS.PasswordFormat = "hashed"
+			},
+			errMsg: ErrMsgPasswordFormatUnknown,
+		},
+		{
+			name: "invalid create config: password is not a hash",
+			cfg:  createCreateConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.OS.Password = "p@ssw0rd"
+				c.OS.PasswordFormat = config.PasswordFormatHash
+			},
+			errMsg: ErrMsgPasswordNotAHash,
+		},
+		{
+			name: "invalid create config: unknown password hash algorithm",
+			cfg:  createCreateConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.OS.PasswordFormat = config.PasswordFormatPlaintext
+				c.OS.PasswordHashAlgorithm = "md5"
+			},
+			errMsg: ErrMsgPasswordHashAlgorithmUnknown,
+		},
+		{
+			name: "valid create config: yescrypt password hash",
+			cfg:  createCreateConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.OS.Password = "$y$j9T$F5Jx5fExrKuJdvEIpgvBm/$6PR6L3SyD50qpZRF93UkJGOxMAVCQHc.JK2r376hWR7"
+				c.OS.PasswordFormat = config.PasswordFormatHash
+			},
+		},
+		{
+			name: "invalid create config: node inventory entry without key",
+			cfg:  createCreateConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.Nodes = []config.Node{{Hostname: "node1"}}
+			},
+			errMsg: "must have a macAddress, systemSerial or diskSerial",
+		},
+		{
+			name: "invalid create config: ISO digest is not SHA-256",
+			cfg:  createCreateConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.Install.ISOSHA256 = "d41d8cd98f00b204e9800998ecf8427e"
+			},
+			errMsg: "invalid isoSha256",
+		},
+		{
+			name: "invalid create config: registries and containerd-registry setting",
+			cfg:  createCreateConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.Registries.Mirrors = []config.RegistryMirror{{Registry: "docker.io", Endpoints: []string{"https://harbor.example.com"}}}
+				c.SystemSettings = map[string]string{"containerd-registry": `{"Mirrors":{}}`}
+			},
+			errMsg: ErrMsgRegistriesAndContainerdRegistry,
+		},
+		{
+			name: "invalid create config: unknown eviction signal",
+			cfg:  createCreateConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.OS.Kubelet.EvictionHard = map[string]string{"memory.free": "1Gi"}
+			},
+			errMsg: "os.kubelet.evictionHard.memory.free is not an eviction signal",
+		},
+		{
+			name: "invalid create config: unknown taint effect",
+			cfg:  createCreateConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.OS.Taints = []config.Taint{{Key: "tenant", Value: "acme", Effect: "NoRun"}}
+			},
+			errMsg: "os.taints[0].effect must be one of NoSchedule, PreferNoSchedule, NoExecute",
+		},
+		{
+			name: "invalid create config: unknown CPU manager policy",
+			cfg:  createCreateConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.Performance.CPUManagerPolicy = "exclusive"
+			},
+			errMsg: "performance.cpuManagerPolicy must be one of none, static",
+		},
+		{
+			name: "invalid create config: multipath turned back on",
+			cfg:  createCreateConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.OS.KernelArguments.Add = []string{"multipath=on"}
+			},
+			errMsg: "kernel argument multipath=on conflicts with multipath=off, which is needed unless os.externalStorageConfig is enabled",
+		},
+		{
+			name: "invalid create config: timezone out of zoneinfo",
+			cfg:  createCreateConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.OS.Timezone = "../shadow"
+			},
+			errMsg: `os.timezone is invalid: "../shadow"`,
+		},
+		{
+			name: "invalid create config: kdump target not persistent",
+			cfg:  createCreateConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.OS.Kdump = config.KdumpConfig{Enabled: true, Target: "/tmp/crash"}
+			},
+			errMsg: "os.kdump.target /tmp/crash isn't persistent, it must be in /var/crash, /usr/local, /var/lib/third-party or os.persistentStatePaths",
+		},
+		{
+			name: "invalid create config: rke2 key owned by Harvester",
+			cfg:  createCreateConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.RKE2.Server = map[string]interface{}{"cluster-cidr": "10.0.0.0/16"}
+			},
+			errMsg: "rke2.server.cluster-cidr is set by Harvester",
+		},
+		{
+			name: "invalid join config: etcd snapshots disabled on witness",
+			cfg:  createJoinConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.Install.Role = config.RoleWitness
+				c.RKE2.EtcdSnapshots.Disabled = true
+			},
+			errMsg: "rke2.etcdSnapshots can't be disabled on witness nodes",
+		},
+		{
+			name: "invalid create config: audit policy of another kind",
+			cfg:  createCreateConfig(),
+			preApply: func(c *config.HarvesterConfig) {
+				c.RKE2.Audit.Policy = "apiVersion: audit.k8s.io/v1\nkind: Event\n"
+			},
+			errMsg: "invalid rke2.audit.policy: must be an audit.k8s.io/v1 Policy",
+		},
 		{
 			name: "invalid join config: no server URL",
 			cfg:  createJoinConfig(),
@@ -309,3 +451,41 @@ func TestCheckPersistentStatePath(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckSRIOV(t *testing.T) {
+	dir := t.TempDir()
+	defer func(file string) { sriovTotalVFsFile = file }(sriovTotalVFsFile)
+	sriovTotalVFsFile = filepath.Join(dir, "%s")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ens1f0"), []byte("64\n"), 0644))
+
+	testCases := []struct {
+		name   string
+		sriov  config.SRIOVConfig
+		errMsg string
+	}{
+		{
+			name:  "supported",
+			sriov: config.SRIOVConfig{Interface: "ens1f0", NumVFs: 8},
+		},
+		{
+			name:   "too many VFs",
+			sriov:  config.SRIOVConfig{Interface: "ens1f0", NumVFs: 128},
+			errMsg: "interface ens1f0 supports 64 virtual functions, not 128",
+		},
+		{
+			name:   "no SR-IOV",
+			sriov:  config.SRIOVConfig{Interface: "eth0", NumVFs: 8},
+			errMsg: ErrMsgInterfaceNoSRIOV + ": eth0",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkSRIOV([]config.SRIOVConfig{tc.sriov})
+			if tc.errMsg != "" {
+				assert.EqualError(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
@@ -2,7 +2,6 @@ package console
 
 import (
 	"bytes"
-	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
@@ -36,7 +35,6 @@ const (
 	EventInstallStarted  = "STARTED"
 	EventInstallSuceeded = "SUCCEEDED"
 	EventInstallFailed   = "FAILED"
-	PasswordMask         = "******"
 )
 
 func IsValidEvent(event string) bool {
@@ -64,27 +62,14 @@ func IsValidHTTPMethod(method string) bool {
 }
 
 func (p *RenderedWebhook) DebugOutput(format string) {
-	password := p.BasicAuth.Password
-	p.BasicAuth.Password = PasswordMask
-	logrus.Debugf(format, p)
-	p.BasicAuth.Password = password
+	logrus.Debugf(format, config.Redact(*p))
 }
 
 func (p *RenderedWebhook) Handle() error {
 	p.DebugOutput("handle webhook: %+v")
 
 	doHTTPReq := func() error {
-		c := http.Client{
-			Timeout: defaultHTTPTimeout,
-		}
-
-		if p.Webhook.Insecure {
-			c.Transport = &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true,
-				},
-			}
-		}
+		c := newHTTPClient(httpClientOptions{insecure: p.Webhook.Insecure})
 
 		var body io.Reader
 		if p.RenderedPayload != "" {
@@ -201,10 +186,10 @@ func prepareWebhook(h config.Webhook, context map[string]string) (*RenderedWebho
 func PrepareWebhooks(hooks []config.Webhook, context map[string]string) (RendererWebhooks, error) {
 	result := make(RendererWebhooks, 0, len(hooks))
 	for _, h := range hooks {
-		logrus.Debugf("preparing webhook %+v", h)
+		logrus.Debugf("preparing webhook %+v", config.Redact(h))
 		p, err := prepareWebhook(h, context)
 		if err != nil {
-			msg := fmt.Sprintf("fail to prepare webhook %+v: %s", h, err)
+			msg := fmt.Sprintf("fail to prepare webhook %+v: %s", config.Redact(h), err)
 			logrus.Error(msg)
 			return nil, errors.New(msg)
 		}
@@ -257,16 +242,21 @@ func getIPAddr(iface *net.Interface, v6 bool) string {
 }
 
 func getWebhookContext(cfg *config.HarvesterConfig) map[string]string {
+	facts, err := getNodeFacts(cfg)
+	if err != nil {
+		logrus.Warnf("fail to get node facts for webhooks: %s", err)
+	}
+
 	// Hostname
 	m := map[string]string{
 		"Hostname": cfg.Hostname,
 	}
 
 	// MAC address and IP addresses
-	if iface, err := net.InterfaceByName(config.MgmtInterfaceName); err == nil {
-		m["MACAddr"] = iface.HardwareAddr.String()
-		m["IPAddrV4"] = getIPAddr(iface, false)
-		m["IPAddrV6"] = getIPAddr(iface, true)
+	if facts.MACAddr != "" {
+		m["MACAddr"] = facts.MACAddr
+		m["IPAddrV4"] = facts.IPAddrV4
+		m["IPAddrV6"] = facts.IPAddrV6
 	}
 	logrus.Debugf("webhook context %+v", m)
 	return m
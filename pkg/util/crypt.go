@@ -1,6 +1,8 @@
 package util
 
 import (
+	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/tredoe/osutil/user/crypt"
@@ -9,22 +11,64 @@ import (
 	"github.com/tredoe/osutil/user/crypt/md5_crypt"
 	"github.com/tredoe/osutil/user/crypt/sha256_crypt"
 	"github.com/tredoe/osutil/user/crypt/sha512_crypt"
+	"golang.org/x/crypto/bcrypt"
 )
 
-func CompareByShadow(key, shadowLine string) bool {
-	shadowSplits := strings.Split(shadowLine, ":")
-	if len(shadowSplits) < 2 {
+const (
+	PasswordHashYescrypt = "yescrypt"
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashSHA512   = "sha512"
+
+	// DefaultPasswordHash is what SLE Micro uses for new passwords.
+	DefaultPasswordHash = PasswordHashYescrypt
+)
+
+var (
+	PasswordHashAlgorithms = []string{PasswordHashYescrypt, PasswordHashBcrypt, PasswordHashSHA512}
+
+	// shaCryptHashRegexp matches md5, sha256 and sha512 crypt hashes.
+	shaCryptHashRegexp = regexp.MustCompile(`^\$(1\$[./0-9A-Za-z]{1,8}\$[./0-9A-Za-z]{22}|` +
+		`5\$(rounds=[0-9]+\$)?[./0-9A-Za-z]{1,16}\$[./0-9A-Za-z]{43}|` +
+		`6\$(rounds=[0-9]+\$)?[./0-9A-Za-z]{1,16}\$[./0-9A-Za-z]{86})$`)
+	yescryptHashRegexp = regexp.MustCompile(`^\$y\$[./0-9A-Za-z]+\$[./0-9A-Za-z]+\$[./0-9A-Za-z]{43}$`)
+)
+
+func isBcryptHash(hash string) bool {
+	if !strings.HasPrefix(hash, "$2a$") && !strings.HasPrefix(hash, "$2b$") && !strings.HasPrefix(hash, "$2y$") {
 		return false
 	}
-	passwdHash := shadowSplits[1]
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
+
+// IsPasswordHash reports whether s is a crypt(3) hash that can be verified
+// by VerifyPasswordHash.
+func IsPasswordHash(s string) bool {
+	switch {
+	case shaCryptHashRegexp.MatchString(s):
+		return true
+	case yescryptHashRegexp.MatchString(s):
+		_, _, _, err := parseYescryptSetting(s)
+		return err == nil
+	default:
+		return isBcryptHash(s)
+	}
+}
 
-	passwdHashSplits := strings.Split(passwdHash, "$")
-	if len(passwdHashSplits) < 4 {
+// VerifyPasswordHash reports whether key is the password of the crypt(3)
+// hash.
+func VerifyPasswordHash(key, hash string) bool {
+	if isBcryptHash(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(key)) == nil
+	}
+
+	hashSplits := strings.Split(hash, "$")
+	if len(hashSplits) < 4 {
 		return false
 	}
 	var c crypt.Crypter
 
-	prefix := passwdHashSplits[1]
+	prefix := hashSplits[1]
 	switch prefix {
 	case "1":
 		c = md5_crypt.New()
@@ -34,16 +78,43 @@ func CompareByShadow(key, shadowLine string) bool {
 		c = sha512_crypt.New()
 	case "apr1":
 		c = apr1_crypt.New()
+	case "y":
+		computed, err := yescryptCrypt([]byte(key), hash)
+		return err == nil && computed == hash
 	default:
 		return false
 	}
 
-	return c.Verify(passwdHash, []byte(key)) == nil
+	return c.Verify(hash, []byte(key)) == nil
+}
+
+func CompareByShadow(key, shadowLine string) bool {
+	shadowSplits := strings.Split(shadowLine, ":")
+	if len(shadowSplits) < 2 {
+		return false
+	}
+	return VerifyPasswordHash(key, shadowSplits[1])
+}
+
+// HashPassword hashes key with the given algorithm, one of
+// PasswordHashAlgorithms. An empty algorithm means DefaultPasswordHash.
+func HashPassword(key, algorithm string) (string, error) {
+	switch algorithm {
+	case "", PasswordHashYescrypt:
+		return GenerateYescryptPasswd(key)
+	case PasswordHashBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(key), bcrypt.DefaultCost)
+		return string(hash), err
+	case PasswordHashSHA512:
+		c := sha512_crypt.New()
+		salt := common.Salt{}
+		saltBytes := salt.Generate(16)
+		return c.Generate([]byte(key), saltBytes)
+	default:
+		return "", fmt.Errorf("unknown password hash algorithm %q", algorithm)
+	}
 }
 
 func GetEncryptedPasswd(key string) (string, error) {
-	c := sha512_crypt.New()
-	salt := common.Salt{}
-	saltBytes := salt.Generate(16)
-	return c.Generate([]byte(key), saltBytes)
+	return HashPassword(key, DefaultPasswordHash)
 }
@@ -55,6 +55,42 @@ func TestCompareByShadow(t *testing.T) {
 			shadow:   "rancher:$5$6LAKtLP0k6eSLylm$iPmjvy9x2KFJdqNTMotoQ84OZunCFrKcctw.1l0Ho27:18578:0:99999:7:::",
 			output:   false,
 		},
+		{
+			Name:     "match yescrypt",
+			password: "password",
+			shadow:   "rancher:$y$j9T$F5Jx5fExrKuJdvEIpgvBm/$6PR6L3SyD50qpZRF93UkJGOxMAVCQHc.JK2r376hWR7:18578:0:99999:7:::",
+			output:   true,
+		},
+		{
+			Name:     "mismatch yescrypt",
+			password: "Password",
+			shadow:   "rancher:$y$j9T$F5Jx5fExrKuJdvEIpgvBm/$6PR6L3SyD50qpZRF93UkJGOxMAVCQHc.JK2r376hWR7:18578:0:99999:7:::",
+			output:   false,
+		},
+		{
+			Name:     "match yescrypt without prehash",
+			password: "x",
+			shadow:   "rancher:$y$j7T$abcdefghijklmnopqrstu.$gucVM5ShSVPBzqxKADwuQmPXxxwR7xTLCjgaHFqk/S8:18578:0:99999:7:::",
+			output:   true,
+		},
+		{
+			Name:     "match bcrypt 2b",
+			password: "password",
+			shadow:   "rancher:$2b$05$abcdefghijklmnopqrstuuWG29KuyeAicPCJODk1zjyGvyQUU2awu:18578:0:99999:7:::",
+			output:   true,
+		},
+		{
+			Name:     "match bcrypt 2y",
+			password: "Harvester123!",
+			shadow:   "rancher:$2y$10$abcdefghijklmnopqrstuuc2Gp0mzJYM1YkINjySSmDKI9mm7krNG:18578:0:99999:7:::",
+			output:   true,
+		},
+		{
+			Name:     "mismatch bcrypt",
+			password: "harvester123!",
+			shadow:   "rancher:$2y$10$abcdefghijklmnopqrstuuc2Gp0mzJYM1YkINjySSmDKI9mm7krNG:18578:0:99999:7:::",
+			output:   false,
+		},
 	}
 	for _, tCase := range testCases {
 		actual := CompareByShadow(tCase.password, tCase.shadow)
@@ -62,6 +98,43 @@ func TestCompareByShadow(t *testing.T) {
 	}
 }
 
+func TestHashPassword(t *testing.T) {
+	for _, algorithm := range PasswordHashAlgorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			hash, err := HashPassword("p@ssw0rd", algorithm)
+			assert.NoError(t, err)
+			assert.True(t, IsPasswordHash(hash), hash)
+			assert.True(t, VerifyPasswordHash("p@ssw0rd", hash))
+			assert.False(t, VerifyPasswordHash("p@ssw0rd1", hash))
+		})
+	}
+
+	_, err := HashPassword("p@ssw0rd", "md5")
+	assert.Error(t, err)
+}
+
+func TestIsPasswordHash(t *testing.T) {
+	testCases := []struct {
+		input  string
+		output bool
+	}{
+		{"$1$u9auViW8$PZ3di3aAQHHUtKS3jvgP3/", true},
+		{"$5$6LAKtLP0k6eSLylm$iPmjvy9x2KFJdqNTMotoQ84OZunCFrKcctw.1l0Ho27", true},
+		{"$6$MxtBRHZbMLzf2vrg$tLa71bzOYDLZTMzQT1wWtYQAK3wS0mqiaOkppyOUWwo8AgsBqgVvo5b2wsgkrbtYhZlJXAK9bzPudRAxOZn1H1", true},
+		{"$y$j9T$F5Jx5fExrKuJdvEIpgvBm/$6PR6L3SyD50qpZRF93UkJGOxMAVCQHc.JK2r376hWR7", true},
+		{"$2b$05$abcdefghijklmnopqrstuuWG29KuyeAicPCJODk1zjyGvyQUU2awu", true},
+		{"$6$salt$hash", false},
+		{"$y$j9T$F5Jx5fExrKuJdvEIpgvBm/$tooshort", false},
+		{"$2b$05$tooshort", false},
+		{"$ecret-passw0rd", false},
+		{"p@ssw0rd", false},
+		{"", false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.output, IsPasswordHash(tc.input), tc.input)
+	}
+}
+
 func TestF(t *testing.T) {
 	s, e := GetEncryptedPasswd("1")
 	t.Log(s)
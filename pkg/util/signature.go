@@ -0,0 +1,247 @@
+package util
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// SHA256Param is the URL query parameter carrying the expected SHA-256
+	// digest of what the URL points to.
+	SHA256Param = "sha256"
+
+	// SignatureSuffix is appended to a URL to get its detached signature.
+	SignatureSuffix = ".minisig"
+
+	minisignPureAlg      = "Ed"
+	minisignPrehashedAlg = "ED"
+	minisignKeyIDSize    = 8
+	untrustedComment     = "untrusted comment:"
+	trustedComment       = "trusted comment: "
+
+	// maxPureSignedSize limits how much is held in memory to check a
+	// signature of the whole message, rather than of its BLAKE2b digest.
+	maxPureSignedSize = 64 << 20
+)
+
+// PublicKey is an ed25519 key to check detached signatures with.
+type PublicKey struct {
+	keyID []byte
+	key   ed25519.PublicKey
+}
+
+// Signature is a detached ed25519 signature, either a minisign signature or
+// a bare one.
+type Signature struct {
+	prehashed bool
+	keyID     []byte
+	signature []byte
+	// trustedComment and globalSignature are only in minisign signatures.
+	trustedComment  string
+	globalSignature []byte
+}
+
+// SplitDigestURL removes the sha256 query parameter from rawURL, and returns
+// the URL left and the digest.
+func SplitDigestURL(rawURL string) (string, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL, "", nil
+	}
+	query := u.Query()
+	digest := query.Get(SHA256Param)
+	if digest == "" {
+		return rawURL, "", nil
+	}
+	query.Del(SHA256Param)
+	u.RawQuery = query.Encode()
+	if err := ValidateSHA256(digest); err != nil {
+		return "", "", fmt.Errorf("invalid %s of %s: %w", SHA256Param, u, err)
+	}
+	return u.String(), strings.ToLower(digest), nil
+}
+
+// ValidateSHA256 checks that digest is a hex encoded SHA-256 digest.
+func ValidateSHA256(digest string) error {
+	b, err := hex.DecodeString(digest)
+	if err != nil {
+		return err
+	}
+	if len(b) != sha256.Size {
+		return fmt.Errorf("%s is not a SHA-256 digest", digest)
+	}
+	return nil
+}
+
+// decodeMinisignLines returns the lines of a minisign key or signature file
+// with the untrusted comment left out, or the whole text of bare ones.
+func decodeMinisignLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, untrustedComment) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// ParsePublicKey parses a minisign public key, with or without its comment
+// line, or a bare base64 encoded ed25519 key.
+func ParsePublicKey(text string) (*PublicKey, error) {
+	lines := decodeMinisignLines(text)
+	if len(lines) != 1 {
+		return nil, errors.New("public key must be a single base64 encoded line")
+	}
+	b, err := base64.StdEncoding.DecodeString(lines[0])
+	if err != nil {
+		return nil, fmt.Errorf("fail to decode public key: %w", err)
+	}
+	switch len(b) {
+	case ed25519.PublicKeySize:
+		return &PublicKey{key: b}, nil
+	case 2 + minisignKeyIDSize + ed25519.PublicKeySize:
+		if string(b[:2]) != minisignPureAlg {
+			return nil, fmt.Errorf("unsupported public key algorithm %q", b[:2])
+		}
+		return &PublicKey{keyID: b[2 : 2+minisignKeyIDSize], key: b[2+minisignKeyIDSize:]}, nil
+	default:
+		return nil, fmt.Errorf("public key has an unexpected length of %d bytes", len(b))
+	}
+}
+
+// ParseSignature parses a minisign signature file, or a bare base64 encoded
+// ed25519 signature.
+func ParseSignature(text string) (*Signature, error) {
+	lines := decodeMinisignLines(text)
+	if len(lines) == 0 {
+		return nil, errors.New("empty signature")
+	}
+	b, err := base64.StdEncoding.DecodeString(lines[0])
+	if err != nil {
+		return nil, fmt.Errorf("fail to decode signature: %w", err)
+	}
+	if len(b) == ed25519.SignatureSize && len(lines) == 1 {
+		return &Signature{signature: b}, nil
+	}
+	if len(b) != 2+minisignKeyIDSize+ed25519.SignatureSize {
+		return nil, fmt.Errorf("signature has an unexpected length of %d bytes", len(b))
+	}
+	sig := &Signature{keyID: b[2 : 2+minisignKeyIDSize], signature: b[2+minisignKeyIDSize:]}
+	switch string(b[:2]) {
+	case minisignPureAlg:
+	case minisignPrehashedAlg:
+		sig.prehashed = true
+	default:
+		return nil, fmt.Errorf("unsupported signature algorithm %q", b[:2])
+	}
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], trustedComment) {
+		return nil, errors.New("signature has no trusted comment")
+	}
+	sig.trustedComment = strings.TrimPrefix(lines[1], trustedComment)
+	if sig.globalSignature, err = base64.StdEncoding.DecodeString(lines[2]); err != nil {
+		return nil, fmt.Errorf("fail to decode global signature: %w", err)
+	}
+	return sig, nil
+}
+
+// Verifier checks what is written to it against an expected SHA-256 digest
+// and a detached signature, either of which is optional.
+type Verifier struct {
+	digest    string
+	key       *PublicKey
+	signature *Signature
+
+	sha256  hash.Hash
+	blake2b hash.Hash
+	message bytes.Buffer
+	size    int64
+}
+
+// NewVerifier returns a verifier of the digest and the signature. A
+// signature needs a key to be checked with.
+func NewVerifier(digest string, key *PublicKey, signature *Signature) (*Verifier, error) {
+	if digest != "" {
+		if err := ValidateSHA256(digest); err != nil {
+			return nil, err
+		}
+	}
+	if signature != nil && key == nil {
+		return nil, errors.New("no public key to check the signature with")
+	}
+	v := &Verifier{
+		digest:    strings.ToLower(digest),
+		key:       key,
+		signature: signature,
+		sha256:    sha256.New(),
+	}
+	if signature != nil && signature.prehashed {
+		v.blake2b, _ = blake2b.New512(nil)
+	}
+	return v, nil
+}
+
+func (v *Verifier) Write(p []byte) (int, error) {
+	v.size += int64(len(p))
+	v.sha256.Write(p)
+	if v.signature == nil {
+		return len(p), nil
+	}
+	if v.blake2b != nil {
+		v.blake2b.Write(p)
+		return len(p), nil
+	}
+	if v.size > maxPureSignedSize {
+		return 0, fmt.Errorf("more than %d bytes to check a signature of the whole content, sign a digest of it instead (minisign -H)", maxPureSignedSize)
+	}
+	return v.message.Write(p)
+}
+
+// Verify checks what was written so far, and returns its SHA-256 digest.
+func (v *Verifier) Verify() (string, error) {
+	digest := hex.EncodeToString(v.sha256.Sum(nil))
+	if v.digest != "" && digest != v.digest {
+		return digest, fmt.Errorf("SHA-256 digest %s of %d bytes doesn't match the expected %s", digest, v.size, v.digest)
+	}
+	if v.signature == nil {
+		return digest, nil
+	}
+	sig := v.signature
+	if sig.keyID != nil && v.key.keyID != nil && !bytes.Equal(sig.keyID, v.key.keyID) {
+		return digest, fmt.Errorf("signed by key %X, not by the trusted key %X", reverse(sig.keyID), reverse(v.key.keyID))
+	}
+	message := v.message.Bytes()
+	if v.blake2b != nil {
+		message = v.blake2b.Sum(nil)
+	}
+	if !ed25519.Verify(v.key.key, message, sig.signature) {
+		return digest, errors.New("invalid signature")
+	}
+	if sig.globalSignature != nil {
+		global := append(append([]byte{}, sig.signature...), sig.trustedComment...)
+		if !ed25519.Verify(v.key.key, global, sig.globalSignature) {
+			return digest, errors.New("invalid signature of the trusted comment")
+		}
+	}
+	return digest, nil
+}
+
+// reverse returns a minisign key ID the way minisign prints it.
+func reverse(keyID []byte) []byte {
+	r := make([]byte, len(keyID))
+	for i, b := range keyID {
+		r[len(keyID)-1-i] = b
+	}
+	return r
+}
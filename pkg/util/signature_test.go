@@ -0,0 +1,115 @@
+package util
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitDigestURL(t *testing.T) {
+	digest := strings.Repeat("ab", sha256.Size)
+	testCases := []struct {
+		url            string
+		expectedURL    string
+		expectedDigest string
+		errMsg         string
+	}{
+		{url: "http://example.com/config.yaml", expectedURL: "http://example.com/config.yaml"},
+		{url: "http://example.com/config.yaml?sha256=" + digest, expectedURL: "http://example.com/config.yaml", expectedDigest: digest},
+		{url: "http://example.com/config.yaml?sha256=" + strings.ToUpper(digest), expectedURL: "http://example.com/config.yaml", expectedDigest: digest},
+		{url: "http://example.com/config.yaml?node=1&sha256=" + digest, expectedURL: "http://example.com/config.yaml?node=1", expectedDigest: digest},
+		{url: "nocloud:?sha256=" + digest, expectedURL: "nocloud:", expectedDigest: digest},
+		{url: "http://example.com/config.yaml?sha256=abcd", errMsg: "is not a SHA-256 digest"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			url, digest, err := SplitDigestURL(tc.url)
+			if tc.errMsg != "" {
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectedURL, url)
+			assert.Equal(t, tc.expectedDigest, digest)
+		})
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	message := []byte("install:\n  mode: create\n")
+	sum := sha256.Sum256(message)
+	digest := hex.EncodeToString(sum[:])
+	publicKey, sign := MinisignKeyPair(t)
+	otherKey, _ := MinisignKeyPair(t)
+
+	rawPublic, rawPrivate, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	rawPublicKey := base64.StdEncoding.EncodeToString(rawPublic)
+	rawSignature := base64.StdEncoding.EncodeToString(ed25519.Sign(rawPrivate, message))
+
+	testCases := []struct {
+		name      string
+		digest    string
+		publicKey string
+		signature string
+		message   []byte
+		errMsg    string
+	}{
+		{name: "digest", digest: digest, message: message},
+		{name: "digest mismatch", digest: digest, message: message[:10], errMsg: "doesn't match the expected"},
+		{name: "pure signature", publicKey: publicKey, signature: sign(message, false), message: message},
+		{name: "prehashed signature", publicKey: publicKey, signature: sign(message, true), message: message},
+		{name: "digest and signature", digest: digest, publicKey: publicKey, signature: sign(message, true), message: message},
+		{name: "truncated", publicKey: publicKey, signature: sign(message, true), message: message[:10], errMsg: "invalid signature"},
+		{name: "tampered trusted comment", publicKey: publicKey, signature: strings.Replace(sign(message, true), "timestamp", "timestamP", 1), message: message, errMsg: "invalid signature of the trusted comment"},
+		{name: "other key", publicKey: otherKey, signature: sign(message, true), message: message, errMsg: "invalid signature"},
+		{name: "bare key and signature", publicKey: rawPublicKey, signature: rawSignature, message: message},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var key *PublicKey
+			var signature *Signature
+			if tc.publicKey != "" {
+				key, err = ParsePublicKey(tc.publicKey)
+				assert.Nil(t, err)
+			}
+			if tc.signature != "" {
+				signature, err = ParseSignature(tc.signature)
+				assert.Nil(t, err)
+			}
+			verifier, err := NewVerifier(tc.digest, key, signature)
+			assert.Nil(t, err)
+			_, err = verifier.Write(tc.message)
+			assert.Nil(t, err)
+			actual, err := verifier.Verify()
+			if tc.errMsg != "" {
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, digest, actual)
+		})
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	publicKey, sign := MinisignKeyPair(t)
+	_, err := ParsePublicKey(publicKey)
+	assert.Nil(t, err)
+
+	signature := sign([]byte("config"), true)
+	lines := strings.Split(signature, "\n")
+	_, err = ParseSignature(strings.Join(lines[:2], "\n"))
+	assert.ErrorContains(t, err, "no trusted comment")
+
+	_, err = ParseSignature("untrusted comment: nothing\n")
+	assert.ErrorContains(t, err, "empty signature")
+
+	_, err = ParsePublicKey("not base64")
+	assert.ErrorContains(t, err, "fail to decode public key")
+}
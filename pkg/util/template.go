@@ -2,13 +2,30 @@ package util
 
 import (
 	"bytes"
+	"strings"
 	"text/template"
 )
 
+// TemplateFuncs are the functions available in templates.
+var TemplateFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"default": func(def, s string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	},
+}
+
 // RenderTemplate renders a template that has no template reference in it
 func RenderTemplate(templ string, context interface{}) (string, error) {
 	result := bytes.NewBufferString("")
-	tmpl, err := template.New("").Parse(templ)
+	tmpl, err := template.New("").Funcs(TemplateFuncs).Parse(templ)
 	if err != nil {
 		return "", err
 	}
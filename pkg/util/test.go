@@ -1,9 +1,14 @@
 package util
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
 	"os"
 	"path"
 	"testing"
+
+	"golang.org/x/crypto/blake2b"
 )
 
 // LoadFixture loads a testing fixture from testdata dir
@@ -15,3 +20,31 @@ func LoadFixture(t *testing.T, name string) []byte {
 	}
 	return data
 }
+
+// MinisignKeyPair generates a minisign public key, and a function signing
+// messages with the secret key the way `minisign -S` does.
+func MinisignKeyPair(t *testing.T) (string, func(message []byte, prehashed bool) string) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Fail to generate key: %v", err)
+	}
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	publicKey := fmt.Sprintf("untrusted comment: minisign public key\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte(minisignPureAlg), keyID...), public...)))
+	sign := func(message []byte, prehashed bool) string {
+		alg := minisignPureAlg
+		if prehashed {
+			digest := blake2b.Sum512(message)
+			message = digest[:]
+			alg = minisignPrehashedAlg
+		}
+		signature := ed25519.Sign(private, message)
+		comment := "timestamp:1700000000"
+		global := ed25519.Sign(private, append(append([]byte{}, signature...), comment...))
+		return fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\n%s%s\n%s\n",
+			base64.StdEncoding.EncodeToString(append(append([]byte(alg), keyID...), signature...)),
+			trustedComment, comment,
+			base64.StdEncoding.EncodeToString(global))
+	}
+	return publicKey, sign
+}
@@ -0,0 +1,74 @@
+package util
+
+import (
+	"crypto/rand"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+const (
+	// tokenAlphabet leaves out characters that are easily confused when the
+	// token is read from a screen and typed in again (0/o, 1/l).
+	tokenAlphabet    = "abcdefghijkmnpqrstuvwxyz23456789"
+	tokenGroupSize   = 5
+	tokenGroupCount  = 6
+	tokenGroupJoiner = "-"
+)
+
+// GenerateToken returns a cryptographically random cluster token in the
+// form "xxxxx-xxxxx-xxxxx-xxxxx-xxxxx-xxxxx" (150 bits of entropy).
+func GenerateToken() (string, error) {
+	buf := make([]byte, tokenGroupSize*tokenGroupCount)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	groups := make([]string, 0, tokenGroupCount)
+	for i := 0; i < tokenGroupCount; i++ {
+		var sb strings.Builder
+		for _, b := range buf[i*tokenGroupSize : (i+1)*tokenGroupSize] {
+			// len(tokenAlphabet) divides 256, so there is no modulo bias
+			sb.WriteByte(tokenAlphabet[int(b)%len(tokenAlphabet)])
+		}
+		groups = append(groups, sb.String())
+	}
+	return strings.Join(groups, tokenGroupJoiner), nil
+}
+
+// RenderQRCode renders text as a QR code made of Unicode half blocks, so
+// that two rows of modules fit into one line of a text console.
+func RenderQRCode(text string) (string, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", err
+	}
+
+	// the QR spec requires a quiet zone of 4 modules around the symbol
+	const quietZone = 4
+	black := func(x, y int) bool {
+		return code.Black(x-quietZone, y-quietZone)
+	}
+	size := code.Size + 2*quietZone
+
+	// Draw light modules and leave dark modules blank so the code is
+	// readable on the usual light-on-dark console.
+	var sb strings.Builder
+	for y := 0; y < size; y += 2 {
+		for x := 0; x < size; x++ {
+			top, bottom := !black(x, y), y+1 < size && !black(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
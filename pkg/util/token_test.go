@@ -0,0 +1,37 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateToken(t *testing.T) {
+	pattern := regexp.MustCompile(`^[a-km-np-z2-9]{5}(-[a-km-np-z2-9]{5}){5}$`)
+
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		token, err := GenerateToken()
+		assert.Nil(t, err)
+		assert.Regexp(t, pattern, token)
+		assert.False(t, seen[token], "duplicated token %s", token)
+		seen[token] = true
+	}
+}
+
+func TestRenderQRCode(t *testing.T) {
+	out, err := RenderQRCode("abcde-fghij-kmnpq-rstuv-wxyz2-34567")
+	assert.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	// version 3 symbol (29 modules) plus the quiet zone on both sides
+	width := 29 + 2*4
+	assert.Len(t, lines, (width+1)/2)
+	for _, line := range lines {
+		assert.Equal(t, width, len([]rune(line)))
+	}
+	// the quiet zone is always light
+	assert.Equal(t, strings.Repeat("█", width), lines[0])
+}
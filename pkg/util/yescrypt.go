@@ -0,0 +1,585 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"strings"
+)
+
+// This is a port of the yescrypt reference implementation limited to what
+// crypt(3) hashes in /etc/shadow use: the default pwxform settings and no
+// ROM. It is not fast, but hashing a single password at login cost is fine.
+
+const (
+	yescryptPrefix = "$y$"
+
+	yescryptRW              = 0x002
+	yescryptRWFlavorMask    = 0x3fc
+	yescryptDefaultFlags    = 0x0b6 // RW, 6 rounds, gather 4, simple 2, 12K S-box
+	yescryptPrehash         = 0x10000000
+	yescryptDefaultNLog2    = 12
+	yescryptDefaultR        = 32
+	yescryptSaltBytes       = 16
+	yescryptHashBytes       = 32
+	yescryptItoa64          = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	pwxSimple               = 2
+	pwxGather               = 4
+	pwxRounds               = 6
+	pwxWords                = pwxGather * pwxSimple * 2
+	sWidth                  = 8
+	sBytes                  = 3 * (1 << sWidth) * pwxSimple * 8
+	sWords                  = sBytes / 4
+	sMask                   = ((1 << sWidth) - 1) * pwxSimple * 8
+	yescryptMaxNLog2        = 24
+	yescryptMaxR            = 1 << 8
+	yescryptMaxMemoryBlocks = 1 << 20
+)
+
+var errInvalidYescryptSetting = errors.New("invalid yescrypt setting")
+
+type yescryptParams struct {
+	flags uint32
+	n     uint64
+	r     uint32
+	p     uint32
+	t     uint32
+}
+
+type pwxformCtx struct {
+	s0, s1, s2 []uint32
+	w          int
+}
+
+func atoi64(c byte) uint32 {
+	if i := strings.IndexByte(yescryptItoa64, c); i >= 0 {
+		return uint32(i)
+	}
+	return 64
+}
+
+// decode64Uint32 decodes the variable length integers of the parameters.
+func decode64Uint32(src string, min uint32) (uint32, string, error) {
+	if src == "" {
+		return 0, "", errInvalidYescryptSetting
+	}
+	var start, end, chars, bits uint32 = 0, 47, 1, 0
+	c := atoi64(src[0])
+	if c > 63 {
+		return 0, "", errInvalidYescryptSetting
+	}
+	src = src[1:]
+	dst := min
+	for c > end {
+		dst += (end + 1 - start) << bits
+		start = end + 1
+		end = start + (62-end)/2
+		chars++
+		bits += 6
+	}
+	dst += (c - start) << bits
+	for chars--; chars > 0; chars-- {
+		if src == "" {
+			return 0, "", errInvalidYescryptSetting
+		}
+		c = atoi64(src[0])
+		if c > 63 {
+			return 0, "", errInvalidYescryptSetting
+		}
+		src = src[1:]
+		bits -= 6
+		dst += c << bits
+	}
+	return dst, src, nil
+}
+
+func encode64Uint32(src, min uint32) string {
+	var start, end, bits uint32 = 0, 47, 0
+	src -= min
+	for {
+		count := (end + 1 - start) << bits
+		if src < count {
+			break
+		}
+		start = end + 1
+		end = start + (62-end)/2
+		src -= count
+		bits += 6
+	}
+	var sb strings.Builder
+	sb.WriteByte(yescryptItoa64[start+(src>>bits)])
+	for bits > 0 {
+		bits -= 6
+		sb.WriteByte(yescryptItoa64[(src>>bits)&0x3f])
+	}
+	return sb.String()
+}
+
+// encode64 and decode64 use the little-endian base64 variant of yescrypt,
+// which differs from the one of the other crypt(3) hashes.
+func encode64(src []byte) string {
+	var sb strings.Builder
+	for i := 0; i < len(src); {
+		var value, bits uint32
+		for bits < 24 && i < len(src) {
+			value |= uint32(src[i]) << bits
+			bits += 8
+			i++
+		}
+		for b := uint32(0); b < bits; b += 6 {
+			sb.WriteByte(yescryptItoa64[value&0x3f])
+			value >>= 6
+		}
+	}
+	return sb.String()
+}
+
+func decode64(src string) ([]byte, error) {
+	var dst []byte
+	for len(src) > 0 {
+		var value, bits uint32
+		for len(src) > 0 && bits < 24 {
+			c := atoi64(src[0])
+			if c > 63 {
+				return nil, errInvalidYescryptSetting
+			}
+			src = src[1:]
+			value |= c << bits
+			bits += 6
+		}
+		// a group must hold at least one full byte, and no stray bits
+		if bits < 12 {
+			return nil, errInvalidYescryptSetting
+		}
+		for ; bits >= 8; bits -= 8 {
+			dst = append(dst, byte(value))
+			value >>= 8
+		}
+		if value != 0 {
+			return nil, errInvalidYescryptSetting
+		}
+	}
+	return dst, nil
+}
+
+func parseYescryptSetting(setting string) (params yescryptParams, prefix string, salt []byte, err error) {
+	if !strings.HasPrefix(setting, yescryptPrefix) {
+		return params, "", nil, errInvalidYescryptSetting
+	}
+	src := setting[len(yescryptPrefix):]
+	params.p = 1
+
+	flavor, src, err := decode64Uint32(src, 0)
+	if err != nil {
+		return params, "", nil, err
+	}
+	switch {
+	case flavor < yescryptRW:
+		params.flags = flavor
+	case flavor <= yescryptRW+(yescryptRWFlavorMask>>2):
+		params.flags = yescryptRW + ((flavor - yescryptRW) << 2)
+	default:
+		return params, "", nil, errInvalidYescryptSetting
+	}
+	// only the default flavor of yescrypt is implemented
+	if params.flags != yescryptDefaultFlags {
+		return params, "", nil, errors.New("unsupported yescrypt flavor")
+	}
+
+	nLog2, src, err := decode64Uint32(src, 1)
+	if err != nil {
+		return params, "", nil, err
+	}
+	if nLog2 > yescryptMaxNLog2 {
+		return params, "", nil, errors.New("yescrypt cost is too high")
+	}
+	params.n = uint64(1) << nLog2
+
+	if params.r, src, err = decode64Uint32(src, 1); err != nil {
+		return params, "", nil, err
+	}
+
+	if src != "" && src[0] != '$' {
+		var have uint32
+		if have, src, err = decode64Uint32(src, 1); err != nil {
+			return params, "", nil, err
+		}
+		if have&1 != 0 {
+			if params.p, src, err = decode64Uint32(src, 2); err != nil {
+				return params, "", nil, err
+			}
+		}
+		if have&2 != 0 {
+			if params.t, src, err = decode64Uint32(src, 1); err != nil {
+				return params, "", nil, err
+			}
+		}
+		// hash upgrades and ROMs are not supported
+		if have&^3 != 0 {
+			return params, "", nil, errors.New("unsupported yescrypt parameters")
+		}
+	}
+	if src == "" || src[0] != '$' {
+		return params, "", nil, errInvalidYescryptSetting
+	}
+	src = src[1:]
+	prefix = setting[:len(setting)-len(src)]
+
+	saltStr := src
+	if i := strings.IndexByte(saltStr, '$'); i >= 0 {
+		saltStr = saltStr[:i]
+	}
+	prefix += saltStr
+	if salt, err = decode64(saltStr); err != nil {
+		return params, "", nil, err
+	}
+
+	if params.r > yescryptMaxR || params.p > yescryptMaxR || params.n/uint64(params.p) < 2 ||
+		params.n*uint64(params.r) > yescryptMaxMemoryBlocks {
+		return params, "", nil, errors.New("unsupported yescrypt parameters")
+	}
+	return params, prefix, salt, nil
+}
+
+// yescryptCrypt hashes key with the settings (and salt) of setting, which
+// may be a full hash, and returns the hash in crypt(3) format.
+func yescryptCrypt(key []byte, setting string) (string, error) {
+	params, prefix, salt, err := parseYescryptSetting(setting)
+	if err != nil {
+		return "", err
+	}
+	hash, err := yescryptKDF(key, salt, params)
+	if err != nil {
+		return "", err
+	}
+	return prefix + "$" + encode64(hash), nil
+}
+
+// GenerateYescryptPasswd hashes key with yescrypt at the default cost of
+// libxcrypt.
+func GenerateYescryptPasswd(key string) (string, error) {
+	salt := make([]byte, yescryptSaltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	setting := yescryptPrefix +
+		encode64Uint32(yescryptRW+((yescryptDefaultFlags-yescryptRW)>>2), 0) +
+		encode64Uint32(yescryptDefaultNLog2, 1) +
+		encode64Uint32(yescryptDefaultR, 1) +
+		"$" + encode64(salt)
+	return yescryptCrypt([]byte(key), setting)
+}
+
+func yescryptKDF(passwd, salt []byte, params yescryptParams) ([]byte, error) {
+	n, r, p := params.n, params.r, params.p
+	if params.flags&yescryptRW != 0 && p >= 1 && n/uint64(p) >= 0x100 && n/uint64(p)*uint64(r) >= 0x20000 {
+		dk, err := yescryptKDFBody(passwd, salt, params.flags|yescryptPrehash, n>>6, r, p, 0)
+		if err != nil {
+			return nil, err
+		}
+		passwd = dk
+	}
+	return yescryptKDFBody(passwd, salt, params.flags, n, r, p, params.t)
+}
+
+func yescryptKDFBody(passwd, salt []byte, flags uint32, n uint64, r, p, t uint32) ([]byte, error) {
+	if flags != 0 {
+		prehashKey := "yescrypt-prehash"
+		if flags&yescryptPrehash == 0 {
+			prehashKey = prehashKey[:8]
+		}
+		passwd = hmacSHA256([]byte(prehashKey), passwd)
+	}
+
+	s := 32 * int(r)
+	bBytes, err := pbkdf2.Key(sha256.New, string(passwd), salt, 1, 128*int(r)*int(p))
+	if err != nil {
+		return nil, err
+	}
+	b := make([]uint32, s*int(p))
+	for i := range b {
+		b[i] = binary.LittleEndian.Uint32(bBytes[4*i:])
+	}
+
+	if flags != 0 {
+		passwd = append([]byte(nil), bBytes[:32]...)
+	}
+	passwd = yescryptSMix(b, int(r), n, p, t, flags, passwd)
+
+	bBytes = make([]byte, 4*len(b))
+	for i, v := range b {
+		binary.LittleEndian.PutUint32(bBytes[4*i:], v)
+	}
+	dk, err := pbkdf2.Key(sha256.New, string(passwd), bBytes, 1, yescryptHashBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if flags != 0 && flags&yescryptPrehash == 0 {
+		clientKey := hmacSHA256(dk, []byte("Client Key"))
+		storedKey := sha256.Sum256(clientKey)
+		dk = storedKey[:]
+	}
+	return dk, nil
+}
+
+func hmacSHA256(key, msg []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+func yescryptSMix(b []uint32, r int, n uint64, p, t, flags uint32, passwd []byte) []byte {
+	s := 32 * r
+	nChunk := n / uint64(p)
+	nLoopAll := nChunk
+	if flags&yescryptRW != 0 {
+		if t <= 1 {
+			if t != 0 {
+				nLoopAll *= 2
+			}
+			nLoopAll = (nLoopAll + 2) / 3
+		} else {
+			nLoopAll *= uint64(t) - 1
+		}
+	} else if t != 0 {
+		if t == 1 {
+			nLoopAll += (nLoopAll + 1) / 2
+		}
+		nLoopAll *= uint64(t)
+	}
+	var nLoopRW uint64
+	if flags&yescryptRW != 0 {
+		nLoopRW = nLoopAll / uint64(p)
+	}
+	nChunk &^= 1
+	nLoopAll = (nLoopAll + 1) &^ 1
+	nLoopRW = (nLoopRW + 1) &^ 1
+
+	v := make([]uint32, s*int(n))
+	xy := make([]uint32, 2*s)
+	ctxs := make([]*pwxformCtx, p)
+	for i := uint32(0); i < p; i++ {
+		vChunk := uint64(i) * nChunk
+		np := nChunk
+		if i == p-1 {
+			np = n - vChunk
+		}
+		bp := b[s*int(i) : s*int(i+1)]
+		vp := v[s*int(vChunk):]
+		if flags&yescryptRW != 0 {
+			sBox := make([]uint32, sWords)
+			yescryptSMix1(bp, 1, sBytes/128, 0, sBox, xy, nil)
+			ctxs[i] = &pwxformCtx{
+				s2: sBox[:sWords/3],
+				s1: sBox[sWords/3 : 2*sWords/3],
+				s0: sBox[2*sWords/3:],
+			}
+			if i == 0 {
+				last := make([]byte, 64)
+				for k, w := range bp[s-16:] {
+					binary.LittleEndian.PutUint32(last[4*k:], w)
+				}
+				passwd = hmacSHA256(last, passwd)
+			}
+		}
+		yescryptSMix1(bp, r, np, flags, vp, xy, ctxs[i])
+		yescryptSMix2(bp, r, p2floor(np), nLoopRW, flags, vp, xy, ctxs[i])
+	}
+	for i := uint32(0); i < p; i++ {
+		bp := b[s*int(i) : s*int(i+1)]
+		yescryptSMix2(bp, r, n, nLoopAll-nLoopRW, flags&^yescryptRW, v, xy, ctxs[i])
+	}
+	return passwd
+}
+
+// loadX and storeX convert between B and the SIMD shuffled layout of X that
+// salsa20 and pwxform work on in the reference implementation.
+func loadX(x, b []uint32, r int) {
+	for k := 0; k < 2*r; k++ {
+		for i := 0; i < 16; i++ {
+			x[k*16+i] = b[k*16+(i*5%16)]
+		}
+	}
+}
+
+func storeX(b, x []uint32, r int) {
+	for k := 0; k < 2*r; k++ {
+		for i := 0; i < 16; i++ {
+			b[k*16+(i*5%16)] = x[k*16+i]
+		}
+	}
+}
+
+func yescryptSMix1(b []uint32, r int, n uint64, flags uint32, v, xy []uint32, ctx *pwxformCtx) {
+	s := 32 * r
+	x, y := xy[:s], xy[s:2*s]
+	loadX(x, b, r)
+	for i := uint64(0); i < n; i++ {
+		copy(v[int(i)*s:], x)
+		if flags&yescryptRW != 0 && i > 1 {
+			j := wrap(integerify(x, r), i)
+			blkxor(x, v[int(j)*s:int(j+1)*s])
+		}
+		if ctx != nil {
+			blockmixPwxform(x, r, ctx)
+		} else {
+			blockmixSalsa8(x, y, r)
+		}
+	}
+	storeX(b, x, r)
+}
+
+func yescryptSMix2(b []uint32, r int, n, nLoop uint64, flags uint32, v, xy []uint32, ctx *pwxformCtx) {
+	if nLoop == 0 {
+		return
+	}
+	s := 32 * r
+	x, y := xy[:s], xy[s:2*s]
+	loadX(x, b, r)
+	for i := uint64(0); i < nLoop; i++ {
+		j := integerify(x, r) & (n - 1)
+		vj := v[int(j)*s : int(j+1)*s]
+		blkxor(x, vj)
+		if flags&yescryptRW != 0 {
+			copy(vj, x)
+		}
+		if ctx != nil {
+			blockmixPwxform(x, r, ctx)
+		} else {
+			blockmixSalsa8(x, y, r)
+		}
+	}
+	storeX(b, x, r)
+}
+
+func blkxor(dst, src []uint32) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+func integerify(x []uint32, r int) uint64 {
+	last := x[(2*r-1)*16:]
+	return uint64(last[13])<<32 + uint64(last[0])
+}
+
+func p2floor(x uint64) uint64 {
+	for y := x & (x - 1); y != 0; y = x & (x - 1) {
+		x = y
+	}
+	return x
+}
+
+func wrap(x, i uint64) uint64 {
+	n := p2floor(i)
+	return (x & (n - 1)) + (i - n)
+}
+
+func blockmixSalsa8(b, y []uint32, r int) {
+	var x [16]uint32
+	copy(x[:], b[(2*r-1)*16:])
+	for i := 0; i < 2*r; i++ {
+		blkxor(x[:], b[i*16:(i+1)*16])
+		salsa20(x[:], 8)
+		copy(y[i*16:], x[:])
+	}
+	for i := 0; i < r; i++ {
+		copy(b[i*16:(i+1)*16], y[(i*2)*16:])
+		copy(b[(i+r)*16:(i+r+1)*16], y[(i*2+1)*16:])
+	}
+}
+
+func blockmixPwxform(b []uint32, r int, ctx *pwxformCtx) {
+	var x [pwxWords]uint32
+	r1 := 128 * r / (pwxWords * 4)
+	copy(x[:], b[(r1-1)*pwxWords:])
+	for i := 0; i < r1; i++ {
+		if r1 > 1 {
+			blkxor(x[:], b[i*pwxWords:(i+1)*pwxWords])
+		}
+		pwxform(&x, ctx)
+		copy(b[i*pwxWords:], x[:])
+	}
+	i := (r1 - 1) * pwxWords * 4 / 64
+	salsa20(b[i*16:(i+1)*16], 2)
+	for i++; i < 2*r; i++ {
+		blkxor(b[i*16:(i+1)*16], b[(i-1)*16:i*16])
+		salsa20(b[i*16:(i+1)*16], 2)
+	}
+}
+
+func pwxform(x *[pwxWords]uint32, ctx *pwxformCtx) {
+	s0, s1, s2, w := ctx.s0, ctx.s1, ctx.s2, ctx.w
+	for i := 0; i < pwxRounds; i++ {
+		for j := 0; j < pwxGather; j++ {
+			lane := x[j*pwxSimple*2 : (j+1)*pwxSimple*2]
+			p0 := s0[(lane[0]&sMask)/4:]
+			p1 := s1[(lane[1]&sMask)/4:]
+			for k := 0; k < pwxSimple; k++ {
+				v0 := uint64(p0[2*k+1])<<32 + uint64(p0[2*k])
+				v1 := uint64(p1[2*k+1])<<32 + uint64(p1[2*k])
+				v := uint64(lane[2*k+1]) * uint64(lane[2*k])
+				v += v0
+				v ^= v1
+				lane[2*k] = uint32(v)
+				lane[2*k+1] = uint32(v >> 32)
+			}
+			if i != 0 && i != pwxRounds-1 {
+				copy(s2[w:], lane)
+				w += pwxSimple * 2
+			}
+		}
+	}
+	ctx.s0, ctx.s1, ctx.s2 = s2, s0, s1
+	ctx.w = w & (sWords/3 - 1)
+}
+
+func salsa20(b []uint32, rounds int) {
+	var x [16]uint32
+	for i := 0; i < 16; i++ {
+		x[i*5%16] = b[i]
+	}
+	for i := 0; i < rounds; i += 2 {
+		x[4] ^= bits.RotateLeft32(x[0]+x[12], 7)
+		x[8] ^= bits.RotateLeft32(x[4]+x[0], 9)
+		x[12] ^= bits.RotateLeft32(x[8]+x[4], 13)
+		x[0] ^= bits.RotateLeft32(x[12]+x[8], 18)
+		x[9] ^= bits.RotateLeft32(x[5]+x[1], 7)
+		x[13] ^= bits.RotateLeft32(x[9]+x[5], 9)
+		x[1] ^= bits.RotateLeft32(x[13]+x[9], 13)
+		x[5] ^= bits.RotateLeft32(x[1]+x[13], 18)
+		x[14] ^= bits.RotateLeft32(x[10]+x[6], 7)
+		x[2] ^= bits.RotateLeft32(x[14]+x[10], 9)
+		x[6] ^= bits.RotateLeft32(x[2]+x[14], 13)
+		x[10] ^= bits.RotateLeft32(x[6]+x[2], 18)
+		x[3] ^= bits.RotateLeft32(x[15]+x[11], 7)
+		x[7] ^= bits.RotateLeft32(x[3]+x[15], 9)
+		x[11] ^= bits.RotateLeft32(x[7]+x[3], 13)
+		x[15] ^= bits.RotateLeft32(x[11]+x[7], 18)
+
+		x[1] ^= bits.RotateLeft32(x[0]+x[3], 7)
+		x[2] ^= bits.RotateLeft32(x[1]+x[0], 9)
+		x[3] ^= bits.RotateLeft32(x[2]+x[1], 13)
+		x[0] ^= bits.RotateLeft32(x[3]+x[2], 18)
+		x[6] ^= bits.RotateLeft32(x[5]+x[4], 7)
+		x[7] ^= bits.RotateLeft32(x[6]+x[5], 9)
+		x[4] ^= bits.RotateLeft32(x[7]+x[6], 13)
+		x[5] ^= bits.RotateLeft32(x[4]+x[7], 18)
+		x[11] ^= bits.RotateLeft32(x[10]+x[9], 7)
+		x[8] ^= bits.RotateLeft32(x[11]+x[10], 9)
+		x[9] ^= bits.RotateLeft32(x[8]+x[11], 13)
+		x[10] ^= bits.RotateLeft32(x[9]+x[8], 18)
+		x[12] ^= bits.RotateLeft32(x[15]+x[14], 7)
+		x[13] ^= bits.RotateLeft32(x[12]+x[15], 9)
+		x[14] ^= bits.RotateLeft32(x[13]+x[12], 13)
+		x[15] ^= bits.RotateLeft32(x[14]+x[13], 18)
+	}
+	for i := 0; i < 16; i++ {
+		b[i] += x[i*5%16]
+	}
+}